@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+)
+
+var errAlarm = errors.New("cloudwatch alarm went off after the deploy")
+
+const (
+	alarmStateAlarm = "ALARM"
+
+	// alarmInterval is how often the alarms are polled.
+	alarmInterval = 15 * time.Second
+)
+
+// AlarmGate watches existing CloudWatch alarms for a while after the deploy
+// and fails it as soon as one of them goes off.
+type AlarmGate struct {
+	Names  []string
+	Window time.Duration
+}
+
+// firing returns the alarms currently in ALARM state.
+func (a *AlarmGate) firing(svc *cloudwatch.CloudWatch) ([]*cloudwatch.MetricAlarm, error) {
+	out, err := svc.DescribeAlarms(&cloudwatch.DescribeAlarmsInput{
+		AlarmNames: aws.StringSlice(a.Names),
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	var firing []*cloudwatch.MetricAlarm
+
+	for _, alarm := range out.MetricAlarms {
+		if aws.StringValue(alarm.StateValue) == alarmStateAlarm {
+			firing = append(firing, alarm)
+		}
+	}
+
+	return firing, nil
+}
+
+// watch polls the alarms for the whole evaluation window.
+func (a *AlarmGate) watch(p client.ConfigProvider, envLog *log.Entry) error {
+	svc := cloudwatch.New(p)
+	fields := envLog.WithFields(log.Fields{
+		"alarms": a.Names,
+		"window": a.Window,
+	})
+
+	fields.Info("Watching CloudWatch alarms")
+
+	tick := time.NewTicker(alarmInterval)
+	defer tick.Stop()
+
+	tout := time.After(a.Window)
+
+	for {
+		firing, err := a.firing(svc)
+
+		if err != nil {
+			fields.WithError(err).Warning("Problem retrieving CloudWatch alarms")
+		}
+
+		for _, alarm := range firing {
+			fields.WithFields(log.Fields{
+				"alarm":  aws.StringValue(alarm.AlarmName),
+				"reason": aws.StringValue(alarm.StateReason),
+			}).WithError(errAlarm).Error("CloudWatch alarm went off after the deploy")
+		}
+
+		if len(firing) > 0 {
+			return errAlarm
+		}
+
+		select {
+		case <-tout:
+			fields.Info("No CloudWatch alarm went off")
+			return nil
+		case <-tick.C:
+		}
+	}
+}
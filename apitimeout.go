@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// APITimeouts bound every single AWS API call, separately from the deploy
+// timeout, so a hung call fails and is retried instead of silently using up
+// the whole budget. Zero disables the timeout of an operation.
+type APITimeouts struct {
+	Default    time.Duration
+	Operations map[string]time.Duration
+}
+
+// parseAPITimeouts parses the Operation=duration overrides.
+func parseAPITimeouts(def time.Duration, overrides []string) (APITimeouts, error) {
+	t := APITimeouts{
+		Default:    def,
+		Operations: map[string]time.Duration{},
+	}
+
+	for _, override := range overrides {
+		i := strings.Index(override, "=")
+
+		if i < 0 {
+			return t, fmt.Errorf("invalid api timeout %s, expected Operation=duration", override)
+		}
+
+		d, err := time.ParseDuration(override[i+1:])
+
+		if err != nil {
+			return t, fmt.Errorf("invalid api timeout %s: %s", override, err)
+		}
+
+		t.Operations[override[:i]] = d
+	}
+
+	return t, nil
+}
+
+// timeout returns the timeout of the operation.
+func (t APITimeouts) timeout(operation string) time.Duration {
+	if d, ok := t.Operations[operation]; ok {
+		return d
+	}
+
+	return t.Default
+}
+
+// install bounds every call of the clients created from the handlers
+// afterwards, keeping the send handler of the SDK.
+func (t APITimeouts) install(handlers *request.Handlers) {
+	handlers.Send.PushFrontNamed(request.NamedHandler{
+		Name: "plugin.APITimeoutStartHandler",
+		Fn:   t.start,
+	})
+	handlers.Send.PushBackNamed(request.NamedHandler{
+		Name: "plugin.APITimeoutEndHandler",
+		Fn:   t.end,
+	})
+}
+
+// apiDeadline is the deadline of a single attempt of a call, kept in the
+// context of the attempt along with the context it derives from.
+type apiDeadline struct {
+	parent  aws.Context
+	cancel  context.CancelFunc
+	timeout time.Duration
+}
+
+type apiDeadlineKey struct{}
+
+// start sends the attempt with a deadline.
+func (t APITimeouts) start(r *request.Request) {
+	d := t.timeout(r.Operation.Name)
+
+	if d <= 0 {
+		return
+	}
+
+	parent := r.Context()
+	ctx, cancel := context.WithTimeout(parent, d)
+
+	r.SetContext(context.WithValue(ctx, apiDeadlineKey{}, &apiDeadline{parent, cancel, d}))
+}
+
+// end puts the context of the call back once the attempt was sent, so
+// retries wait on the call instead of the attempt. The deadline still
+// covers the response body, it is released once the body is closed. A
+// timed out attempt names the operation and is retried like any failed
+// request, while the SDK gives up on canceled contexts.
+func (t APITimeouts) end(r *request.Request) {
+	dl, ok := r.Context().Value(apiDeadlineKey{}).(*apiDeadline)
+
+	if !ok {
+		return
+	}
+
+	timedOut := r.Context().Err() == context.DeadlineExceeded && dl.parent.Err() == nil
+	r.SetContext(dl.parent)
+
+	if r.Error == nil {
+		r.HTTPResponse.Body = &cancelBody{r.HTTPResponse.Body, dl.cancel}
+		return
+	}
+
+	dl.cancel()
+
+	if timedOut {
+		r.Error = awserr.New(request.ErrCodeRequestError, fmt.Sprintf("%s timed out after %s", r.Operation.Name, dl.timeout), context.DeadlineExceeded)
+		r.Retryable = aws.Bool(true)
+	}
+}
+
+// cancelBody releases the deadline of the request once the body is closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	defer b.cancel()
+	return b.ReadCloser.Close()
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elasticbeanstalk"
+)
+
+func TestAPITimeouts(t *testing.T) {
+	tests := []struct {
+		name string
+		slow int
+		err  bool
+	}{
+		{name: "fast"},
+		{name: "slow attempt retried", slow: 1},
+		{name: "always slow", slow: 2, err: true},
+	}
+
+	for _, test := range tests {
+		var (
+			mu       sync.Mutex
+			attempts int
+		)
+
+		sess := testSession(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			attempts++
+			slow := attempts <= test.slow
+			mu.Unlock()
+
+			if slow {
+				select {
+				case <-r.Context().Done():
+				case <-time.After(300 * time.Millisecond):
+				}
+			}
+
+			fmt.Fprint(w, "<DescribeApplicationsResponse><DescribeApplicationsResult><Applications/></DescribeApplicationsResult></DescribeApplicationsResponse>")
+		}))
+
+		APITimeouts{Default: 50 * time.Millisecond}.install(&sess.Handlers)
+
+		_, err := elasticbeanstalk.New(sess, &aws.Config{MaxRetries: aws.Int(1)}).DescribeApplications(&elasticbeanstalk.DescribeApplicationsInput{})
+
+		if (err != nil) != test.err {
+			t.Errorf("%s: got error %v, want one %v", test.name, err, test.err)
+		}
+
+		if err != nil && !strings.Contains(err.Error(), "DescribeApplications timed out after 50ms") {
+			t.Errorf("%s: got error %v, want the operation named", test.name, err)
+		}
+
+		if want := test.slow + 1; test.slow < 2 && attempts != want {
+			t.Errorf("%s: got %d attempts, want %d", test.name, attempts, want)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/service/ssm"
+)
+
+var errNotApproved = errors.New("deploy was not approved in time")
+
+// approvalInterval is how often the approval signal is checked.
+const approvalInterval = 15 * time.Second
+
+// Approval holds a deploy until a human signs it off. The signal is a file
+// appearing, an URL answering 200 or a SSM parameter set to Value.
+type Approval struct {
+	Environments []string
+	File         string
+	URL          string
+	Parameter    string
+	Value        string
+	Timeout      time.Duration
+
+	once sync.Once
+	err  error
+}
+
+// enabled reports whether any approval signal is configured.
+func (a *Approval) enabled() bool {
+	return a.File != "" || a.URL != "" || a.Parameter != ""
+}
+
+// gates reports whether the environment belongs to the group waiting for
+// the approval, without any pattern every environment does.
+func (a *Approval) gates(environment string) bool {
+	if !a.enabled() {
+		return false
+	}
+
+	if len(a.Environments) == 0 {
+		return true
+	}
+
+	for _, pattern := range a.Environments {
+		if ok, _ := path.Match(pattern, environment); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// await waits for the approval once, environments of the same group
+// deploying afterwards share the outcome.
+func (a *Approval) await(p client.ConfigProvider) error {
+	a.once.Do(func() {
+		a.err = a.poll(p)
+	})
+
+	return a.err
+}
+
+// poll checks the approval signal until it is given or the timeout passes.
+func (a *Approval) poll(p client.ConfigProvider) error {
+	fields := log.WithFields(log.Fields{
+		"approval-file":      a.File,
+		"approval-url":       a.URL,
+		"approval-parameter": a.Parameter,
+		"approval-timeout":   a.Timeout,
+	})
+
+	fields.Info("Waiting for deploy approval")
+
+	tick := time.NewTicker(approvalInterval)
+	defer tick.Stop()
+
+	tout := time.After(a.Timeout)
+
+	for {
+		approved, err := a.approved(p)
+
+		if err != nil {
+			fields.WithError(err).Warning("Problem checking deploy approval")
+		}
+
+		if approved {
+			fields.Info("Deploy approved")
+			return nil
+		}
+
+		select {
+		case <-tout:
+			fields.WithError(errNotApproved).Error("Deploy was not approved")
+			return errNotApproved
+		case <-tick.C:
+		}
+	}
+}
+
+// approved checks every configured signal, any of them approves.
+func (a *Approval) approved(p client.ConfigProvider) (bool, error) {
+	if a.File != "" {
+		if _, err := os.Stat(a.File); err == nil {
+			return true, nil
+		} else if !os.IsNotExist(err) {
+			return false, err
+		}
+	}
+
+	if a.URL != "" {
+		resp, err := httpClient.Get(a.URL)
+
+		if err != nil {
+			return false, err
+		}
+
+		resp.Body.Close()
+
+		if resp.StatusCode == http.StatusOK {
+			return true, nil
+		}
+	}
+
+	if a.Parameter != "" {
+		out, err := ssm.New(p).GetParameter(&ssm.GetParameterInput{
+			Name: aws.String(a.Parameter),
+		})
+
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == ssm.ErrCodeParameterNotFound {
+			return false, nil
+		}
+
+		if err != nil {
+			return false, err
+		}
+
+		if out.Parameter != nil && aws.StringValue(out.Parameter.Value) == a.Value {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elasticbeanstalk"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// artifactNames derives the version label and bucket key of the artifact
+// when they are not configured explicitly. The label is made of the artifact
+// name, the build number and the short commit sha, falling back to a
+// timestamp outside of Drone. The key is the label under the application.
+func (p *Plugin) artifactNames() {
+	name, ext := splitArtifactName(filepath.Base(p.Artifact))
+
+	switch {
+	case p.Source != "", len(p.WARs) > 0, len(p.DotNet.Sites) > 0:
+		name = p.Application
+	case p.Binary != "":
+		name, _ = splitArtifactName(filepath.Base(p.Binary))
+	}
+
+	if p.needsBundle() {
+		ext = ".zip"
+	}
+
+	if p.VersionLabel == "" {
+		parts := []string{name}
+
+		if p.Build.Number != 0 {
+			parts = append(parts, fmt.Sprint(p.Build.Number))
+		}
+
+		if p.Commit.SHA != "" {
+			parts = append(parts, shortSHA(p.Commit.SHA))
+		}
+
+		if len(parts) == 1 {
+			parts = append(parts, time.Now().UTC().Format("20060102150405"))
+		}
+
+		p.VersionLabel = strings.Join(parts, "-")
+	}
+
+	if p.BucketKey == "" {
+		p.BucketKey = p.Application + "/" + p.VersionLabel + ext
+	}
+}
+
+// hasArtifact reports whether the plugin uploads a local source bundle.
+func (p *Plugin) hasArtifact() bool {
+	return p.Artifact != "" || p.Source != "" || len(p.WARs) > 0 || len(p.DotNet.Sites) > 0 || p.Binary != ""
+}
+
+// uploadArtifact uploads the local source bundle to the bucket key, unless
+// an identical bundle was registered before and ReuseBundles is set.
+func (p *Plugin) uploadArtifact(client *elasticbeanstalk.ElasticBeanstalk) error {
+	if p.Bucket == "" {
+		return fmt.Errorf("a bucket is required to upload the source bundle")
+	}
+
+	bundle, cleanup, err := p.bundleArtifact()
+
+	if err != nil {
+		return err
+	}
+
+	defer cleanup()
+
+	if p.ReuseBundles && p.reuseBundle(client, bundle) {
+		return nil
+	}
+
+	f, err := os.Open(bundle)
+
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	var metadata map[string]*string
+
+	if p.Provenance {
+		pr, err := p.attest(bundle)
+
+		if err != nil {
+			return err
+		}
+
+		p.attestation = pr
+		metadata = pr.metadata()
+	}
+
+	log.WithFields(log.Fields{
+		"artifact":   bundle,
+		"bucket":     p.Bucket,
+		"bucket-key": p.BucketKey,
+	}).Info("Uploading artifact")
+
+	err = uploadObject(p.sess, &s3manager.UploadInput{
+		Bucket:      aws.String(p.Bucket),
+		Key:         aws.String(p.BucketKey),
+		Body:        f,
+		ContentType: aws.String("application/zip"),
+		Metadata:    metadata,
+	})
+
+	if err != nil || p.Signing.KeyID == "" {
+		return err
+	}
+
+	digest, err := p.bundleDigest(bundle)
+
+	if err != nil {
+		return err
+	}
+
+	return p.sign(digest)
+}
+
+func shortSHA(sha string) string {
+	if len(sha) > 8 {
+		return sha[:8]
+	}
+
+	return sha
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elasticbeanstalk"
+)
+
+// audit computes the change a deploy would make and records it in the
+// history store without calling any mutating API.
+func (p *Plugin) audit(client *elasticbeanstalk.ElasticBeanstalk) error {
+	auditLog := log.WithFields(log.Fields{
+		"application":  p.Application,
+		"versionlabel": p.VersionLabel,
+	})
+
+	auditLog.Info("Audit mode, recording the intended change without applying it")
+
+	if p.Bucket != "" && p.BucketKey != "" {
+		existing, err := describeApplicationVersion(client, p.Application, p.VersionLabel)
+
+		if err != nil {
+			auditLog.WithError(err).Error("Problem retrieving application version")
+			return err
+		}
+
+		if existing != nil && !p.sameBundle(existing.SourceBundle) {
+			auditLog.Warn("Version label already exists for a different bundle")
+		}
+	}
+
+	var records []historyRecord
+
+	if p.EnvironmentUpdate {
+		for _, environment := range p.environments() {
+			envLog := auditLog.WithField("environment", environment)
+
+			envs, err := client.DescribeEnvironments(
+				&elasticbeanstalk.DescribeEnvironmentsInput{
+					ApplicationName:  aws.String(p.Application),
+					EnvironmentNames: aws.StringSlice([]string{environment}),
+				},
+			)
+
+			if err != nil {
+				envLog.WithError(err).Error("Problem retrieving environment information")
+				return err
+			}
+
+			record := p.newHistoryRecord("audit", environment)
+
+			if len(envs.Environments) > 0 {
+				record.PreviousVersion = aws.StringValue(envs.Environments[0].VersionLabel)
+			}
+
+			if len(p.OptionSettings) > 0 && p.mayConfigure(client, envLog, environment) {
+				current, err := currentOptionSettings(client, p.Application, environment)
+
+				if err != nil {
+					envLog.WithError(err).Error("Problem retrieving environment settings")
+					return err
+				}
+
+				record.Changes = settingsDiff(current, p.OptionSettings)
+			}
+
+			records = append(records, record)
+		}
+	} else {
+		// only the version is registered, recorded without an environment
+		records = append(records, p.newHistoryRecord("audit", ""))
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+
+	if err := enc.Encode(records); err != nil {
+		return err
+	}
+
+	if p.History == nil {
+		auditLog.Warn("No history store configured, the intended change is not recorded")
+		return nil
+	}
+
+	return p.History.Append(records...)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// partition returns the AWS partition of a region.
+func partition(region string) string {
+	switch {
+	case strings.HasPrefix(region, "cn-"):
+		return "aws-cn"
+	case strings.HasPrefix(region, "us-gov-"):
+		return "aws-us-gov"
+	case strings.HasPrefix(region, "us-isob-"):
+		return "aws-iso-b"
+	case strings.HasPrefix(region, "us-iso-"):
+		return "aws-iso"
+	}
+
+	return "aws"
+}
+
+// consoleURL links to the dashboard of an environment in the console of its
+// partition, it is empty for partitions without a public console.
+func consoleURL(region, environmentID string) string {
+	var domain string
+
+	switch partition(region) {
+	case "aws":
+		// the regional domain also works for opt-in regions
+		domain = region + ".console.aws.amazon.com"
+	case "aws-cn":
+		domain = "console.amazonaws.cn"
+	case "aws-us-gov":
+		domain = "console.amazonaws-us-gov.com"
+	default:
+		return ""
+	}
+
+	return fmt.Sprintf(
+		"https://%s/elasticbeanstalk/home?region=%s#/environment/dashboard?environmentId=%s",
+		domain,
+		region,
+		environmentID,
+	)
+}
+
+// environmentARN builds the ARN of a Beanstalk environment.
+func environmentARN(region, account, application, environment string) string {
+	return fmt.Sprintf(
+		"arn:%s:elasticbeanstalk:%s:%s:environment/%s/%s",
+		partition(region),
+		region,
+		account,
+		application,
+		environment,
+	)
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// addBinary packages a built binary or jar for the Go and Java SE platforms.
+// Without a Procfile the Go platform runs a binary named application and the
+// Java SE platform runs the single jar at the root, so a Go binary is renamed
+// and a jar keeps its name.
+func addBinary(b *zipBundle, binary, procfile string) error {
+	name := filepath.Base(binary)
+
+	if procfile != "" {
+		if err := b.addFile("Procfile", procfile); err != nil {
+			return err
+		}
+	} else if !strings.HasSuffix(name, ".jar") {
+		name = "application"
+	}
+
+	return b.addFile(name, binary)
+}
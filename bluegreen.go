@@ -0,0 +1,334 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elasticbeanstalk"
+)
+
+const (
+	strategyInPlace   = "in-place"
+	strategyBlueGreen = "blue-green"
+)
+
+var (
+	errUnhealthy         = errors.New("environment never got healthy")
+	errAmbiguousLive     = errors.New("both blue and green environments exist, set live_cname")
+	errNoLiveEnvironment = errors.New("neither the blue nor the green environment exists")
+)
+
+// BlueGreen deploys to an idle copy of the environment and swaps the CNAMEs
+// once it is healthy.
+type BlueGreen struct {
+	// Green names the idle environment, defaults to the environment name
+	// with its -blue or -green suffix flipped, or -green appended.
+	Green string
+
+	// LiveCNAME is the CNAME prefix serving production, telling the live
+	// environment apart while both exist.
+	LiveCNAME string
+
+	// Template is a saved configuration the idle environment is created
+	// from, by default it is cloned from the live one.
+	Template string
+
+	// Terminate removes the old environment after the Grace period.
+	Terminate bool
+	Grace     time.Duration
+}
+
+// pair returns the two environments taking turns serving the traffic.
+func (b BlueGreen) pair(environment string) (string, string) {
+	switch {
+	case b.Green != "":
+		return environment, b.Green
+	case strings.HasSuffix(environment, "-blue"):
+		return environment, strings.TrimSuffix(environment, "-blue") + "-green"
+	case strings.HasSuffix(environment, "-green"):
+		return environment, strings.TrimSuffix(environment, "-green") + "-blue"
+	}
+
+	return environment, environment + "-green"
+}
+
+// serves reports whether the environment holds the live CNAME.
+func (b BlueGreen) serves(env *elasticbeanstalk.EnvironmentDescription) bool {
+	return strings.HasPrefix(aws.StringValue(env.CNAME), b.LiveCNAME+".")
+}
+
+// liveEnvironment finds the live environment of the pair and the name of
+// the idle one, whose description is nil when it does not exist yet.
+func (p *Plugin) liveEnvironment(client *elasticbeanstalk.ElasticBeanstalk, environment string) (*elasticbeanstalk.EnvironmentDescription, string, *elasticbeanstalk.EnvironmentDescription, error) {
+	blueName, greenName := p.BlueGreen.pair(environment)
+
+	blue, err := findEnvironment(client, p.Application, blueName)
+
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	green, err := findEnvironment(client, p.Application, greenName)
+
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	switch {
+	case blue == nil && green == nil:
+		return nil, "", nil, errNoLiveEnvironment
+	case green == nil:
+		return blue, greenName, nil, nil
+	case blue == nil:
+		return green, blueName, nil, nil
+	case p.BlueGreen.LiveCNAME == "":
+		return nil, "", nil, errAmbiguousLive
+	case p.BlueGreen.serves(green):
+		return green, blueName, blue, nil
+	}
+
+	return blue, greenName, green, nil
+}
+
+// deployBlueGreen deploys the version label to the idle environment of the
+// pair, verifies it and swaps the CNAMEs. Failures after the swap swap
+// back when a rollback is called for.
+func (p *Plugin) deployBlueGreen(client *elasticbeanstalk.ElasticBeanstalk, envLog *log.Entry, environment string, result *envResult) error {
+	live, idleName, idle, err := p.liveEnvironment(client, environment)
+
+	if err != nil {
+		envLog.WithError(err).Error("Problem finding the live environment")
+		return err
+	}
+
+	liveName := aws.StringValue(live.EnvironmentName)
+
+	envLog = envLog.WithFields(log.Fields{
+		"live": liveName,
+		"idle": idleName,
+	})
+
+	if idle != nil {
+		err = p.deployEnvironment(client, envLog, idleName, result)
+	} else {
+		err = p.createIdleEnvironment(client, envLog, live, idleName, result)
+	}
+
+	result.PreviousVersion = aws.StringValue(live.VersionLabel)
+
+	if err != nil {
+		return err
+	}
+
+	result.begin("health")
+
+	if p.awaitsHealth() {
+		err = p.awaitHealth(client, envLog, idleName)
+	} else {
+		err = p.waitHealthy(client, envLog, idleName)
+	}
+
+	if err != nil {
+		p.reportDegraded(client, envLog, idleName)
+		return err
+	}
+
+	if err := p.verifyEndpoints(client, envLog, idleName, result); err != nil {
+		return err
+	}
+
+	result.begin("swap")
+
+	if err := p.swapCNAMEs(client, envLog, liveName, idleName); err != nil {
+		return err
+	}
+
+	err = p.verifyTraffic(client, envLog, idleName, result)
+
+	if p.shouldRollback(err) {
+		result.begin("rollback")
+
+		if p.swapCNAMEs(client, envLog, idleName, liveName) == nil {
+			result.RolledBackTo = result.PreviousVersion
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if p.BlueGreen.Terminate {
+		result.begin("terminate")
+		p.terminateOld(client, envLog, liveName)
+	}
+
+	p.describeEndpoint(client, envLog, idleName, result)
+
+	return nil
+}
+
+// createIdleEnvironment creates the idle environment running the version
+// label, from the saved configuration or a clone of the live one.
+func (p *Plugin) createIdleEnvironment(client *elasticbeanstalk.ElasticBeanstalk, envLog *log.Entry, live *elasticbeanstalk.EnvironmentDescription, environment string, result *envResult) error {
+	liveName := aws.StringValue(live.EnvironmentName)
+
+	if err := p.checkFreeze(client, envLog, liveName); err != nil {
+		return err
+	}
+
+	if p.Approval.gates(liveName) {
+		result.begin("approval")
+
+		if err := p.Approval.await(p.sess); err != nil {
+			return err
+		}
+	}
+
+	result.begin("create")
+
+	template := p.BlueGreen.Template
+
+	if template == "" {
+		template = fmt.Sprintf("%s-clone-%d", liveName, time.Now().Unix())
+
+		_, err := client.CreateConfigurationTemplate(&elasticbeanstalk.CreateConfigurationTemplateInput{
+			ApplicationName: aws.String(p.Application),
+			TemplateName:    aws.String(template),
+			EnvironmentId:   live.EnvironmentId,
+			Description:     aws.String("Blue/green clone of " + liveName),
+		})
+
+		if err != nil {
+			envLog.WithError(err).Error("Problem saving the live environment configuration")
+			return err
+		}
+
+		defer func() {
+			_, err := client.DeleteConfigurationTemplate(&elasticbeanstalk.DeleteConfigurationTemplateInput{
+				ApplicationName: aws.String(p.Application),
+				TemplateName:    aws.String(template),
+			})
+
+			if err != nil {
+				envLog.WithError(err).Warning("Problem removing the cloned configuration")
+			}
+		}()
+	}
+
+	appFields := envLog.WithFields(log.Fields{
+		"application":  p.Application,
+		"versionlabel": p.VersionLabel,
+		"template":     template,
+	})
+
+	appFields.Info("Creating the idle environment")
+
+	_, err := client.CreateEnvironment(&elasticbeanstalk.CreateEnvironmentInput{
+		ApplicationName: aws.String(p.Application),
+		EnvironmentName: aws.String(environment),
+		TemplateName:    aws.String(template),
+		VersionLabel:    aws.String(p.VersionLabel),
+		Description:     aws.String(p.Description),
+		OptionSettings:  p.OptionSettings,
+		Tags:            p.deployTags(),
+	})
+
+	if err != nil {
+		appFields.WithError(err).Error("Problem creating environment")
+		return err
+	}
+
+	env, err := waitEnvironmentToBeReady(client, envLog, p.Application, environment, newWaitBudget(p.Timeout, p.Polling))
+
+	if err != nil {
+		return err
+	}
+
+	if aws.StringValue(env.VersionLabel) != p.VersionLabel {
+		err := errNotFinished
+		appFields.WithError(err).Error("Environment creation failed, please check EB environment logs")
+		return err
+	}
+
+	return nil
+}
+
+// waitHealthy waits for the environment health to turn Green.
+func (p *Plugin) waitHealthy(client *elasticbeanstalk.ElasticBeanstalk, envLog *log.Entry, environment string) error {
+	tout := time.After(p.Timeout)
+
+	for {
+		env, err := findEnvironment(client, p.Application, environment)
+
+		if err != nil {
+			envLog.WithError(err).Error("Problem retrieving environment information")
+			return err
+		}
+
+		health := aws.StringValue(env.Health)
+
+		if health == elasticbeanstalk.EnvironmentHealthGreen {
+			return nil
+		}
+
+		envLog.WithField("health", health).Info("Waiting for the idle environment to be healthy")
+
+		select {
+		case <-p.Polling.next(healthInterval):
+		case <-tout:
+			envLog.WithError(errUnhealthy).Error("Idle environment never got healthy")
+			return errUnhealthy
+		}
+	}
+}
+
+// swapCNAMEs moves the traffic from the source to the destination
+// environment and waits for both to settle.
+func (p *Plugin) swapCNAMEs(client *elasticbeanstalk.ElasticBeanstalk, envLog *log.Entry, source, destination string) error {
+	envLog.WithFields(log.Fields{
+		"from": source,
+		"to":   destination,
+	}).Info("Swapping environment CNAMEs")
+
+	_, err := client.SwapEnvironmentCNAMEs(&elasticbeanstalk.SwapEnvironmentCNAMEsInput{
+		SourceEnvironmentName:      aws.String(source),
+		DestinationEnvironmentName: aws.String(destination),
+	})
+
+	if err != nil {
+		envLog.WithError(err).Error("Problem swapping environment CNAMEs")
+		return err
+	}
+
+	for _, environment := range []string{source, destination} {
+		if _, err := waitEnvironmentToBeReady(client, envLog, p.Application, environment, newWaitBudget(p.Timeout, p.Polling)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// terminateOld terminates the previously live environment after the grace
+// period. Problems are only logged, the deploy itself succeeded.
+func (p *Plugin) terminateOld(client *elasticbeanstalk.ElasticBeanstalk, envLog *log.Entry, environment string) {
+	if p.BlueGreen.Grace > 0 {
+		envLog.WithField("grace", p.BlueGreen.Grace).Info("Waiting before terminating the old environment")
+		time.Sleep(p.BlueGreen.Grace)
+	}
+
+	_, err := client.TerminateEnvironment(&elasticbeanstalk.TerminateEnvironmentInput{
+		EnvironmentName: aws.String(environment),
+	})
+
+	if err != nil {
+		envLog.WithError(err).WithField("old", environment).Error("Problem terminating the old environment")
+		return
+	}
+
+	envLog.WithField("old", environment).Info("Old environment is terminating")
+}
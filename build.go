@@ -0,0 +1,24 @@
+package main
+
+// Repo holds the repository metadata provided by Drone.
+type Repo struct {
+	FullName string
+	Name     string
+}
+
+// Build holds the build metadata provided by Drone.
+type Build struct {
+	Number      int
+	Link        string
+	Event       string
+	Action      string
+	PullRequest int
+}
+
+// Commit holds the commit metadata provided by Drone.
+type Commit struct {
+	SHA     string
+	Branch  string
+	Message string
+	Author  string
+}
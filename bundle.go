@@ -0,0 +1,299 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// tarballExtensions are the artifact extensions converted to a zip bundle.
+var tarballExtensions = []string{".tar.gz", ".tgz"}
+
+func isTarball(name string) bool {
+	return tarballExtension(name) != ""
+}
+
+func tarballExtension(name string) string {
+	for _, ext := range tarballExtensions {
+		if strings.HasSuffix(name, ext) {
+			return ext
+		}
+	}
+
+	return ""
+}
+
+// splitArtifactName returns the base name of the artifact and the extension
+// of the source bundle built from it.
+func splitArtifactName(name string) (string, string) {
+	if ext := tarballExtension(name); ext != "" {
+		return strings.TrimSuffix(name, ext), ".zip"
+	}
+
+	ext := filepath.Ext(name)
+	return strings.TrimSuffix(name, ext), ext
+}
+
+// needsBundle reports whether the source bundle is built by the plugin
+// instead of uploading the artifact as is.
+func (p *Plugin) needsBundle() bool {
+	return p.Source != "" ||
+		len(p.WARs) > 0 ||
+		len(p.DotNet.Sites) > 0 ||
+		p.Binary != "" ||
+		isTarball(p.Artifact) ||
+		len(p.NginxConfigs) > 0
+}
+
+// bundleArtifact returns the path of the source bundle to upload. Source
+// directories, WAR files, .NET sites and binaries are packaged, tarballs converted and
+// zips copied into a temporary bundle when configuration has to be injected. The returned
+// function removes any temporary file.
+func (p *Plugin) bundleArtifact() (string, func(), error) {
+	if !p.needsBundle() {
+		return p.Artifact, func() {}, nil
+	}
+
+	b, err := newZipBundle()
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	switch {
+	case p.Source != "":
+		err = addDirectory(b, p.Source, p.SourceFilter)
+	case len(p.WARs) > 0:
+		err = addWARs(b, p.WARs)
+	case len(p.DotNet.Sites) > 0:
+		err = addDotNet(b, p.DotNet)
+	case p.Binary != "":
+		err = addBinary(b, p.Binary, p.Procfile)
+	case isTarball(p.Artifact):
+		err = tarGzToZip(p.Artifact, b.zw)
+	case strings.HasSuffix(p.Artifact, ".war"):
+		err = addWARs(b, []string{p.Artifact})
+	default:
+		err = copyZip(p.Artifact, b.zw)
+	}
+
+	if err == nil {
+		err = addNginxConfigs(b, p.NginxConfigs)
+	}
+
+	if err != nil {
+		b.discard()
+		return "", nil, err
+	}
+
+	return b.close()
+}
+
+// nginxConfigDir is where Amazon Linux 2 platforms pick up proxy snippets.
+const nginxConfigDir = ".platform/nginx/conf.d"
+
+// addNginxConfigs injects the proxy configuration files into the bundle.
+func addNginxConfigs(b *zipBundle, configs []string) error {
+	for _, config := range configs {
+		if err := b.addFile(nginxConfigDir+"/"+filepath.Base(config), config); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// copyZip copies every entry of an existing zip into the bundle.
+func copyZip(src string, zw *zip.Writer) error {
+	zr, err := zip.OpenReader(src)
+
+	if err != nil {
+		return err
+	}
+
+	defer zr.Close()
+
+	for _, f := range zr.File {
+		fh := f.FileHeader
+
+		w, err := zw.CreateHeader(&fh)
+
+		if err != nil {
+			return err
+		}
+
+		rc, err := f.Open()
+
+		if err != nil {
+			return err
+		}
+
+		_, err = io.Copy(w, rc)
+		rc.Close()
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// zipBundle builds a source bundle in a temporary zip file.
+type zipBundle struct {
+	f  *os.File
+	zw *zip.Writer
+}
+
+func newZipBundle() (*zipBundle, error) {
+	f, err := ioutil.TempFile("", "bundle-")
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &zipBundle{f: f, zw: zip.NewWriter(f)}, nil
+}
+
+// addFile copies the local file into the bundle under the name.
+func (b *zipBundle) addFile(name, path string) error {
+	in, err := os.Open(path)
+
+	if err != nil {
+		return err
+	}
+
+	defer in.Close()
+
+	info, err := in.Stat()
+
+	if err != nil {
+		return err
+	}
+
+	fh, err := zip.FileInfoHeader(info)
+
+	if err != nil {
+		return err
+	}
+
+	fh.Name = filepath.ToSlash(name)
+	fh.Method = zip.Deflate
+
+	w, err := b.zw.CreateHeader(fh)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(w, in)
+	return err
+}
+
+// close finishes the zip and returns its path and a cleanup function.
+func (b *zipBundle) close() (string, func(), error) {
+	cleanup := func() { os.Remove(b.f.Name()) }
+
+	if err := b.zw.Close(); err != nil {
+		b.f.Close()
+		cleanup()
+		return "", nil, err
+	}
+
+	if err := b.f.Close(); err != nil {
+		cleanup()
+		return "", nil, err
+	}
+
+	return b.f.Name(), cleanup, nil
+}
+
+// discard drops a bundle that failed to build.
+func (b *zipBundle) discard() {
+	b.f.Close()
+	os.Remove(b.f.Name())
+}
+
+// tarGzToZip copies every entry of the tarball into a zip archive, keeping
+// file modes so executables and symlinks survive the conversion.
+func tarGzToZip(src string, zw *zip.Writer) error {
+	in, err := os.Open(src)
+
+	if err != nil {
+		return err
+	}
+
+	defer in.Close()
+
+	gz, err := gzip.NewReader(in)
+
+	if err != nil {
+		return err
+	}
+
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+
+	for {
+		hdr, err := tr.Next()
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return err
+		}
+
+		name := strings.TrimPrefix(hdr.Name, "./")
+
+		if name == "" {
+			continue
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeReg, tar.TypeRegA, tar.TypeDir, tar.TypeSymlink:
+		default:
+			continue
+		}
+
+		fh, err := zip.FileInfoHeader(hdr.FileInfo())
+
+		if err != nil {
+			return err
+		}
+
+		fh.Name = name
+
+		if hdr.Typeflag == tar.TypeDir {
+			fh.Name = strings.TrimSuffix(name, "/") + "/"
+		} else {
+			fh.Method = zip.Deflate
+		}
+
+		w, err := zw.CreateHeader(fh)
+
+		if err != nil {
+			return err
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeSymlink:
+			_, err = io.WriteString(w, hdr.Linkname)
+		case tar.TypeReg, tar.TypeRegA:
+			_, err = io.Copy(w, tr)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
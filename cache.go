@@ -0,0 +1,145 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/elasticbeanstalk"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// bundleIndexPrefix is where the markers mapping bundle checksums to version
+// labels are kept, under the application.
+const bundleIndexPrefix = "/.bundles/"
+
+// bundleChecksum returns the hex encoded SHA256 of the bundle.
+func bundleChecksum(bundle string) (string, error) {
+	f, err := os.Open(bundle)
+
+	if err != nil {
+		return "", err
+	}
+
+	defer f.Close()
+
+	h := sha256.New()
+
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// bundleDigest returns the checksum of the bundle, computed only once.
+func (p *Plugin) bundleDigest(bundle string) (string, error) {
+	if p.bundleChecksum != "" {
+		return p.bundleChecksum, nil
+	}
+
+	checksum, err := bundleChecksum(bundle)
+
+	if err != nil {
+		return "", err
+	}
+
+	p.bundleChecksum = checksum
+	return checksum, nil
+}
+
+// bundleIndexKey is the key of the marker of a bundle checksum.
+func (p *Plugin) bundleIndexKey(checksum string) string {
+	return p.Application + bundleIndexPrefix + checksum
+}
+
+// cachedVersion returns the version label an identical bundle was registered
+// with, or an empty string when there is none or it was deleted since.
+func (p *Plugin) cachedVersion(client *elasticbeanstalk.ElasticBeanstalk, checksum string) (string, error) {
+	out, err := s3.New(p.sess).HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(p.Bucket),
+		Key:    aws.String(p.bundleIndexKey(checksum)),
+	})
+
+	if aerr, ok := err.(awserr.RequestFailure); ok && aerr.StatusCode() == 404 {
+		return "", nil
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	label := ""
+
+	for k, v := range out.Metadata {
+		if strings.EqualFold(k, "version-label") {
+			label = aws.StringValue(v)
+		}
+	}
+
+	if label == "" {
+		return "", nil
+	}
+
+	version, err := describeApplicationVersion(client, p.Application, label)
+
+	if err != nil || version == nil {
+		return "", err
+	}
+
+	return label, nil
+}
+
+// rememberBundle records the version label registered for the bundle.
+func (p *Plugin) rememberBundle() error {
+	_, err := s3.New(p.sess).PutObject(&s3.PutObjectInput{
+		Bucket:      aws.String(p.Bucket),
+		Key:         aws.String(p.bundleIndexKey(p.bundleChecksum)),
+		Body:        strings.NewReader(""),
+		ContentType: aws.String("text/plain"),
+		Metadata: map[string]*string{
+			"version-label": aws.String(p.VersionLabel),
+		},
+	})
+
+	return err
+}
+
+// reuseBundle looks up the version of an identical bundle and switches the
+// deploy over to it, reporting whether the upload can be skipped.
+func (p *Plugin) reuseBundle(client *elasticbeanstalk.ElasticBeanstalk, bundle string) bool {
+	checksum, err := bundleChecksum(bundle)
+
+	if err != nil {
+		log.WithError(err).Warning("Problem computing the bundle checksum, not reusing versions")
+		return false
+	}
+
+	p.bundleChecksum = checksum
+
+	label, err := p.cachedVersion(client, checksum)
+
+	if err != nil {
+		log.WithError(err).Warning("Problem looking up versions of identical bundles")
+		return false
+	}
+
+	if label == "" {
+		return false
+	}
+
+	log.WithFields(log.Fields{
+		"sha256":       checksum,
+		"versionlabel": label,
+	}).Info("Identical bundle already registered, reusing its version")
+
+	p.useVersionLabel(label)
+	p.reusedVersion = true
+
+	return true
+}
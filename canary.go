@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/service/elasticbeanstalk"
+)
+
+const trafficSplittingNamespace = "aws:elasticbeanstalk:trafficsplitting"
+
+var errCanaryFailed = errors.New("canary exceeded the error rate or latency thresholds")
+
+// Canary deploys with traffic splitting, sending a percentage of the traffic
+// to a fresh set of instances for the evaluation time before Beanstalk
+// promotes them.
+type Canary struct {
+	Percent  int
+	Duration time.Duration
+}
+
+// enabled reports whether the deploy is a canary.
+func (c Canary) enabled() bool {
+	return c.Percent > 0
+}
+
+// validate checks the canary fits what traffic splitting supports.
+func (c Canary) validate(policy string) error {
+	if !c.enabled() {
+		return nil
+	}
+
+	if c.Percent > 100 {
+		return fmt.Errorf("canary percent %d is over 100", c.Percent)
+	}
+
+	if policy != "" && policy != "TrafficSplitting" {
+		return fmt.Errorf("canary deploys need the TrafficSplitting policy, not %s", policy)
+	}
+
+	return nil
+}
+
+// evaluationMinutes rounds the duration up to whole minutes, the unit of
+// the evaluation time.
+func (c Canary) evaluationMinutes() int {
+	return int((c.Duration + time.Minute - 1) / time.Minute)
+}
+
+func (c Canary) optionSettings() []*elasticbeanstalk.ConfigurationOptionSetting {
+	if !c.enabled() {
+		return nil
+	}
+
+	settings := []*elasticbeanstalk.ConfigurationOptionSetting{
+		optionSetting(commandNamespace, "DeploymentPolicy", "TrafficSplitting"),
+		optionSetting(trafficSplittingNamespace, "NewVersionPercent", strconv.Itoa(c.Percent)),
+	}
+
+	if c.Duration > 0 {
+		settings = append(settings, optionSetting(trafficSplittingNamespace, "EvaluationTime", strconv.Itoa(c.evaluationMinutes())))
+	}
+
+	return settings
+}
+
+// checkCanary samples the metrics of the environment while the canary runs
+// and aborts the update when they exceed the thresholds of the metrics guard,
+// which moves the traffic back to the instances of the old version.
+func (p *Plugin) checkCanary(client *elasticbeanstalk.ElasticBeanstalk, appFields *log.Entry, environment string, baseline *healthMetrics) error {
+	m, err := environmentMetrics(client, environment)
+
+	if err != nil {
+		appFields.WithError(err).Warn("Problem sampling canary metrics")
+		return nil
+	}
+
+	if m == nil {
+		return nil
+	}
+
+	fields := appFields.WithFields(log.Fields{
+		"requests":   m.Requests,
+		"error-rate": m.ErrorRate,
+		"p99":        m.P99,
+	})
+
+	if !p.Metrics.exceeds(m, baseline) {
+		fields.Debug("Canary within the thresholds")
+		return nil
+	}
+
+	fields.WithError(errCanaryFailed).Error("Canary is unhealthy")
+	abortEnvironmentUpdate(client, appFields, environment)
+
+	return errCanaryFailed
+}
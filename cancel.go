@@ -0,0 +1,91 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"syscall"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/service/elasticbeanstalk"
+)
+
+// exitCancelled is the exit code after a cancelled build was cleaned up.
+const exitCancelled = 130
+
+// updateTracker records the environments with an update in flight, so they
+// can be aborted when the build is cancelled.
+type updateTracker struct {
+	mu           sync.Mutex
+	environments map[string]bool
+}
+
+func newUpdateTracker() *updateTracker {
+	return &updateTracker{environments: map[string]bool{}}
+}
+
+func (t *updateTracker) add(environment string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.environments[environment] = true
+}
+
+func (t *updateTracker) remove(environment string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.environments, environment)
+}
+
+// list returns the environments being updated, sorted.
+func (t *updateTracker) list() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var environments []string
+
+	for environment := range t.environments {
+		environments = append(environments, environment)
+	}
+
+	sort.Strings(environments)
+	return environments
+}
+
+// trapCancel aborts the updates in flight when Drone cancels the build,
+// which stops the plugin with SIGTERM while Beanstalk would otherwise keep
+// updating. The returned function stops trapping.
+func (p *Plugin) trapCancel(client *elasticbeanstalk.ElasticBeanstalk) func() {
+	signals := make(chan os.Signal, 1)
+	done := make(chan struct{})
+
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+
+	go func() {
+		select {
+		case sig := <-signals:
+			environments := p.updating.list()
+			cancelLog := log.WithFields(log.Fields{
+				"signal":       sig.String(),
+				"environments": environments,
+			})
+
+			cancelLog.Warn("Build cancelled, aborting the updates in flight")
+
+			for _, environment := range environments {
+				abortEnvironmentUpdate(client, log.WithField("environment", environment), environment)
+			}
+
+			p.writeStatus(p.started, errCancelled, exitCancelled)
+			os.Exit(exitCancelled)
+		case <-done:
+		}
+	}()
+
+	return func() {
+		signal.Stop(signals)
+		close(done)
+	}
+}
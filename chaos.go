@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/elasticbeanstalk"
+)
+
+// Failures the chaos setting can simulate.
+const (
+	chaosThrottle  = "throttle"
+	chaosTimeout   = "timeout"
+	chaosRedHealth = "red-health"
+)
+
+// Chaos simulates failures, so pipelines can exercise their notifications,
+// rollbacks and retries without breaking an environment.
+type Chaos struct {
+	// Throttle fails the environment update as throttled before it is
+	// sent, leaving the environment untouched.
+	Throttle bool
+
+	// Timeout times out waiting for the environment before it is updated.
+	Timeout bool
+
+	// RedHealth reports the updated environment as unhealthy.
+	RedHealth bool
+}
+
+// parseChaos turns the names of the failures into a Chaos.
+func parseChaos(names []string) (Chaos, error) {
+	c := Chaos{}
+
+	for _, name := range names {
+		switch name {
+		case chaosThrottle:
+			c.Throttle = true
+		case chaosTimeout:
+			c.Timeout = true
+		case chaosRedHealth:
+			c.RedHealth = true
+		default:
+			return c, fmt.Errorf("unknown simulated failure %s", name)
+		}
+	}
+
+	return c, nil
+}
+
+// enabled reports whether any failure is simulated.
+func (c Chaos) enabled() bool {
+	return c.Throttle || c.Timeout || c.RedHealth
+}
+
+// install fails environment updates with a throttling error once they are
+// built, so they never reach Beanstalk.
+func (c Chaos) install(handlers *request.Handlers) {
+	if !c.Throttle {
+		return
+	}
+
+	handlers.Sign.PushBack(func(r *request.Request) {
+		if r.ClientInfo.ServiceName != elasticbeanstalk.ServiceName || r.Operation.Name != "UpdateEnvironment" {
+			return
+		}
+
+		r.Error = awserr.NewRequestFailure(
+			awserr.New("Throttling", "Rate exceeded (simulated)", nil),
+			400,
+			"",
+		)
+	})
+}
+
+// redHealth reports the environment as unhealthy.
+func redHealth(envLog *log.Entry) error {
+	envLog.WithError(errUnhealthy).WithField("color", elasticbeanstalk.EnvironmentHealthRed).Error("Environment never got healthy (simulated)")
+	return errUnhealthy
+}
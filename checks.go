@@ -0,0 +1,255 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+var (
+	errChecksFailed = errors.New("http checks never passed")
+	errSmokeTest    = errors.New("smoke test never passed")
+)
+
+const (
+	// checkInterval is how often failing checks are retried.
+	checkInterval = 10 * time.Second
+
+	// versionPlaceholder is replaced by the deployed version label in
+	// expected values.
+	versionPlaceholder = "{{version}}"
+)
+
+// HTTPCheck requests a path of the environment, or an absolute URL, and
+// asserts the status, headers, body and JSON values of the response.
+type HTTPCheck struct {
+	URL     string            `json:"url"`
+	Path    string            `json:"path"`
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers"`
+	Body    string            `json:"body"`
+	JSON    map[string]string `json:"json"`
+}
+
+// parseChecks reads the checks setting, Drone hands YAML lists over as JSON.
+func parseChecks(setting string) ([]HTTPCheck, error) {
+	if setting == "" {
+		return nil, nil
+	}
+
+	var checks []HTTPCheck
+
+	if err := json.Unmarshal([]byte(setting), &checks); err != nil {
+		return nil, err
+	}
+
+	return checks, nil
+}
+
+// target returns the URL the check requests.
+func (c *HTTPCheck) target(baseURL string) string {
+	if c.URL != "" {
+		return c.URL
+	}
+
+	return strings.TrimRight(baseURL, "/") + "/" + strings.TrimLeft(c.Path, "/")
+}
+
+// run performs the check once.
+func (c *HTTPCheck) run(baseURL, version string) error {
+	url := c.target(baseURL)
+	resp, err := httpClient.Get(url)
+
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	status := c.Status
+
+	if status == 0 {
+		status = 200
+	}
+
+	if resp.StatusCode != status {
+		io.Copy(ioutil.Discard, resp.Body)
+		return fmt.Errorf("%s returned %s, expected %d", url, resp.Status, status)
+	}
+
+	for name, want := range c.Headers {
+		want = strings.Replace(want, versionPlaceholder, version, -1)
+
+		if got := resp.Header.Get(name); got != want {
+			return fmt.Errorf("%s returned header %s %q, expected %q", url, name, got, want)
+		}
+	}
+
+	if c.Body == "" && len(c.JSON) == 0 {
+		io.Copy(ioutil.Discard, resp.Body)
+		return nil
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+
+	if err != nil {
+		return err
+	}
+
+	if c.Body != "" {
+		pattern := strings.Replace(c.Body, versionPlaceholder, regexp.QuoteMeta(version), -1)
+		re, err := regexp.Compile(pattern)
+
+		if err != nil {
+			return fmt.Errorf("invalid body pattern %q: %s", c.Body, err)
+		}
+
+		if !re.Match(body) {
+			return fmt.Errorf("%s returned a body not matching %q", url, c.Body)
+		}
+	}
+
+	if len(c.JSON) == 0 {
+		return nil
+	}
+
+	var doc interface{}
+
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return fmt.Errorf("%s returned invalid JSON: %s", url, err)
+	}
+
+	for path, want := range c.JSON {
+		want = strings.Replace(want, versionPlaceholder, version, -1)
+		got, ok := jsonPath(doc, path)
+
+		if !ok {
+			return fmt.Errorf("%s returned no %s", url, path)
+		}
+
+		if fmt.Sprint(got) != want {
+			return fmt.Errorf("%s returned %s %q, expected %q", url, path, fmt.Sprint(got), want)
+		}
+	}
+
+	return nil
+}
+
+// jsonPath looks up a simple JSONPath such as $.build.versions[0].label.
+func jsonPath(doc interface{}, path string) (interface{}, bool) {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+
+	if path == "" {
+		return doc, true
+	}
+
+	for _, part := range strings.Split(strings.Replace(path, "[", ".[", -1), ".") {
+		if part == "" {
+			continue
+		}
+
+		if strings.HasPrefix(part, "[") && strings.HasSuffix(part, "]") {
+			i, err := strconv.Atoi(part[1 : len(part)-1])
+			list, ok := doc.([]interface{})
+
+			if err != nil || !ok || i < 0 || i >= len(list) {
+				return nil, false
+			}
+
+			doc = list[i]
+			continue
+		}
+
+		object, ok := doc.(map[string]interface{})
+
+		if !ok {
+			return nil, false
+		}
+
+		if doc, ok = object[part]; !ok {
+			return nil, false
+		}
+	}
+
+	return doc, true
+}
+
+// runChecks retries the checks until all of them pass at once or the timeout
+// passes.
+func runChecks(envLog *log.Entry, checks []HTTPCheck, baseURL, version string, timeout time.Duration) error {
+	tick := time.NewTicker(checkInterval)
+	defer tick.Stop()
+
+	tout := time.After(timeout)
+
+	for {
+		var err error
+
+		for i := range checks {
+			if err = checks[i].run(baseURL, version); err != nil {
+				break
+			}
+		}
+
+		if err == nil {
+			envLog.WithField("checks", len(checks)).Info("HTTP checks passed")
+			return nil
+		}
+
+		envLog.WithError(err).Info("HTTP checks are not passing yet")
+
+		select {
+		case <-tout:
+			envLog.WithError(err).Error("HTTP checks never passed")
+			return errChecksFailed
+		case <-tick.C:
+		}
+	}
+}
+
+// SmokeTest probes the environment once it is updated, the step fails when
+// the probe never passes within the attempts.
+type SmokeTest struct {
+	Enabled  bool
+	Check    HTTPCheck
+	Attempts int
+}
+
+// newHealthCheck requests an absolute URL, or a path of the environment.
+func newHealthCheck(target string, status int, body string) HTTPCheck {
+	if strings.Contains(target, "://") {
+		return HTTPCheck{URL: target, Status: status, Body: body}
+	}
+
+	return HTTPCheck{Path: target, Status: status, Body: body}
+}
+
+// run retries the probe until it passes or the attempts run out.
+func (s *SmokeTest) run(envLog *log.Entry, baseURL, version string) error {
+	url := s.Check.target(baseURL)
+
+	for attempt := 1; ; attempt++ {
+		err := s.Check.run(baseURL, version)
+
+		if err == nil {
+			envLog.WithField("url", url).Info("Smoke test passed")
+			return nil
+		}
+
+		if attempt >= s.Attempts {
+			envLog.WithError(err).WithField("attempts", attempt).Error("Smoke test never passed")
+			return errSmokeTest
+		}
+
+		envLog.WithError(err).WithField("attempt", attempt).Info("Smoke test is not passing yet")
+		time.Sleep(checkInterval)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/elasticbeanstalk"
+)
+
+// clientKey identifies the clients of a region and role, an empty role
+// stands for the credentials of the runner.
+type clientKey struct {
+	region string
+	role   string
+}
+
+// awsClients are the session of a region and role with the clients and
+// caller identity built on it.
+type awsClients struct {
+	sess      *session.Session
+	beanstalk *elasticbeanstalk.ElasticBeanstalk
+	identity  *callerIdentity
+}
+
+// clientCache hands out one session per region and role, so deployments
+// and parallel environment workers sharing them reuse the assumed
+// credentials instead of assuming the role again.
+type clientCache struct {
+	mu sync.Mutex
+
+	// base is the configuration of the runner credentials, roles are
+	// assumed with them.
+	base    *aws.Config
+	assume  AssumeRole
+	install func(*request.Handlers)
+	clients map[clientKey]*awsClients
+}
+
+func newClientCache(base *aws.Config, assume AssumeRole, install func(*request.Handlers)) *clientCache {
+	return &clientCache{
+		base:    base,
+		assume:  assume,
+		install: install,
+		clients: map[clientKey]*awsClients{},
+	}
+}
+
+// get returns the clients of the region and role, creating them the first
+// time they are asked for.
+func (c *clientCache) get(region, role string) *awsClients {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := clientKey{region: region, role: role}
+
+	if clients, ok := c.clients[key]; ok {
+		return clients
+	}
+
+	conf := c.base.Copy().WithRegion(region)
+
+	if role != "" {
+		log.WithFields(log.Fields{
+			"role":   role,
+			"region": region,
+		}).Info("Assuming role")
+
+		base := session.New(c.base.Copy().WithRegion(region))
+		c.install(&base.Handlers)
+
+		assume := c.assume
+		assume.RoleARN = role
+		conf.Credentials = assume.credentials(base)
+	}
+
+	sess := session.New(conf)
+	c.install(&sess.Handlers)
+
+	clients := &awsClients{
+		sess:      sess,
+		beanstalk: elasticbeanstalk.New(sess),
+		identity:  &callerIdentity{},
+	}
+
+	c.clients[key] = clients
+
+	return clients
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elasticbeanstalk"
+)
+
+var errConcurrentDeploy = errors.New("another deploy to the environment is in flight")
+
+// deployStartMessages are the event messages Beanstalk emits when a deploy
+// to the environment begins.
+var deployStartMessages = []string{
+	"Environment update is starting",
+	"createEnvironment is starting",
+}
+
+// deployEndMessages are the event messages Beanstalk emits when a deploy
+// to the environment is over, whether it succeeded or not.
+var deployEndMessages = []string{
+	"Environment update completed successfully",
+	"createEnvironment completed successfully",
+	"Failed to deploy application",
+	"Environment update was aborted",
+	"Update environment operation is complete, but with errors",
+	"Successfully launched environment",
+}
+
+// hasMessage reports whether the event message contains one of the
+// messages.
+func hasMessage(event *elasticbeanstalk.EventDescription, messages []string) bool {
+	message := aws.StringValue(event.Message)
+
+	for _, m := range messages {
+		if strings.Contains(message, m) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// recentDeploy returns the start of a deploy by another build still in
+// flight within the concurrency window, or nil when there is none. A deploy
+// is over once an end event follows its start and the environment left the
+// in progress statuses.
+func (p *Plugin) recentDeploy(client *elasticbeanstalk.ElasticBeanstalk, env *elasticbeanstalk.EnvironmentDescription) (*time.Time, error) {
+	events, err := client.DescribeEvents(&elasticbeanstalk.DescribeEventsInput{
+		ApplicationName: aws.String(p.Application),
+		EnvironmentName: env.EnvironmentName,
+		StartTime:       aws.Time(time.Now().Add(-p.ConcurrencyWindow)),
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	ended := false
+
+	// events are returned newest first, so an end seen before the latest
+	// start is the end of that deploy
+	for _, event := range events.Events {
+		if hasMessage(event, deployEndMessages) {
+			ended = true
+			continue
+		}
+
+		if !hasMessage(event, deployStartMessages) {
+			continue
+		}
+
+		if ended && !inProgress(aws.StringValue(env.Status)) {
+			return nil, nil
+		}
+
+		own, err := p.ownVersion(client, aws.StringValue(env.VersionLabel))
+
+		if err != nil || own {
+			return nil, err
+		}
+
+		return event.EventDate, nil
+	}
+
+	return nil, nil
+}
+
+// ownVersion reports whether the version was deployed by this build. The
+// build tags of the version tell, versions without them are told apart by
+// their label.
+func (p *Plugin) ownVersion(client *elasticbeanstalk.ElasticBeanstalk, label string) (bool, error) {
+	if label == "" {
+		return false, nil
+	}
+
+	tags, err := p.versionTags(client, label)
+
+	if err != nil {
+		return false, err
+	}
+
+	build := tags[buildTagPrefix+"build"]
+
+	if build == "" {
+		return label == p.VersionLabel, nil
+	}
+
+	own := p.buildTags()
+
+	return build == own[buildTagPrefix+"build"] && tags[buildTagPrefix+"repo"] == own[buildTagPrefix+"repo"], nil
+}
+
+// checkConcurrent fails when another build deployed to the environment
+// within the concurrency window and that deploy is still in flight, or
+// waits for it to be over when configured to. It runs before waiting for
+// the environment to be ready, which would otherwise wait out the other
+// deploy, and its polls draw on the budget of the deploy.
+func (p *Plugin) checkConcurrent(client *elasticbeanstalk.ElasticBeanstalk, envLog *log.Entry, environment string, budget *waitBudget) error {
+	if p.ConcurrencyWindow == 0 {
+		return nil
+	}
+
+	for {
+		env, err := findEnvironment(client, p.Application, environment)
+
+		// missing environments are reported by the wait for them
+		if err == nil && env == nil {
+			return nil
+		}
+
+		var started *time.Time
+
+		if err == nil {
+			started, err = p.recentDeploy(client, env)
+		}
+
+		if err != nil {
+			envLog.WithError(err).Error("Problem looking for deploys of other builds")
+			return err
+		}
+
+		if started == nil {
+			return nil
+		}
+
+		fields := envLog.WithFields(log.Fields{
+			"deploying":  aws.StringValue(env.VersionLabel),
+			"started-at": started.Format(time.RFC3339),
+		})
+
+		if !p.WaitForConcurrent {
+			fields.WithError(errConcurrentDeploy).Error("Another deploy to this environment is in flight")
+			return errConcurrentDeploy
+		}
+
+		fields.Info("Another deploy to this environment is in flight, waiting")
+
+		if !budget.wait() {
+			fields.WithError(errConcurrentDeploy).Error("Another deploy to this environment did not complete in time")
+			return errConcurrentDeploy
+		}
+	}
+}
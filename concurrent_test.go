@@ -0,0 +1,174 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elasticbeanstalk"
+)
+
+func TestRecentDeploy(t *testing.T) {
+	started := time.Now().UTC().Add(-time.Minute).Truncate(time.Second)
+
+	event := func(message string) string {
+		return fmt.Sprintf("<member><EventDate>%s</EventDate><Message>%s</Message></member>", started.Format(time.RFC3339), message)
+	}
+
+	tag := func(key, value string) string {
+		return fmt.Sprintf("<member><Key>%s</Key><Value>%s</Value></member>", key, value)
+	}
+
+	ours := tag("drone:build", "42") + tag("drone:repo", "org/app")
+	theirs := tag("drone:build", "41") + tag("drone:repo", "org/app")
+
+	tests := []struct {
+		name    string
+		version string
+		tags    string
+		status  string
+		events  []string
+		want    bool
+	}{
+		{name: "same version", version: "v2", events: []string{event("Environment update is starting.")}},
+		{name: "same build", version: "v1", tags: ours, events: []string{event("Environment update is starting.")}},
+		{name: "same version of another build", version: "v2", tags: theirs, events: []string{event("Environment update is starting.")}, want: true},
+		{name: "build of another repo", version: "v1", tags: tag("drone:build", "42") + tag("drone:repo", "org/other"), events: []string{event("Environment update is starting.")}, want: true},
+		{name: "no events", version: "v1"},
+		{name: "update started", version: "v1", events: []string{event("Environment update is starting.")}, want: true},
+		{name: "environment created", version: "v1", events: []string{event("createEnvironment is starting.")}, want: true},
+		{name: "other events", version: "v1", events: []string{event("Added instance [i-0123] to your environment.")}},
+		{name: "update completed", version: "v1", events: []string{event("Environment update completed successfully."), event("Environment update is starting.")}},
+		{name: "update failed", version: "v1", events: []string{event("Failed to deploy application."), event("Environment update is starting.")}},
+		{name: "completed but still updating", version: "v1", status: "Updating", events: []string{event("Environment update completed successfully."), event("Environment update is starting.")}, want: true},
+		{name: "started again", version: "v1", events: []string{event("Environment update is starting."), event("Environment update completed successfully."), event("Environment update is starting.")}, want: true},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		if test.status == "" {
+			test.status = "Ready"
+		}
+
+		sess := querySession(t, func(action string, form url.Values) (string, error) {
+			switch action {
+			case "DescribeEvents":
+				return "<Events>" + strings.Join(test.events, "") + "</Events>", nil
+			case "GetCallerIdentity":
+				return "<Account>123456789012</Account>", nil
+			case "ListTagsForResource":
+				return "<ResourceTags>" + test.tags + "</ResourceTags>", nil
+			}
+
+			return "", errors.New("unexpected " + action)
+		})
+
+		p := &Plugin{
+			Region:            "us-east-1",
+			Application:       "app",
+			VersionLabel:      "v2",
+			ConcurrencyWindow: 10 * time.Minute,
+			Repo:              Repo{FullName: "org/app"},
+			Build:             Build{Number: 42},
+			sess:              sess,
+			identity:          &callerIdentity{},
+		}
+
+		env := &elasticbeanstalk.EnvironmentDescription{
+			EnvironmentName: aws.String("app-prod"),
+			VersionLabel:    aws.String(test.version),
+			Status:          aws.String(test.status),
+		}
+
+		got, err := p.recentDeploy(elasticbeanstalk.New(sess), env)
+
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		if (got != nil) != test.want {
+			t.Errorf("%s: got %v, want a deploy %v", test.name, got, test.want)
+		}
+
+		if got != nil && !got.Equal(started) {
+			t.Errorf("%s: got start %s, want %s", test.name, got, started)
+		}
+	}
+}
+
+func TestCheckConcurrent(t *testing.T) {
+	started := time.Now().UTC().Add(-time.Minute).Format(time.RFC3339)
+
+	tests := []struct {
+		name    string
+		wait    bool
+		timeout time.Duration
+		polls   int
+		err     error
+	}{
+		{name: "in flight", err: errConcurrentDeploy},
+		{name: "waited for", wait: true, timeout: time.Minute, polls: 2},
+		{name: "budget spent", wait: true, timeout: 50 * time.Millisecond, err: errConcurrentDeploy},
+	}
+
+	for _, test := range tests {
+		test := test
+		polls := 0
+
+		sess := querySession(t, func(action string, form url.Values) (string, error) {
+			// the other deploy completes after the configured number of
+			// polls, or never
+			done := test.polls > 0 && polls >= test.polls
+
+			switch action {
+			case "DescribeEnvironments":
+				polls++
+
+				status := "Updating"
+
+				if done {
+					status = "Ready"
+				}
+
+				return "<Environments><member><EnvironmentName>app-prod</EnvironmentName><VersionLabel>v1</VersionLabel><Status>" + status + "</Status></member></Environments>", nil
+			case "DescribeEvents":
+				events := fmt.Sprintf("<member><EventDate>%s</EventDate><Message>Environment update is starting.</Message></member>", started)
+
+				if done {
+					events = fmt.Sprintf("<member><EventDate>%s</EventDate><Message>Environment update completed successfully.</Message></member>", started) + events
+				}
+
+				return "<Events>" + events + "</Events>", nil
+			case "GetCallerIdentity":
+				return "<Account>123456789012</Account>", nil
+			case "ListTagsForResource":
+				return "<ResourceTags/>", nil
+			}
+
+			return "", errors.New("unexpected " + action)
+		})
+
+		p := &Plugin{
+			Region:            "us-east-1",
+			Application:       "app",
+			VersionLabel:      "v2",
+			ConcurrencyWindow: 10 * time.Minute,
+			WaitForConcurrent: test.wait,
+			sess:              sess,
+			identity:          &callerIdentity{},
+		}
+
+		budget := newWaitBudget(test.timeout, Polling{Interval: time.Millisecond})
+		err := p.checkConcurrent(elasticbeanstalk.New(sess), log.WithField("test", test.name), "app-prod", budget)
+
+		if err != test.err {
+			t.Errorf("%s: got %v, want %v", test.name, err, test.err)
+		}
+	}
+}
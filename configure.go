@@ -0,0 +1,42 @@
+package main
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/service/elasticbeanstalk"
+)
+
+// actionConfigure updates the environments without a new version.
+const actionConfigure = "configure"
+
+// configuring reports whether the environments keep the version they run.
+func (p *Plugin) configuring() bool {
+	return p.Action == actionConfigure
+}
+
+// configure applies the option settings, tags, platform and description to
+// the environments, waiting for the update like a deploy but keeping the
+// version they run. Updates are always applied in place.
+func (p *Plugin) configure(client *elasticbeanstalk.ElasticBeanstalk) error {
+	log.WithFields(log.Fields{
+		"application":    p.Application,
+		"environment":    p.environments(),
+		"solution-stack": p.Creation.SolutionStack,
+		"platform-arn":   p.Creation.PlatformARN,
+	}).Info("Configuring environments")
+
+	p.Strategy = strategyInPlace
+
+	if p.Template.File != "" {
+		if err := p.saveTemplate(client); err != nil {
+			p.runFailureHooks("", err)
+			return err
+		}
+	}
+
+	results := p.rollOut(client)
+	p.results = results
+
+	printReport(p.ReportFormat, results)
+
+	return resultsError(results)
+}
@@ -0,0 +1,35 @@
+package main
+
+import "testing"
+
+func TestConfigureKeepsVersion(t *testing.T) {
+	f := newFakeAWS(t, "app-web")
+	p := f.plugin()
+	p.Action = actionConfigure
+	p.EnvironmentName = "app-web"
+	p.Creation.SolutionStack = "64bit Amazon Linux 2023 running Docker"
+
+	if err := p.Exec(); err != nil {
+		t.Fatal(err)
+	}
+
+	update := f.last("UpdateEnvironment")
+
+	if update == nil {
+		t.Fatal("environment was not updated")
+	}
+
+	if label := update.Get("VersionLabel"); label != "" {
+		t.Errorf("update deploys version %s", label)
+	}
+
+	env := f.environment("app-web")
+
+	if env.version != "v1" || env.solution != p.Creation.SolutionStack {
+		t.Errorf("environment runs %s on %s", env.version, env.solution)
+	}
+
+	if len(p.results) != 1 || p.results[0].Version != "v1" {
+		t.Errorf("results %+v", p.results)
+	}
+}
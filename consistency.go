@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+var errInconsistentVersion = errors.New("instances kept serving another version")
+
+// noReuseClient opens a new connection per request, so the load balancer
+// spreads the samples across the instances.
+var noReuseClient = &http.Client{
+	Timeout:   httpClient.Timeout,
+	Transport: &http.Transport{DisableKeepAlives: true, Proxy: http.ProxyFromEnvironment},
+}
+
+// VersionCheck samples a version endpoint until every response reports the
+// deployed version, catching instances stuck on old code.
+type VersionCheck struct {
+	Path     string
+	JSONPath string
+	Samples  int
+	Timeout  time.Duration
+}
+
+// sample requests the endpoint once and returns the version it reports.
+func (v *VersionCheck) sample(url, version string) (string, error) {
+	resp, err := noReuseClient.Get(url)
+
+	if err != nil {
+		return "", err
+	}
+
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+
+	if err != nil {
+		return "", err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+
+	if v.JSONPath == "" {
+		if strings.Contains(string(body), version) {
+			return version, nil
+		}
+
+		return strings.TrimSpace(string(body)), nil
+	}
+
+	var doc interface{}
+
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return "", fmt.Errorf("%s returned invalid JSON: %s", url, err)
+	}
+
+	got, ok := jsonPath(doc, v.JSONPath)
+
+	if !ok {
+		return "", fmt.Errorf("%s returned no %s", url, v.JSONPath)
+	}
+
+	return fmt.Sprint(got), nil
+}
+
+// wait samples the endpoint in rounds until a whole round reports the
+// version or the timeout passes.
+func (v *VersionCheck) wait(envLog *log.Entry, baseURL, version string) error {
+	url := strings.TrimRight(baseURL, "/") + "/" + strings.TrimLeft(v.Path, "/")
+	fields := envLog.WithFields(log.Fields{
+		"url":          url,
+		"versionlabel": version,
+	})
+
+	tick := time.NewTicker(checkInterval)
+	defer tick.Stop()
+
+	tout := time.After(v.Timeout)
+
+	for {
+		stale := map[string]int{}
+
+		for i := 0; i < v.Samples; i++ {
+			got, err := v.sample(url, version)
+
+			if err != nil {
+				got = err.Error()
+			}
+
+			if got != version {
+				stale[got]++
+			}
+		}
+
+		if len(stale) == 0 {
+			fields.WithField("samples", v.Samples).Info("Every instance serves the new version")
+			return nil
+		}
+
+		fields.WithField("stale", stale).Info("Some instances still serve another version")
+
+		select {
+		case <-tout:
+			fields.WithError(errInconsistentVersion).Error("Instances kept serving another version")
+			return errInconsistentVersion
+		case <-tick.C:
+		}
+	}
+}
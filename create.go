@@ -0,0 +1,210 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elasticbeanstalk"
+)
+
+const (
+	tierWebServer = "WebServer"
+	tierWorker    = "Worker"
+)
+
+// EnvironmentCreation defines how missing environments are created.
+type EnvironmentCreation struct {
+	SolutionStack string
+	PlatformARN   string
+	Tier          string
+	CNAMEPrefix   string
+	KeyPair       string
+	ServiceRole   string
+
+	// Schedule scales created environments down on a schedule.
+	Schedule ScaleSchedule
+}
+
+// tier returns the environment tier, web servers by default.
+func (c *EnvironmentCreation) tier() (*elasticbeanstalk.EnvironmentTier, error) {
+	switch c.Tier {
+	case "", tierWebServer:
+		return &elasticbeanstalk.EnvironmentTier{Name: aws.String(tierWebServer), Type: aws.String("Standard")}, nil
+	case tierWorker:
+		return &elasticbeanstalk.EnvironmentTier{Name: aws.String(tierWorker), Type: aws.String("SQS/HTTP")}, nil
+	}
+
+	return nil, fmt.Errorf("unknown environment tier %s", c.Tier)
+}
+
+// optionSettings translates the creation settings to option settings.
+func (c *EnvironmentCreation) optionSettings() []*elasticbeanstalk.ConfigurationOptionSetting {
+	var settings []*elasticbeanstalk.ConfigurationOptionSetting
+
+	if c.KeyPair != "" {
+		settings = append(settings, optionSetting(launchConfigurationNamespace, "EC2KeyName", c.KeyPair))
+	}
+
+	if c.ServiceRole != "" {
+		settings = append(settings, optionSetting("aws:elasticbeanstalk:environment", "ServiceRole", c.ServiceRole))
+	}
+
+	return append(settings, c.Schedule.optionSettings()...)
+}
+
+// findEnvironment returns the live environment with the name, or nil when
+// there is none.
+func findEnvironment(client *elasticbeanstalk.ElasticBeanstalk, application, environment string) (*elasticbeanstalk.EnvironmentDescription, error) {
+	envs, err := client.DescribeEnvironments(
+		&elasticbeanstalk.DescribeEnvironmentsInput{
+			ApplicationName:  aws.String(application),
+			EnvironmentNames: aws.StringSlice([]string{environment}),
+			IncludeDeleted:   aws.Bool(false),
+		},
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(envs.Environments) == 0 {
+		return nil, nil
+	}
+
+	return envs.Environments[0], nil
+}
+
+// deletedLookback is how far back terminated environments are looked up,
+// Beanstalk only keeps them around for a while anyway.
+const deletedLookback = 24 * time.Hour
+
+// terminatedEnvironment returns the most recently terminated environment
+// with the name, or nil when there is none.
+func terminatedEnvironment(client *elasticbeanstalk.ElasticBeanstalk, application, environment string) (*elasticbeanstalk.EnvironmentDescription, error) {
+	envs, err := client.DescribeEnvironments(
+		&elasticbeanstalk.DescribeEnvironmentsInput{
+			ApplicationName:       aws.String(application),
+			EnvironmentNames:      aws.StringSlice([]string{environment}),
+			IncludeDeleted:        aws.Bool(true),
+			IncludedDeletedBackTo: aws.Time(time.Now().Add(-deletedLookback)),
+		},
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var latest *elasticbeanstalk.EnvironmentDescription
+
+	for _, env := range envs.Environments {
+		if aws.StringValue(env.Status) != elasticbeanstalk.EnvironmentStatusTerminated {
+			continue
+		}
+
+		if latest == nil || aws.TimeValue(env.DateUpdated).After(aws.TimeValue(latest.DateUpdated)) {
+			latest = env
+		}
+	}
+
+	return latest, nil
+}
+
+// missingEnvironment explains why the environment was not found, naming
+// when it was terminated if it was recently.
+func missingEnvironment(client *elasticbeanstalk.ElasticBeanstalk, application, environment string) error {
+	env, err := terminatedEnvironment(client, application, environment)
+
+	if err != nil || env == nil {
+		return fmt.Errorf("environment %s not found", environment)
+	}
+
+	return fmt.Errorf(
+		"environment %s was terminated at %s",
+		environment,
+		aws.TimeValue(env.DateUpdated).UTC().Format(time.RFC3339),
+	)
+}
+
+// createEnvironment creates the environment running the version label when
+// it does not exist yet and waits for it to be ready. It reports whether the
+// environment was created, in which case no update is needed.
+func (p *Plugin) createEnvironment(client *elasticbeanstalk.ElasticBeanstalk, envLog *log.Entry, environment string, result *envResult) (bool, error) {
+	existing, err := findEnvironment(client, p.Application, environment)
+
+	if err != nil {
+		envLog.WithError(err).Error("Problem retrieving environment information")
+		return false, err
+	}
+
+	if existing != nil {
+		return false, nil
+	}
+
+	result.begin("create")
+
+	appFields := envLog.WithFields(log.Fields{
+		"application":    p.Application,
+		"versionlabel":   p.VersionLabel,
+		"solution-stack": p.Creation.SolutionStack,
+		"platform-arn":   p.Creation.PlatformARN,
+		"tier":           p.Creation.Tier,
+		"cname-prefix":   p.Creation.CNAMEPrefix,
+		"template":       p.Template.Name,
+	})
+
+	appFields.Info("Environment does not exist, creating it")
+
+	tier, err := p.Creation.tier()
+
+	if err != nil {
+		appFields.WithError(err).Error("Problem creating environment")
+		return false, err
+	}
+
+	input := &elasticbeanstalk.CreateEnvironmentInput{
+		ApplicationName: aws.String(p.Application),
+		EnvironmentName: aws.String(environment),
+		VersionLabel:    aws.String(p.VersionLabel),
+		Description:     aws.String(p.Description),
+		Tier:            tier,
+		OptionSettings:  append(p.Creation.optionSettings(), p.OptionSettings...),
+		Tags:            p.deployTags(),
+	}
+
+	// a template brings its own platform
+	switch {
+	case p.Template.Name != "":
+		input.TemplateName = aws.String(p.Template.Name)
+	case p.Creation.PlatformARN != "":
+		input.PlatformArn = aws.String(p.Creation.PlatformARN)
+	case p.Creation.SolutionStack != "":
+		input.SolutionStackName = aws.String(p.Creation.SolutionStack)
+	}
+
+	if p.Creation.CNAMEPrefix != "" && aws.StringValue(tier.Name) == tierWebServer {
+		input.CNAMEPrefix = aws.String(p.Creation.CNAMEPrefix)
+	}
+
+	if _, err := client.CreateEnvironment(input); err != nil {
+		appFields.WithError(err).Error("Problem creating environment")
+		return false, err
+	}
+
+	env, err := waitEnvironmentToBeReady(client, envLog, p.Application, environment, newWaitBudget(p.Timeout, p.Polling))
+
+	if err != nil {
+		return false, err
+	}
+
+	if aws.StringValue(env.VersionLabel) != p.VersionLabel {
+		err := errNotFinished
+		appFields.WithError(err).Error("Environment creation failed, please check EB environment logs")
+		return false, err
+	}
+
+	appFields.Info("Environment created successfully")
+
+	return true, nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+var errDNSNotPropagated = errors.New("dns never pointed at the environment")
+
+// dnsInterval is how often the resolvers are queried again.
+const dnsInterval = 10 * time.Second
+
+// DNSCheck waits until the public name resolves to the environment on every
+// resolver, so a finished deploy means traffic actually reaches it.
+type DNSCheck struct {
+	Enabled   bool
+	Name      string
+	Resolvers []string
+	Timeout   time.Duration
+}
+
+// resolver queries a single name server, the system one when empty.
+func resolver(server string) *net.Resolver {
+	if server == "" {
+		return net.DefaultResolver
+	}
+
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "53")
+	}
+
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, server)
+		},
+	}
+}
+
+// pointsAt reports whether the name resolves to the endpoint, either through
+// its CNAME chain or by sharing addresses with it.
+func pointsAt(r *net.Resolver, name, endpoint string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dnsInterval)
+	defer cancel()
+
+	cname, err := r.LookupCNAME(ctx, name)
+
+	if err != nil {
+		return false, err
+	}
+
+	if sameHost(cname, endpoint) {
+		return true, nil
+	}
+
+	addrs, err := r.LookupHost(ctx, name)
+
+	if err != nil {
+		return false, err
+	}
+
+	targets := []string{endpoint}
+
+	if net.ParseIP(endpoint) == nil {
+		if targets, err = r.LookupHost(ctx, endpoint); err != nil {
+			return false, err
+		}
+	}
+
+	for _, addr := range addrs {
+		for _, target := range targets {
+			if addr == target {
+				return true, nil
+			}
+		}
+	}
+
+	return false, nil
+}
+
+func sameHost(a, b string) bool {
+	return strings.EqualFold(strings.TrimSuffix(a, "."), strings.TrimSuffix(b, "."))
+}
+
+// wait polls every resolver until all of them resolve the name to the
+// endpoint or the timeout passes.
+func (d *DNSCheck) wait(envLog *log.Entry, name, endpoint string) error {
+	resolvers := d.Resolvers
+
+	if len(resolvers) == 0 {
+		resolvers = []string{""}
+	}
+
+	fields := envLog.WithFields(log.Fields{
+		"name":     name,
+		"endpoint": endpoint,
+	})
+
+	fields.Info("Waiting for DNS to point at the environment")
+
+	tick := time.NewTicker(dnsInterval)
+	defer tick.Stop()
+
+	tout := time.After(d.Timeout)
+
+	for {
+		pending := 0
+
+		for _, server := range resolvers {
+			ok, err := pointsAt(resolver(server), name, endpoint)
+
+			if err != nil {
+				fields.WithError(err).WithField("resolver", server).Debug("Problem resolving name")
+			}
+
+			if !ok {
+				pending++
+			}
+		}
+
+		if pending == 0 {
+			fields.Info("DNS points at the environment")
+			return nil
+		}
+
+		fields.WithField("pending", pending).Info("DNS has not propagated to every resolver yet")
+
+		select {
+		case <-tout:
+			fields.WithError(errDNSNotPropagated).Error("DNS never pointed at the environment")
+			return errDNSNotPropagated
+		case <-tick.C:
+		}
+	}
+}
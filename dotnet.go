@@ -0,0 +1,134 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	// windowsManifest tells the Windows Server platforms how to deploy the
+	// site archives of the bundle.
+	windowsManifest = "aws-windows-deployment-manifest.json"
+
+	dotNetCore     = "aspNetCoreWeb"
+	dotNetMSDeploy = "msDeploy"
+
+	defaultWebSite = "Default Web Site"
+)
+
+// DotNet packages published sites for the .NET on Windows Server platforms.
+type DotNet struct {
+	// Sites are iisPath=path pairs of published site directories or
+	// archives, a plain path is deployed to the root.
+	Sites []string
+
+	// Deployment is aspNetCoreWeb for .NET Core sites or msDeploy for
+	// .NET Framework Web Deploy archives.
+	Deployment string
+	WebSite    string
+}
+
+// windowsDeployment is a single site of the deployment manifest.
+type windowsDeployment struct {
+	Name       string            `json:"name"`
+	Parameters map[string]string `json:"parameters"`
+}
+
+// addDotNet packages every site as its own archive and writes the manifest
+// deploying them to their IIS paths.
+func addDotNet(b *zipBundle, d DotNet) error {
+	var deployments []windowsDeployment
+
+	seen := map[string]bool{}
+
+	for _, entry := range d.Sites {
+		iisPath, path := "/", entry
+
+		if i := strings.Index(entry, "="); i >= 0 {
+			iisPath, path = entry[:i], entry[i+1:]
+		}
+
+		name := siteName(iisPath)
+
+		if seen[name] {
+			return fmt.Errorf("more than one site for the %s path", iisPath)
+		}
+
+		seen[name] = true
+
+		if err := addSiteArchive(b, name+".zip", path); err != nil {
+			return err
+		}
+
+		deployments = append(deployments, windowsDeployment{
+			Name: name,
+			Parameters: map[string]string{
+				"appBundle":  name + ".zip",
+				"iisPath":    iisPath,
+				"iisWebSite": d.WebSite,
+			},
+		})
+	}
+
+	manifest, err := json.MarshalIndent(map[string]interface{}{
+		"manifestVersion": 1,
+		"deployments": map[string][]windowsDeployment{
+			d.Deployment: deployments,
+		},
+	}, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	w, err := b.zw.Create(windowsManifest)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(manifest)
+	return err
+}
+
+// siteName returns the archive and deployment name of the IIS path.
+func siteName(iisPath string) string {
+	iisPath = strings.Trim(iisPath, "/")
+
+	if iisPath == "" {
+		return "site"
+	}
+
+	return strings.Replace(iisPath, "/", "-", -1)
+}
+
+// addSiteArchive adds a site archive, zipping a publish directory on the
+// fly and copying an existing archive as is.
+func addSiteArchive(b *zipBundle, name, path string) error {
+	info, err := os.Stat(path)
+
+	if err != nil {
+		return err
+	}
+
+	if !info.IsDir() {
+		return b.addFile(name, path)
+	}
+
+	w, err := b.zw.Create(name)
+
+	if err != nil {
+		return err
+	}
+
+	site := &zipBundle{zw: zip.NewWriter(w)}
+
+	if err := addDirectory(site, path, SourceFilter{}); err != nil {
+		return err
+	}
+
+	return site.zw.Close()
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elasticbeanstalk"
+)
+
+// describeEndpoint records where the deployed environment is reached, as
+// it stands once the deploy is over.
+func (p *Plugin) describeEndpoint(client *elasticbeanstalk.ElasticBeanstalk, envLog *log.Entry, environment string, result *envResult) {
+	envs, err := client.DescribeEnvironments(
+		&elasticbeanstalk.DescribeEnvironmentsInput{
+			ApplicationName:  aws.String(p.Application),
+			EnvironmentNames: aws.StringSlice([]string{environment}),
+			IncludeDeleted:   aws.Bool(false),
+		},
+	)
+
+	if err != nil || len(envs.Environments) == 0 {
+		envLog.WithError(err).Warn("Problem retrieving the environment endpoint")
+		return
+	}
+
+	env := envs.Environments[0]
+
+	result.EnvironmentID = aws.StringValue(env.EnvironmentId)
+	result.CNAME = aws.StringValue(env.CNAME)
+	result.EndpointURL = aws.StringValue(env.EndpointURL)
+
+	envLog.WithFields(log.Fields{
+		"environment-id": result.EnvironmentID,
+		"cname":          result.CNAME,
+		"endpoint-url":   result.EndpointURL,
+	}).Info("Environment endpoint")
+}
+
+// url is the address the deployed application answers on.
+func (r *envResult) url() string {
+	if r.CNAME == "" {
+		return ""
+	}
+
+	return "http://" + r.CNAME
+}
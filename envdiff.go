@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elasticbeanstalk"
+)
+
+const (
+	environmentNamespace = "aws:elasticbeanstalk:application:environment"
+
+	// maskedValue replaces the values of variables not in the visible list.
+	maskedValue = "******"
+)
+
+// envVarChange describes how a single environment variable changes.
+type envVarChange struct {
+	Change string
+	Name   string
+	From   string
+	To     string
+}
+
+// envVarDiff lists the added, changed and removed environment variables.
+// Values are masked unless the name matches one of the visible patterns.
+func envVarDiff(current, desired []*elasticbeanstalk.ConfigurationOptionSetting, removed []string, visible []string) []envVarChange {
+	values := map[string]string{}
+
+	for _, s := range current {
+		if aws.StringValue(s.Namespace) == environmentNamespace {
+			values[aws.StringValue(s.OptionName)] = aws.StringValue(s.Value)
+		}
+	}
+
+	mask := func(name, value string) string {
+		for _, pattern := range visible {
+			if ok, _ := path.Match(pattern, name); ok {
+				return value
+			}
+		}
+
+		return maskedValue
+	}
+
+	var changes []envVarChange
+
+	for _, s := range desired {
+		if aws.StringValue(s.Namespace) != environmentNamespace {
+			continue
+		}
+
+		name := aws.StringValue(s.OptionName)
+		to := aws.StringValue(s.Value)
+		from, exists := values[name]
+
+		switch {
+		case !exists:
+			changes = append(changes, envVarChange{Change: "added", Name: name, To: mask(name, to)})
+		case from != to:
+			changes = append(changes, envVarChange{Change: "changed", Name: name, From: mask(name, from), To: mask(name, to)})
+		}
+	}
+
+	for _, name := range removed {
+		if from, exists := values[name]; exists {
+			changes = append(changes, envVarChange{Change: "removed", Name: name, From: mask(name, from)})
+		}
+	}
+
+	return changes
+}
+
+// parsePairs reads a map setting such as env-vars or tags, either a JSON
+// object, as Drone hands YAML maps over, or comma or newline separated
+// KEY=value pairs. The kind of pair names it in errors.
+func parsePairs(setting, kind string) (map[string]string, error) {
+	vars := map[string]string{}
+	setting = strings.TrimSpace(setting)
+
+	if setting == "" {
+		return vars, nil
+	}
+
+	if strings.HasPrefix(setting, "{") {
+		doc := map[string]interface{}{}
+
+		if err := json.Unmarshal([]byte(setting), &doc); err != nil {
+			return nil, err
+		}
+
+		for name, value := range doc {
+			if value == nil {
+				vars[name] = ""
+			} else {
+				vars[name] = fmt.Sprint(value)
+			}
+		}
+
+		return vars, nil
+	}
+
+	for _, pair := range strings.FieldsFunc(setting, func(r rune) bool { return r == ',' || r == '\n' }) {
+		pair = strings.TrimSpace(pair)
+
+		if pair == "" {
+			continue
+		}
+
+		i := strings.Index(pair, "=")
+
+		if i <= 0 {
+			return nil, fmt.Errorf("%s %q is not KEY=value", kind, pair)
+		}
+
+		vars[pair[:i]] = pair[i+1:]
+	}
+
+	return vars, nil
+}
+
+// envVarSettings returns the option settings setting the variables, sorted
+// by name.
+func envVarSettings(vars map[string]string) []*elasticbeanstalk.ConfigurationOptionSetting {
+	var names []string
+
+	for name := range vars {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	var settings []*elasticbeanstalk.ConfigurationOptionSetting
+
+	for _, name := range names {
+		settings = append(settings, optionSetting(environmentNamespace, name, vars[name]))
+	}
+
+	return settings
+}
+
+// removedEnvVars returns the option specifications removing the variables.
+func removedEnvVars(names []string) []*elasticbeanstalk.OptionSpecification {
+	var specs []*elasticbeanstalk.OptionSpecification
+
+	for _, name := range names {
+		specs = append(specs, &elasticbeanstalk.OptionSpecification{
+			Namespace:  aws.String(environmentNamespace),
+			OptionName: aws.String(name),
+		})
+	}
+
+	return specs
+}
+
+// reportEnvVars logs the masked environment variable diff of the update.
+// Problems are only logged, the report never fails the deploy.
+func (p *Plugin) reportEnvVars(client *elasticbeanstalk.ElasticBeanstalk, envLog *log.Entry, environment string, settings []*elasticbeanstalk.ConfigurationOptionSetting, removed []string) {
+	touches := len(removed) > 0
+
+	for _, s := range settings {
+		touches = touches || aws.StringValue(s.Namespace) == environmentNamespace
+	}
+
+	if !touches {
+		return
+	}
+
+	current, err := currentOptionSettings(client, p.Application, environment)
+
+	if err != nil {
+		envLog.WithError(err).Warning("Problem retrieving the environment variables")
+		return
+	}
+
+	changes := envVarDiff(current, settings, removed, p.VisibleEnvVars)
+
+	if len(changes) == 0 {
+		envLog.Info("Environment variables are unchanged")
+		return
+	}
+
+	for _, c := range changes {
+		fields := log.Fields{"variable": c.Name}
+
+		if c.Change != "added" {
+			fields["from"] = c.From
+		}
+
+		if c.Change != "removed" {
+			fields["to"] = c.To
+		}
+
+		envLog.WithFields(fields).Info("Environment variable " + c.Change)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elasticbeanstalk"
+)
+
+func TestEnvVarDiff(t *testing.T) {
+	env := func(pairs ...string) []*elasticbeanstalk.ConfigurationOptionSetting {
+		var settings []*elasticbeanstalk.ConfigurationOptionSetting
+
+		for i := 0; i < len(pairs); i += 2 {
+			settings = append(settings, &elasticbeanstalk.ConfigurationOptionSetting{
+				Namespace:  aws.String(environmentNamespace),
+				OptionName: aws.String(pairs[i]),
+				Value:      aws.String(pairs[i+1]),
+			})
+		}
+
+		return settings
+	}
+
+	other := &elasticbeanstalk.ConfigurationOptionSetting{
+		Namespace:  aws.String("aws:autoscaling:asg"),
+		OptionName: aws.String("MinSize"),
+		Value:      aws.String("2"),
+	}
+
+	tests := []struct {
+		name    string
+		current []*elasticbeanstalk.ConfigurationOptionSetting
+		desired []*elasticbeanstalk.ConfigurationOptionSetting
+		removed []string
+		visible []string
+		want    []envVarChange
+	}{
+		{
+			name:    "unchanged",
+			current: env("PORT", "8080"),
+			desired: env("PORT", "8080"),
+		},
+		{
+			name:    "added and changed are masked",
+			current: env("API_KEY", "old"),
+			desired: env("API_KEY", "new", "DB_PASSWORD", "secret"),
+			want: []envVarChange{
+				{Change: "changed", Name: "API_KEY", From: maskedValue, To: maskedValue},
+				{Change: "added", Name: "DB_PASSWORD", To: maskedValue},
+			},
+		},
+		{
+			name:    "visible patterns show values",
+			current: env("LOG_LEVEL", "info", "API_KEY", "old"),
+			desired: env("LOG_LEVEL", "debug", "API_KEY", "new"),
+			visible: []string{"LOG_*"},
+			want: []envVarChange{
+				{Change: "changed", Name: "LOG_LEVEL", From: "info", To: "debug"},
+				{Change: "changed", Name: "API_KEY", From: maskedValue, To: maskedValue},
+			},
+		},
+		{
+			name:    "removed only when set",
+			current: env("LEGACY", "1"),
+			removed: []string{"LEGACY", "MISSING"},
+			visible: []string{"LEGACY"},
+			want: []envVarChange{
+				{Change: "removed", Name: "LEGACY", From: "1"},
+			},
+		},
+		{
+			name:    "other namespaces are left out",
+			desired: []*elasticbeanstalk.ConfigurationOptionSetting{other},
+		},
+	}
+
+	for _, test := range tests {
+		got := envVarDiff(test.current, test.desired, test.removed, test.visible)
+
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
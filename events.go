@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elasticbeanstalk"
+)
+
+// eventCursor pages through the events of an environment, so every event
+// is seen exactly once even when several happen between two polls.
+type eventCursor struct {
+	application string
+	environment string
+
+	// versionLabel scopes a cursor without environment to the application
+	// events of the version, such as its processing.
+	versionLabel string
+
+	since time.Time
+	seen  map[string]bool
+}
+
+func newEventCursor(application, environment string, since time.Time) *eventCursor {
+	return &eventCursor{
+		application: application,
+		environment: environment,
+		since:       since,
+		seen:        map[string]bool{},
+	}
+}
+
+// newVersionEventCursor follows the application events of a version, the
+// ones of its environments are left to their own cursors.
+func newVersionEventCursor(application, label string, since time.Time) *eventCursor {
+	return &eventCursor{
+		application:  application,
+		versionLabel: label,
+		since:        since,
+		seen:         map[string]bool{},
+	}
+}
+
+// next returns the events since the last call, oldest first. Events sharing
+// the timestamp of the cursor are told apart by their message.
+func (c *eventCursor) next(client *elasticbeanstalk.ElasticBeanstalk) ([]*elasticbeanstalk.EventDescription, error) {
+	in := &elasticbeanstalk.DescribeEventsInput{
+		ApplicationName: aws.String(c.application),
+		StartTime:       aws.Time(c.since),
+	}
+
+	if c.environment != "" {
+		in.EnvironmentName = aws.String(c.environment)
+	} else {
+		in.VersionLabel = aws.String(c.versionLabel)
+	}
+
+	out, err := client.DescribeEvents(in)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var events []*elasticbeanstalk.EventDescription
+
+	for i := len(out.Events) - 1; i >= 0; i-- {
+		event := out.Events[i]
+		date := aws.TimeValue(event.EventDate)
+		key := fmt.Sprintf("%d %s", date.UnixNano(), aws.StringValue(event.Message))
+
+		if date.Before(c.since) || c.seen[key] {
+			continue
+		}
+
+		if c.environment == "" && aws.StringValue(event.EnvironmentName) != "" {
+			continue
+		}
+
+		if date.After(c.since) {
+			c.since = date
+			c.seen = map[string]bool{}
+		}
+
+		c.seen[key] = true
+		events = append(events, event)
+	}
+
+	return events, nil
+}
+
+// logEvent mirrors a Beanstalk event in the build log at the level of its
+// severity.
+func logEvent(envLog *log.Entry, event *elasticbeanstalk.EventDescription) {
+	severity := aws.StringValue(event.Severity)
+	message := aws.StringValue(event.Message)
+
+	entry := envLog.WithFields(log.Fields{
+		"severity": severity,
+		"date":     aws.TimeValue(event.EventDate).Format(time.RFC3339),
+	})
+
+	switch {
+	case isErrorSeverity(severity):
+		entry.Error(message)
+	case severity == elasticbeanstalk.EventSeverityWarn:
+		entry.Warning(message)
+	default:
+		entry.Info(message)
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+// failureClass tells whether retrying a failed deploy can possibly help.
+type failureClass string
+
+const (
+	failureTransient failureClass = "transient"
+	failurePermanent failureClass = "permanent"
+)
+
+// Exit codes used by main, so pipelines can decide whether to auto-retry.
+const (
+	exitPermanent = 1
+	exitTransient = 75
+)
+
+var (
+	errTimedOut    = errors.New("timed out")
+	errNotUpdating = errors.New("environment is not updating")
+	errNotFinished = errors.New("update did not finish")
+	errStalled     = errors.New("update stalled")
+
+	errEventFailure   = errors.New("environment reported an error event")
+	errVersionFailure = errors.New("application version reported an error event")
+)
+
+// transientCodes are AWS error codes caused by throttling, timeouts or an
+// environment that is temporarily in the wrong state.
+var transientCodes = map[string]bool{
+	"RequestError":                     true,
+	"RequestTimeout":                   true,
+	"RequestTimeoutException":          true,
+	"Throttling":                       true,
+	"ThrottlingException":              true,
+	"RequestLimitExceeded":             true,
+	"RequestThrottled":                 true,
+	"TooManyRequestsException":         true,
+	"ServiceUnavailable":               true,
+	"InternalFailure":                  true,
+	"OperationInProgressFailure":       true,
+	"ElasticBeanstalkServiceException": true,
+}
+
+// failure is an error that already carries its failure class.
+type failure struct {
+	err   error
+	class failureClass
+}
+
+func (f *failure) Error() string {
+	return f.err.Error()
+}
+
+// classifyError decides whether an error is worth retrying. Anything not
+// known to be transient, such as access denied or validation errors, is
+// treated as permanent.
+func classifyError(err error) failureClass {
+	switch e := err.(type) {
+	case *failure:
+		return e.class
+	case awserr.RequestFailure:
+		if e.StatusCode() >= 500 || transientCodes[e.Code()] {
+			return failureTransient
+		}
+
+		return classifyMessage(e.Message())
+	case awserr.Error:
+		if transientCodes[e.Code()] {
+			return failureTransient
+		}
+
+		if e.OrigErr() != nil && e.OrigErr() != err {
+			return classifyError(e.OrigErr())
+		}
+
+		return classifyMessage(e.Message())
+	case net.Error:
+		if e.Timeout() {
+			return failureTransient
+		}
+	}
+
+	switch err {
+	case errTimedOut, errNotUpdating:
+		return failureTransient
+	}
+
+	return failurePermanent
+}
+
+// classifyMessage catches invalid state errors, which Beanstalk reports with
+// the generic InvalidParameterValue code.
+func classifyMessage(msg string) failureClass {
+	if strings.Contains(strings.ToLower(msg), "invalid state") {
+		return failureTransient
+	}
+
+	return failurePermanent
+}
+
+// exitCode maps an error to the process exit code.
+func exitCode(err error) int {
+	if classifyError(err) == failureTransient {
+		return exitTransient
+	}
+
+	return exitPermanent
+}
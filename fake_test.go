@@ -0,0 +1,215 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeEnvironment is an environment of the fake, updates complete at once.
+type fakeEnvironment struct {
+	version  string
+	status   string
+	health   string
+	solution string
+}
+
+// fakeAWS answers the query protocol calls of the plugin. Environments
+// listed in failing fail their updates with an error event.
+type fakeAWS struct {
+	mu           sync.Mutex
+	calls        []url.Values
+	environments map[string]*fakeEnvironment
+	failing      map[string]bool
+	events       []string
+
+	server *httptest.Server
+}
+
+func newFakeAWS(t *testing.T, environments ...string) *fakeAWS {
+	f := &fakeAWS{
+		environments: map[string]*fakeEnvironment{},
+		failing:      map[string]bool{},
+	}
+
+	for _, name := range environments {
+		f.environments[name] = &fakeEnvironment{
+			version:  "v1",
+			status:   "Ready",
+			health:   "Green",
+			solution: "64bit Amazon Linux 2 running Docker",
+		}
+	}
+
+	f.server = httptest.NewServer(http.HandlerFunc(f.handle))
+	t.Cleanup(f.server.Close)
+
+	return f
+}
+
+// plugin returns a plugin deploying the application through the fake.
+func (f *fakeAWS) plugin() *Plugin {
+	return &Plugin{
+		Key:               "key",
+		Secret:            "secret",
+		Region:            "us-east-1",
+		Application:       "app",
+		VersionLabel:      "v2",
+		EnvironmentUpdate: true,
+		Timeout:           time.Minute,
+		ReportFormat:      "table",
+		Action:            actionDeploy,
+		Approval:          &Approval{},
+		Polling:           Polling{Interval: time.Millisecond},
+		endpoint:          f.server.URL,
+	}
+}
+
+// count returns how many times the action was called.
+func (f *fakeAWS) count(action string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	n := 0
+
+	for _, call := range f.calls {
+		if call.Get("Action") == action {
+			n++
+		}
+	}
+
+	return n
+}
+
+// last returns the parameters of the last call of the action.
+func (f *fakeAWS) last(action string) url.Values {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i := len(f.calls) - 1; i >= 0; i-- {
+		if f.calls[i].Get("Action") == action {
+			return f.calls[i]
+		}
+	}
+
+	return nil
+}
+
+func (f *fakeAWS) environment(name string) *fakeEnvironment {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.environments[name]
+}
+
+func (f *fakeAWS) handle(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	form, _ := url.ParseQuery(string(body))
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.calls = append(f.calls, form)
+	action := form.Get("Action")
+	result := ""
+
+	switch action {
+	case "DescribeEnvironments":
+		names := listParam(form, "EnvironmentNames")
+		result = "<Environments>"
+
+		for _, name := range sortedKeys(f.environments) {
+			if len(names) == 0 || contains(names, name) {
+				result += f.environments[name].xml(name)
+			}
+		}
+
+		result += "</Environments>"
+	case "UpdateEnvironment":
+		name := form.Get("EnvironmentName")
+		env, ok := f.environments[name]
+
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "<ErrorResponse><Error><Code>InvalidParameterValue</Code><Message>No Environment found for EnvironmentName = '%s'.</Message></Error><RequestId>req</RequestId></ErrorResponse>", name)
+			return
+		}
+
+		if f.failing[name] {
+			f.events = append(f.events, name)
+		} else if label := form.Get("VersionLabel"); label != "" {
+			env.version = label
+		}
+
+		if stack := form.Get("SolutionStackName"); stack != "" {
+			env.solution = stack
+		}
+
+		result = strings.TrimSuffix(strings.TrimPrefix(env.xml(name), "<member>"), "</member>")
+	case "DescribeEvents":
+		name := form.Get("EnvironmentName")
+		result = "<Events>"
+
+		if name != "" && contains(f.events, name) {
+			result += fmt.Sprintf("<member><EventDate>%s</EventDate><Message>Failed to deploy application.</Message><Severity>ERROR</Severity><EnvironmentName>%s</EnvironmentName></member>", time.Now().UTC().Add(time.Second).Format(time.RFC3339), name)
+		}
+
+		result += "</Events>"
+	case "GetCallerIdentity":
+		result = "<Account>123456789012</Account><Arn>arn:aws:iam::123456789012:user/ci</Arn>"
+	}
+
+	fmt.Fprintf(w, "<%[1]sResponse><%[1]sResult>%[2]s</%[1]sResult><ResponseMetadata><RequestId>req</RequestId></ResponseMetadata></%[1]sResponse>", action, result)
+}
+
+func (e *fakeEnvironment) xml(name string) string {
+	return fmt.Sprintf(
+		"<member><EnvironmentName>%[1]s</EnvironmentName><EnvironmentId>e-%[1]s</EnvironmentId><ApplicationName>app</ApplicationName><VersionLabel>%[2]s</VersionLabel><Status>%[3]s</Status><Health>%[4]s</Health><SolutionStackName>%[5]s</SolutionStackName><CNAME>%[1]s.example.com</CNAME><DateUpdated>2026-10-01T00:00:00Z</DateUpdated></member>",
+		name, e.version, e.status, e.health, e.solution,
+	)
+}
+
+// listParam reads a query protocol list parameter.
+func listParam(form url.Values, name string) []string {
+	var values []string
+
+	for i := 1; form.Get(fmt.Sprintf("%s.member.%d", name, i)) != ""; i++ {
+		values = append(values, form.Get(fmt.Sprintf("%s.member.%d", name, i)))
+	}
+
+	return values
+}
+
+func contains(list []string, item string) bool {
+	for _, v := range list {
+		if v == item {
+			return true
+		}
+	}
+
+	return false
+}
+
+func sortedKeys(m map[string]*fakeEnvironment) []string {
+	var keys []string
+
+	for key := range m {
+		keys = append(keys, key)
+	}
+
+	for i := range keys {
+		for j := i + 1; j < len(keys); j++ {
+			if keys[j] < keys[i] {
+				keys[i], keys[j] = keys[j], keys[i]
+			}
+		}
+	}
+
+	return keys
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elasticbeanstalk"
+)
+
+// Fleet rolls a version out to many environments of the application in
+// waves sized by percentage, such as 10% of the tenants first. The fleet is
+// either listed or made of the environments carrying the tag.
+type Fleet struct {
+	Environments []string
+	Tag          string
+	Waves        []int
+	Parallel     bool
+	Bake         time.Duration
+}
+
+// enabled reports whether the version is rolled out to a fleet.
+func (f *Fleet) enabled() bool {
+	return len(f.Environments) > 0 || f.Tag != ""
+}
+
+// waves splits the environments into stages, the percentages are
+// cumulative and a last wave picks up any environment left.
+func (f *Fleet) waves(environments []string) []Stage {
+	percentages := append(append([]int(nil), f.Waves...), 100)
+
+	var stages []Stage
+	done := 0
+
+	for _, percent := range percentages {
+		if percent > 100 {
+			percent = 100
+		}
+
+		upto := int(math.Ceil(float64(len(environments)) * float64(percent) / 100))
+
+		if upto <= done {
+			continue
+		}
+
+		stages = append(stages, Stage{
+			Name:         fmt.Sprintf("wave %d (%d%%)", len(stages)+1, percent),
+			Environments: environments[done:upto],
+			Parallel:     f.Parallel,
+			Bake:         bakeTime(f.Bake),
+			bake:         f.Bake,
+		})
+
+		done = upto
+	}
+
+	return stages
+}
+
+func bakeTime(d time.Duration) string {
+	if d == 0 {
+		return ""
+	}
+
+	return d.String()
+}
+
+// fleetEnvironments resolves the environments of the fleet, sorted so the
+// waves are the same on every run.
+func (p *Plugin) fleetEnvironments(client *elasticbeanstalk.ElasticBeanstalk) ([]string, error) {
+	if p.Fleet.Tag == "" {
+		environments := append([]string(nil), p.Fleet.Environments...)
+		sort.Strings(environments)
+
+		return environments, nil
+	}
+
+	key, value := p.Fleet.Tag, ""
+
+	if i := strings.Index(key, "="); i >= 0 {
+		key, value = key[:i], key[i+1:]
+	}
+
+	envs, err := client.DescribeEnvironments(&elasticbeanstalk.DescribeEnvironmentsInput{
+		ApplicationName: aws.String(p.Application),
+		IncludeDeleted:  aws.Bool(false),
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	var environments []string
+
+	for _, env := range envs.Environments {
+		name := aws.StringValue(env.EnvironmentName)
+		tags, err := p.environmentTags(client, name)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if got, ok := tags[key]; ok && (value == "" || got == value) {
+			environments = append(environments, name)
+		}
+	}
+
+	sort.Strings(environments)
+
+	return environments, nil
+}
+
+// planFleet turns the fleet into the rollout plan.
+func (p *Plugin) planFleet(client *elasticbeanstalk.ElasticBeanstalk) error {
+	environments, err := p.fleetEnvironments(client)
+
+	if err != nil {
+		log.WithError(err).Error("Problem resolving the fleet environments")
+		return err
+	}
+
+	if len(environments) == 0 {
+		err := fmt.Errorf("no environment of %s matches the fleet", p.Application)
+		log.WithError(err).Error("Problem resolving the fleet environments")
+		return err
+	}
+
+	p.Rollout = p.Fleet.waves(environments)
+
+	for _, stage := range p.Rollout {
+		log.WithField("environments", stage.Environments).Info("Planned " + stage.Name)
+	}
+
+	return nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Grafana defines where deploy annotations are posted.
+type Grafana struct {
+	URL   string
+	Token string
+	Tags  []string
+}
+
+type grafanaAnnotation struct {
+	Time    int64    `json:"time"`
+	TimeEnd int64    `json:"timeEnd"`
+	Tags    []string `json:"tags"`
+	Text    string   `json:"text"`
+}
+
+// annotate marks the deploy window of a single environment.
+func (g *Grafana) annotate(application string, r *envResult) error {
+	tags := append([]string{
+		"deploy",
+		"application:" + application,
+		"environment:" + r.Environment,
+	}, g.Tags...)
+
+	headers := map[string]string{}
+
+	if g.Token != "" {
+		headers["Authorization"] = "Bearer " + g.Token
+	}
+
+	text := fmt.Sprintf("Deploy of %s to %s/%s: %s", r.Version, application, r.Environment, r.Outcome)
+
+	if r.Console != "" {
+		text += fmt.Sprintf(` <a href="%s">dashboard</a>`, r.Console)
+	}
+
+	return postJSON(
+		strings.TrimSuffix(g.URL, "/")+"/api/annotations",
+		headers,
+		grafanaAnnotation{
+			Time:    millis(r.Started),
+			TimeEnd: millis(r.Finished),
+			Tags:    tags,
+			Text:    text,
+		},
+	)
+}
+
+func millis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
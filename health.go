@@ -0,0 +1,74 @@
+package main
+
+import (
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elasticbeanstalk"
+)
+
+// healthInterval is how often the enhanced health is checked.
+const healthInterval = 10 * time.Second
+
+// HealthWait requires the enhanced health of the updated environment to
+// reach the color for a number of consecutive checks, since Ready does not
+// mean the application serves traffic.
+type HealthWait struct {
+	Enabled bool
+	Color   string
+	Checks  int
+	Timeout time.Duration
+
+	// Polling paces the checks.
+	Polling Polling
+}
+
+// Wait polls the enhanced health until it was good enough Checks times in a
+// row, logging the causes whenever it is not.
+func (h HealthWait) Wait(client *elasticbeanstalk.ElasticBeanstalk, envLog *log.Entry, environment string) error {
+	tout := time.After(h.Timeout)
+	passed := 0
+
+	for {
+		out, err := client.DescribeEnvironmentHealth(&elasticbeanstalk.DescribeEnvironmentHealthInput{
+			EnvironmentName: aws.String(environment),
+			AttributeNames:  aws.StringSlice([]string{"Color", "HealthStatus", "Causes"}),
+		})
+
+		if err != nil {
+			envLog.WithError(err).Error("Problem retrieving environment health")
+			return err
+		}
+
+		color := aws.StringValue(out.Color)
+
+		healthFields := envLog.WithFields(log.Fields{
+			"color":  color,
+			"status": aws.StringValue(out.HealthStatus),
+		})
+
+		if healthRank[color] >= healthRank[h.Color] {
+			passed++
+			healthFields.WithField("checks", passed).Info("Environment is healthy")
+		} else {
+			passed = 0
+			healthFields.Warning("Environment is not healthy")
+
+			for _, cause := range out.Causes {
+				healthFields.WithField("cause", aws.StringValue(cause)).Warning("Health cause")
+			}
+		}
+
+		if passed >= h.Checks {
+			return nil
+		}
+
+		select {
+		case <-h.Polling.next(healthInterval):
+		case <-tout:
+			envLog.WithError(errUnhealthy).Error("Environment never got healthy")
+			return errUnhealthy
+		}
+	}
+}
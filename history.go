@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// historyRecord is a single entry of the deployment history.
+type historyRecord struct {
+	Time            time.Time       `json:"time"`
+	Action          string          `json:"action"`
+	Application     string          `json:"application"`
+	Environment     string          `json:"environment"`
+	Version         string          `json:"version"`
+	PreviousVersion string          `json:"previous_version,omitempty"`
+	Outcome         string          `json:"outcome,omitempty"`
+	RolledBackTo    string          `json:"rolled_back_to,omitempty"`
+	Changes         []settingChange `json:"changes,omitempty"`
+	Commit          string          `json:"commit,omitempty"`
+	Build           int             `json:"build,omitempty"`
+	BuildLink       string          `json:"build_link,omitempty"`
+}
+
+// historyStore persists the deployment history.
+type historyStore interface {
+	Append(records ...historyRecord) error
+	Records(application, environment string) ([]historyRecord, error)
+}
+
+// openHistoryStore opens the store described by the location. Plain paths
+// and file:// locations are JSON lines files, s3:// locations JSON lines
+// objects.
+func openHistoryStore(location string) (historyStore, error) {
+	switch {
+	case strings.HasPrefix(location, "s3://"):
+		if _, key := stateLocation(location); key == "" {
+			return nil, fmt.Errorf("history store %s has no key", location)
+		}
+
+		return &s3History{location: location}, nil
+	case strings.HasPrefix(location, "file://"):
+		return &fileHistory{path: strings.TrimPrefix(location, "file://")}, nil
+	case !strings.Contains(location, "://"):
+		return &fileHistory{path: location}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported history store %s", location)
+}
+
+// fileHistory keeps the history as JSON lines in a local file.
+type fileHistory struct {
+	path string
+}
+
+func (h *fileHistory) Append(records ...historyRecord) error {
+	f, err := os.OpenFile(h.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(f)
+
+	for _, r := range records {
+		if err := enc.Encode(r); err != nil {
+			f.Close()
+			return err
+		}
+	}
+
+	return f.Close()
+}
+
+func (h *fileHistory) Records(application, environment string) ([]historyRecord, error) {
+	f, err := os.Open(h.path)
+
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	return readRecords(f, application, environment)
+}
+
+// s3History keeps the history as JSON lines in an S3 object, read and
+// written like the rollout state. Appending rewrites the whole object, so
+// deploys appending at the same moment may lose a record. The session is
+// the one of the plugin settings, set once it exists.
+type s3History struct {
+	location string
+	sess     *session.Session
+}
+
+func (h *s3History) Append(records ...historyRecord) error {
+	data, err := readStateData(h.sess, h.location)
+
+	if err != nil {
+		return err
+	}
+
+	buf := bytes.NewBuffer(data)
+	enc := json.NewEncoder(buf)
+
+	for _, r := range records {
+		if err := enc.Encode(r); err != nil {
+			return err
+		}
+	}
+
+	return writeStateData(h.sess, h.location, buf.Bytes())
+}
+
+func (h *s3History) Records(application, environment string) ([]historyRecord, error) {
+	data, err := readStateData(h.sess, h.location)
+
+	if err != nil || data == nil {
+		return nil, err
+	}
+
+	return readRecords(bytes.NewReader(data), application, environment)
+}
+
+// readRecords decodes the JSON lines records of the environment.
+func readRecords(r io.Reader, application, environment string) ([]historyRecord, error) {
+	var records []historyRecord
+	scanner := bufio.NewScanner(r)
+
+	for scanner.Scan() {
+		var record historyRecord
+
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, err
+		}
+
+		if record.Application == application && record.Environment == environment {
+			records = append(records, record)
+		}
+	}
+
+	return records, scanner.Err()
+}
+
+// newHistoryRecord fills in the fields shared by every record of this run.
+func (p *Plugin) newHistoryRecord(action, environment string) historyRecord {
+	return historyRecord{
+		Time:        time.Now().UTC(),
+		Action:      action,
+		Application: p.Application,
+		Environment: environment,
+		Version:     p.VersionLabel,
+		Commit:      p.Commit.SHA,
+		Build:       p.Build.Number,
+		BuildLink:   p.Build.Link,
+	}
+}
+
+// recordDeploys appends the deploy results to the history store, if any.
+func (p *Plugin) recordDeploys(results []*envResult) error {
+	if p.History == nil {
+		return nil
+	}
+
+	var records []historyRecord
+
+	for _, r := range results {
+		record := p.newHistoryRecord("deploy", r.Environment)
+		record.Version = r.Version
+		record.PreviousVersion = r.PreviousVersion
+		record.Outcome = r.Outcome
+		record.RolledBackTo = r.RolledBackTo
+
+		records = append(records, record)
+	}
+
+	return p.History.Append(records...)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"net/url"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/elasticbeanstalk"
+)
+
+func TestS3History(t *testing.T) {
+	bucket := &fakeBucket{objects: map[string][]byte{}}
+	h := &s3History{location: "s3://bucket/app/history.jsonl", sess: testSession(t, bucket)}
+
+	records, err := h.Records("app", "app-prod")
+
+	if err != nil || records != nil {
+		t.Fatalf("got %v, %v from an empty store", records, err)
+	}
+
+	if err := h.Append(historyRecord{Application: "app", Environment: "app-prod", Version: "v1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := h.Append(historyRecord{Application: "app", Environment: "app-dev", Version: "v2"}, historyRecord{Application: "app", Environment: "app-prod", Version: "v2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err = h.Records("app", "app-prod")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(records) != 2 || records[0].Version != "v1" || records[1].Version != "v2" {
+		t.Errorf("got records %+v, want v1 and v2 of app-prod", records)
+	}
+}
+
+func TestAuditVersionOnly(t *testing.T) {
+	sess := querySession(t, func(action string, form url.Values) (string, error) {
+		return "", errors.New("unexpected " + action)
+	})
+
+	p := &Plugin{
+		Application:  "app",
+		VersionLabel: "v2",
+		Build:        Build{Number: 42},
+		History:      &fileHistory{path: filepath.Join(t.TempDir(), "history.jsonl")},
+	}
+
+	if err := p.audit(elasticbeanstalk.New(sess)); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := p.History.Records("app", "")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(records) != 1 || records[0].Action != "audit" || records[0].Version != "v2" || records[0].Build != 42 {
+		t.Errorf("got records %+v, want an audit of v2", records)
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const (
+	hookPreUpload  = "pre-upload"
+	hookPreUpdate  = "pre-update"
+	hookPostUpdate = "post-update"
+	hookOnFailure  = "on-failure"
+)
+
+// Hooks are commands or URLs run at the lifecycle phases of a deploy. URLs
+// receive the deploy context as a JSON POST, commands run through sh with
+// the context on stdin and in DEPLOY_* variables.
+type Hooks struct {
+	PreUpload  []string
+	PreUpdate  []string
+	PostUpdate []string
+	OnFailure  []string
+}
+
+// hookContext is the deploy context handed to the hooks.
+type hookContext struct {
+	Phase        string `json:"phase"`
+	Application  string `json:"application"`
+	Environment  string `json:"environment,omitempty"`
+	VersionLabel string `json:"version_label"`
+	Bucket       string `json:"bucket,omitempty"`
+	BucketKey    string `json:"bucket_key,omitempty"`
+	Repo         string `json:"repo,omitempty"`
+	Build        int    `json:"build,omitempty"`
+	BuildLink    string `json:"build_link,omitempty"`
+	Commit       string `json:"commit,omitempty"`
+	Branch       string `json:"branch,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+// hooks returns the hooks configured for the phase.
+func (h Hooks) hooks(phase string) []string {
+	switch phase {
+	case hookPreUpload:
+		return h.PreUpload
+	case hookPreUpdate:
+		return h.PreUpdate
+	case hookPostUpdate:
+		return h.PostUpdate
+	case hookOnFailure:
+		return h.OnFailure
+	}
+
+	return nil
+}
+
+// hooks returns the hooks configured for the phase, including the built-in
+// migration.
+func (p *Plugin) hooks(phase string) []string {
+	if phase == hookMigration {
+		return []string{p.Migration.Command}
+	}
+
+	return p.Hooks.hooks(phase)
+}
+
+// runHooks runs the hooks of the phase in order and stops at the first one
+// failing. The environment is empty for phases before any update.
+func (p *Plugin) runHooks(phase, environment string, cause error) error {
+	return p.runHooksUntil(nil, phase, environment, cause)
+}
+
+// runHooksUntil runs the hooks like runHooks, killing the running command
+// once stop is closed.
+func (p *Plugin) runHooksUntil(stop <-chan struct{}, phase, environment string, cause error) error {
+	hooks := p.hooks(phase)
+
+	if len(hooks) == 0 {
+		return nil
+	}
+
+	ctx := hookContext{
+		Phase:        phase,
+		Application:  p.Application,
+		Environment:  environment,
+		VersionLabel: p.VersionLabel,
+		Bucket:       p.Bucket,
+		BucketKey:    p.BucketKey,
+		Repo:         p.Repo.FullName,
+		Build:        p.Build.Number,
+		BuildLink:    p.Build.Link,
+		Commit:       p.Commit.SHA,
+		Branch:       p.Commit.Branch,
+	}
+
+	if cause != nil {
+		ctx.Error = cause.Error()
+	}
+
+	hookLog := log.WithField("hook", phase)
+
+	if environment != "" {
+		hookLog = hookLog.WithField("environment", environment)
+	}
+
+	for _, hook := range hooks {
+		hookLog.WithField("run", hook).Info("Running hook")
+
+		var err error
+
+		if strings.HasPrefix(hook, "http://") || strings.HasPrefix(hook, "https://") {
+			err = postJSON(hook, nil, ctx)
+		} else {
+			err = runHookCommand(hook, ctx, stop)
+		}
+
+		if err != nil {
+			hookLog.WithError(err).WithField("run", hook).Error("Problem running hook")
+			return fmt.Errorf("%s hook failed: %s", phase, err)
+		}
+	}
+
+	return nil
+}
+
+// runHookCommand runs the command through sh, streaming its output, and
+// kills it along with its children once stop is closed.
+func runHookCommand(command string, ctx hookContext, stop <-chan struct{}) error {
+	payload, err := json.Marshal(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Stdin = bytes.NewReader(payload)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(
+		os.Environ(),
+		"DEPLOY_PHASE="+ctx.Phase,
+		"DEPLOY_APPLICATION="+ctx.Application,
+		"DEPLOY_ENVIRONMENT="+ctx.Environment,
+		"DEPLOY_VERSION_LABEL="+ctx.VersionLabel,
+		"DEPLOY_ERROR="+ctx.Error,
+	)
+
+	// the command gets a process group of its own, so stopping it also
+	// stops whatever the shell started
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		select {
+		case <-stop:
+			syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		case <-done:
+		}
+	}()
+
+	return cmd.Wait()
+}
+
+// runFailureHooks runs the on-failure hooks, their own problems are only
+// logged so the original failure is reported.
+func (p *Plugin) runFailureHooks(environment string, cause error) {
+	p.runHooks(hookOnFailure, environment, cause)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elasticbeanstalk"
+)
+
+// reportDegraded logs the health of every instance when the environment
+// ended up Yellow or Red, so the failing instances are visible without the
+// console. Problems are only logged.
+func (p *Plugin) reportDegraded(client *elasticbeanstalk.ElasticBeanstalk, envLog *log.Entry, environment string) {
+	env, err := findEnvironment(client, p.Application, environment)
+
+	if err != nil || env == nil {
+		return
+	}
+
+	switch aws.StringValue(env.Health) {
+	case elasticbeanstalk.EnvironmentHealthYellow, elasticbeanstalk.EnvironmentHealthRed:
+	default:
+		return
+	}
+
+	input := &elasticbeanstalk.DescribeInstancesHealthInput{
+		EnvironmentName: aws.String(environment),
+		AttributeNames:  aws.StringSlice([]string{"All"}),
+	}
+
+	for {
+		out, err := client.DescribeInstancesHealth(input)
+
+		if err != nil {
+			envLog.WithError(err).Warning("Problem retrieving instance health")
+			return
+		}
+
+		for _, i := range out.InstanceHealthList {
+			fields := log.Fields{
+				"instance": aws.StringValue(i.InstanceId),
+				"zone":     aws.StringValue(i.AvailabilityZone),
+				"status":   aws.StringValue(i.HealthStatus),
+				"causes":   strings.Join(aws.StringValueSlice(i.Causes), "; "),
+			}
+
+			if i.Deployment != nil {
+				fields["version"] = aws.StringValue(i.Deployment.VersionLabel)
+				fields["deployment"] = aws.StringValue(i.Deployment.Status)
+			}
+
+			entry := envLog.WithFields(fields)
+
+			switch aws.StringValue(i.Color) {
+			case elasticbeanstalk.EnvironmentHealthGreen:
+				entry.Info("Instance health")
+			default:
+				entry.Warning("Instance health")
+			}
+		}
+
+		if out.NextToken == nil {
+			return
+		}
+
+		input.NextToken = out.NextToken
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elasticbeanstalk"
+)
+
+// actionReport lists what runs where across the application.
+const actionReport = "report"
+
+// runningVersion is what an environment of the application runs.
+type runningVersion struct {
+	Environment string    `json:"environment"`
+	Version     string    `json:"version"`
+	Platform    string    `json:"platform"`
+	Status      string    `json:"status"`
+	Health      string    `json:"health"`
+	LastDeploy  time.Time `json:"last_deploy"`
+}
+
+// inventory describes every environment of the application. The last
+// deploy comes from the history store when one is configured, or else is
+// when the environment was last updated.
+func (p *Plugin) inventory(client *elasticbeanstalk.ElasticBeanstalk) ([]runningVersion, error) {
+	envs, err := client.DescribeEnvironments(
+		&elasticbeanstalk.DescribeEnvironmentsInput{
+			ApplicationName: aws.String(p.Application),
+			IncludeDeleted:  aws.Bool(false),
+		},
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var running []runningVersion
+
+	for _, env := range envs.Environments {
+		r := runningVersion{
+			Environment: aws.StringValue(env.EnvironmentName),
+			Version:     aws.StringValue(env.VersionLabel),
+			Platform:    aws.StringValue(env.SolutionStackName),
+			Status:      aws.StringValue(env.Status),
+			Health:      aws.StringValue(env.Health),
+			LastDeploy:  aws.TimeValue(env.DateUpdated),
+		}
+
+		if p.History != nil {
+			records, err := p.History.Records(p.Application, r.Environment)
+
+			if err != nil {
+				return nil, err
+			}
+
+			for _, record := range records {
+				if record.Action == "deploy" && record.Outcome == outcomeSuccess && record.Time.After(r.LastDeploy) {
+					r.LastDeploy = record.Time
+				}
+			}
+		}
+
+		running = append(running, r)
+	}
+
+	sort.Slice(running, func(i, j int) bool {
+		return running[i].Environment < running[j].Environment
+	})
+
+	return running, nil
+}
+
+// writeInventory prints the environments as a table, a JSON document or,
+// with format markdown, a table to paste in a wiki page or an issue.
+func writeInventory(w io.Writer, format string, running []runningVersion) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(running)
+	case "markdown":
+		fmt.Fprintln(w, "| Environment | Version | Platform | Status | Health | Last deploy |")
+		fmt.Fprintln(w, "| --- | --- | --- | --- | --- | --- |")
+
+		for _, r := range running {
+			fmt.Fprintf(w, "| %s |\n", strings.Join([]string{
+				r.Environment,
+				orDash(r.Version),
+				orDash(r.Platform),
+				r.Status,
+				orDash(r.Health),
+				r.LastDeploy.UTC().Format(time.RFC3339),
+			}, " | "))
+		}
+
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ENVIRONMENT\tVERSION\tPLATFORM\tSTATUS\tHEALTH\tLAST DEPLOY")
+
+	for _, r := range running {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			r.Environment,
+			orDash(r.Version),
+			orDash(r.Platform),
+			r.Status,
+			orDash(r.Health),
+			r.LastDeploy.UTC().Format(time.RFC3339),
+		)
+	}
+
+	return tw.Flush()
+}
+
+// reportFleet prints what every environment of the application runs.
+func (p *Plugin) reportFleet(client *elasticbeanstalk.ElasticBeanstalk) error {
+	running, err := p.inventory(client)
+
+	if err != nil {
+		log.WithError(err).WithField("application", p.Application).Error("Problem retrieving the environments")
+		return err
+	}
+
+	return writeInventory(os.Stdout, p.ReportFormat, running)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+// captureStdout returns what the function printed.
+func captureStdout(t *testing.T, fn func()) string {
+	r, w, err := os.Pipe()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stdout := os.Stdout
+	os.Stdout = w
+
+	done := make(chan string)
+
+	go func() {
+		var buf bytes.Buffer
+		io.Copy(&buf, r)
+		done <- buf.String()
+	}()
+
+	fn()
+
+	os.Stdout = stdout
+	w.Close()
+
+	return <-done
+}
+
+func TestReportAction(t *testing.T) {
+	f := newFakeAWS(t, "app-api", "app-web")
+	f.environment("app-web").version = "v7"
+
+	p := f.plugin()
+	p.Action = actionReport
+	p.ReportFormat = "json"
+
+	var err error
+	out := captureStdout(t, func() { err = p.Exec() })
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var running []runningVersion
+
+	if err := json.Unmarshal([]byte(out), &running); err != nil {
+		t.Fatalf("%s: %s", err, out)
+	}
+
+	if len(running) != 2 || running[0].Environment != "app-api" || running[1].Version != "v7" || running[1].Platform == "" || running[1].LastDeploy.IsZero() {
+		t.Errorf("report %+v", running)
+	}
+
+	if f.count("UpdateEnvironment") != 0 {
+		t.Error("report updated an environment")
+	}
+}
+
+func TestWriteInventoryMarkdown(t *testing.T) {
+	var buf bytes.Buffer
+
+	err := writeInventory(&buf, "markdown", []runningVersion{{Environment: "app-web", Version: "v7", Status: "Ready"}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(buf.String(), "| app-web | v7 | - | Ready | - |") {
+		t.Errorf("markdown report:\n%s", buf.String())
+	}
+}
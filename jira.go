@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const jiraURL = "https://api.atlassian.com"
+
+var jiraIssueKey = regexp.MustCompile(`\b[A-Z][A-Z0-9]+-[0-9]+\b`)
+
+// Jira defines where deployment information is pushed.
+type Jira struct {
+	CloudID string
+	Token   string
+	URL     string
+}
+
+type jiraDeployments struct {
+	Deployments []jiraDeployment `json:"deployments"`
+}
+
+type jiraDeployment struct {
+	DeploymentSequenceNumber int               `json:"deploymentSequenceNumber"`
+	UpdateSequenceNumber     int64             `json:"updateSequenceNumber"`
+	Associations             []jiraAssociation `json:"associations"`
+	DisplayName              string            `json:"displayName"`
+	URL                      string            `json:"url"`
+	Description              string            `json:"description"`
+	LastUpdated              string            `json:"lastUpdated"`
+	State                    string            `json:"state"`
+	Pipeline                 jiraPipeline      `json:"pipeline"`
+	Environment              jiraEnvironment   `json:"environment"`
+}
+
+type jiraAssociation struct {
+	AssociationType string   `json:"associationType"`
+	Values          []string `json:"values"`
+}
+
+type jiraPipeline struct {
+	ID          string `json:"id"`
+	DisplayName string `json:"displayName"`
+	URL         string `json:"url"`
+}
+
+type jiraEnvironment struct {
+	ID          string `json:"id"`
+	DisplayName string `json:"displayName"`
+	Type        string `json:"type"`
+}
+
+// issueKeys returns the unique Jira issue keys mentioned in the texts.
+func issueKeys(texts ...string) []string {
+	var keys []string
+	seen := map[string]bool{}
+
+	for _, text := range texts {
+		for _, key := range jiraIssueKey.FindAllString(text, -1) {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+
+	return keys
+}
+
+// deployments pushes the deploy results for the issue keys to Jira.
+func (j *Jira) deployments(p *Plugin, keys []string, results []*envResult) error {
+	url := j.URL
+
+	if url == "" {
+		url = jiraURL
+	}
+
+	payload := jiraDeployments{}
+
+	for _, r := range results {
+		state := "successful"
+
+		if r.err != nil {
+			state = "failed"
+		}
+
+		envType := "staging"
+
+		if p.isProduction(r.Environment) {
+			envType = "production"
+		}
+
+		payload.Deployments = append(payload.Deployments, jiraDeployment{
+			DeploymentSequenceNumber: p.Build.Number,
+			UpdateSequenceNumber:     time.Now().Unix(),
+			Associations: []jiraAssociation{
+				{AssociationType: "issueIdOrKeys", Values: keys},
+			},
+			DisplayName: fmt.Sprintf("%s to %s", r.Version, r.Environment),
+			URL:         p.Build.Link,
+			Description: p.Description,
+			LastUpdated: r.Finished.UTC().Format(time.RFC3339),
+			State:       state,
+			Pipeline: jiraPipeline{
+				ID:          p.Application,
+				DisplayName: p.Application,
+				URL:         p.Build.Link,
+			},
+			Environment: jiraEnvironment{
+				ID:          p.Application + "/" + r.Environment,
+				DisplayName: r.Environment,
+				Type:        envType,
+			},
+		})
+	}
+
+	return postJSON(
+		fmt.Sprintf("%s/jira/deployments/0.1/cloud/%s/bulk", strings.TrimSuffix(url, "/"), j.CloudID),
+		map[string]string{"Authorization": "Bearer " + j.Token},
+		payload,
+	)
+}
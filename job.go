@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"strconv"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// deadlineMargin is kept free before the deadline to report the outcome
+// and write the status file before the job is killed.
+const deadlineMargin = 30 * time.Second
+
+var (
+	errCancelled = errors.New("build cancelled")
+	errDeadline  = errors.New("deadline already passed")
+)
+
+// jobStatus is written to the status file, for workflow engines such as
+// Argo to read as an output parameter.
+type jobStatus struct {
+	trailer
+
+	ExitCode int          `json:"exit_code"`
+	Finished time.Time    `json:"finished"`
+	Results  []*envResult `json:"results,omitempty"`
+}
+
+// writeStatus writes the outcome of the run to the status file, when one
+// is configured.
+func (p *Plugin) writeStatus(started time.Time, err error, code int) {
+	if p.StatusFile == "" {
+		return
+	}
+
+	data, merr := json.MarshalIndent(jobStatus{
+		trailer:  p.newTrailer(started, err),
+		ExitCode: code,
+		Finished: time.Now().UTC(),
+		Results:  p.results,
+	}, "", "  ")
+
+	if merr == nil {
+		merr = ioutil.WriteFile(p.StatusFile, append(data, '\n'), 0644)
+	}
+
+	if merr != nil {
+		log.WithError(merr).WithField("file", p.StatusFile).Error("Problem writing the status file")
+	}
+}
+
+// parseDeadline reads a deadline as seconds, as in activeDeadlineSeconds,
+// a duration or an RFC 3339 time. Relative deadlines count from now.
+func parseDeadline(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return now.Add(time.Duration(seconds) * time.Second), nil
+	}
+
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(d), nil
+	}
+
+	return time.Parse(time.RFC3339, value)
+}
+
+// applyDeadline shortens the timeout so the deploy gives up, and reports
+// it, before the job is killed at the deadline.
+func (p *Plugin) applyDeadline() error {
+	if p.Deadline.IsZero() {
+		return nil
+	}
+
+	left := time.Until(p.Deadline) - deadlineMargin
+
+	if left <= 0 {
+		log.WithError(errDeadline).WithField("deadline", p.Deadline.Format(time.RFC3339)).Error("No time left to deploy")
+		return errDeadline
+	}
+
+	if p.Timeout > left {
+		log.WithFields(log.Fields{
+			"deadline": p.Deadline.Format(time.RFC3339),
+			"timeout":  left.Round(time.Second),
+		}).Info("Shortening the timeout to the deadline")
+
+		p.Timeout = left
+	}
+
+	return nil
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elasticbeanstalk"
+)
+
+const (
+	actionMarkBad  = "mark-bad"
+	actionMarkGood = "mark-good"
+)
+
+// versionStatusTag is the tag of application versions marked bad or good.
+const versionStatusTag = "deploy:status"
+
+var errKnownBad = errors.New("version is known to be bad for the environment")
+
+// isBadRecord reports whether a history record marks its version as bad.
+func isBadRecord(record historyRecord) bool {
+	return record.Action == actionMarkBad || record.RolledBackTo != ""
+}
+
+// isGoodRecord reports whether a history record clears a bad mark of its
+// version, by marking it good or deploying it successfully.
+func isGoodRecord(record historyRecord) bool {
+	return record.Action == actionMarkGood || record.Action == "deploy" && record.Outcome == outcomeSuccess
+}
+
+// knownBad returns the latest record marking the version as bad in the
+// history of an environment, such as a deploy that was rolled back. Only a
+// later mark-good record or successful deploy of the version clears it,
+// audit records and failed attempts leave it in place.
+func knownBad(records []historyRecord, version string) (historyRecord, bool) {
+	var bad historyRecord
+	found := false
+
+	for _, record := range records {
+		if record.Version != version {
+			continue
+		}
+
+		switch {
+		case isBadRecord(record):
+			bad, found = record, true
+		case isGoodRecord(record):
+			bad, found = historyRecord{}, false
+		}
+	}
+
+	return bad, found
+}
+
+// checkKnownBad refuses to deploy a version the history marks as bad for the
+// environment, so an old pipeline run cannot bring a broken artifact back.
+func (p *Plugin) checkKnownBad(envLog *log.Entry, environment string) error {
+	if p.History == nil || p.AllowKnownBad {
+		return nil
+	}
+
+	records, err := p.History.Records(p.Application, environment)
+
+	if err != nil {
+		envLog.WithError(err).Error("Problem reading the deployment history")
+		return err
+	}
+
+	record, bad := knownBad(records, p.VersionLabel)
+
+	if !bad {
+		return nil
+	}
+
+	envLog.WithFields(log.Fields{
+		"versionlabel":   p.VersionLabel,
+		"marked":         record.Time,
+		"action":         record.Action,
+		"rolled_back_to": record.RolledBackTo,
+		"build_link":     record.BuildLink,
+	}).WithError(errKnownBad).Error("Refusing to deploy a known bad version, use allow-known-bad to override")
+
+	return errKnownBad
+}
+
+// rollbackTarget skips a previous version the history marks as bad, falling
+// back to the latest version that deployed successfully and is not marked
+// bad since.
+func (p *Plugin) rollbackTarget(envLog *log.Entry, environment, previous string) string {
+	if p.History == nil || previous == "" {
+		return previous
+	}
+
+	records, err := p.History.Records(p.Application, environment)
+
+	if err != nil {
+		envLog.WithError(err).Warn("Problem reading the deployment history, keeping the previous version")
+		return previous
+	}
+
+	if _, bad := knownBad(records, previous); !bad {
+		return previous
+	}
+
+	for i := len(records) - 1; i >= 0; i-- {
+		record := records[i]
+
+		if record.Action != "deploy" || record.Outcome != outcomeSuccess || record.Version == p.VersionLabel {
+			continue
+		}
+
+		if _, bad := knownBad(records, record.Version); bad {
+			continue
+		}
+
+		envLog.WithFields(log.Fields{
+			"previous": previous,
+			"target":   record.Version,
+		}).Warn("Previous version is marked bad, rolling back to the last good version instead")
+
+		return record.Version
+	}
+
+	envLog.WithField("previous", previous).Warn("Previous version is marked bad and no good version is known")
+	return previous
+}
+
+// markVersion tags the version as bad or good and records the mark in the
+// history of each environment, feeding the known bad guard and the choice
+// of rollback targets.
+func (p *Plugin) markVersion(client *elasticbeanstalk.ElasticBeanstalk) error {
+	if p.VersionLabel == "" {
+		return fmt.Errorf("a version label is required to mark a version")
+	}
+
+	status := "good"
+
+	if p.Action == actionMarkBad {
+		status = "bad"
+	}
+
+	markLog := log.WithFields(log.Fields{
+		"application":  p.Application,
+		"versionlabel": p.VersionLabel,
+		"status":       status,
+	})
+
+	err := p.tagVersion(client, []*elasticbeanstalk.Tag{
+		{Key: aws.String(versionStatusTag), Value: aws.String(status)},
+	})
+
+	if err != nil {
+		markLog.WithError(err).Error("Problem tagging the version")
+		return err
+	}
+
+	if p.History == nil {
+		markLog.Warn("No history store, the mark is only recorded as a tag")
+		return nil
+	}
+
+	var records []historyRecord
+
+	for _, environment := range p.environments() {
+		records = append(records, p.newHistoryRecord(p.Action, environment))
+	}
+
+	if err := p.History.Append(records...); err != nil {
+		markLog.WithError(err).Error("Problem recording the mark in the history")
+		return err
+	}
+
+	markLog.WithField("environments", p.environments()).Info("Marked version")
+	return nil
+}
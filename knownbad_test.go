@@ -0,0 +1,44 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestKnownBad(t *testing.T) {
+	deployed := historyRecord{Action: "deploy", Version: "v2", Outcome: outcomeSuccess}
+	rolledBack := historyRecord{Action: "deploy", Version: "v2", Outcome: outcomeFailed, RolledBackTo: "v1"}
+	failed := historyRecord{Action: "deploy", Version: "v2", Outcome: outcomeFailed}
+	audited := historyRecord{Action: "audit", Version: "v2"}
+	markedBad := historyRecord{Action: actionMarkBad, Version: "v2"}
+	markedGood := historyRecord{Action: actionMarkGood, Version: "v2"}
+	other := historyRecord{Action: "deploy", Version: "v3", Outcome: outcomeFailed, RolledBackTo: "v2"}
+
+	tests := []struct {
+		name    string
+		records []historyRecord
+		want    *historyRecord
+	}{
+		{name: "no history"},
+		{name: "deployed", records: []historyRecord{deployed}},
+		{name: "rolled back", records: []historyRecord{deployed, rolledBack}, want: &rolledBack},
+		{name: "deployed again", records: []historyRecord{rolledBack, deployed}},
+		{name: "audited after rollback", records: []historyRecord{rolledBack, audited}, want: &rolledBack},
+		{name: "failed after rollback", records: []historyRecord{rolledBack, failed}, want: &rolledBack},
+		{name: "marked bad", records: []historyRecord{deployed, markedBad, audited}, want: &markedBad},
+		{name: "marked good", records: []historyRecord{rolledBack, markedGood}},
+		{name: "other version rolled back", records: []historyRecord{deployed, other}},
+	}
+
+	for _, test := range tests {
+		record, bad := knownBad(test.records, "v2")
+
+		if bad != (test.want != nil) {
+			t.Errorf("%s: got bad %v, want %v", test.name, bad, test.want != nil)
+		}
+
+		if bad && test.want != nil && !reflect.DeepEqual(record, *test.want) {
+			t.Errorf("%s: got record %+v, want %+v", test.name, record, *test.want)
+		}
+	}
+}
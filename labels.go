@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// defaultDescription describes versions of builds without commit metadata.
+const defaultDescription = "Update from quintoandar/drone-elasticbeanstalk plugin"
+
+// maxDescription is the longest description Beanstalk accepts.
+const maxDescription = 200
+
+// labelFuncs are the functions of version label and description templates.
+var labelFuncs = template.FuncMap{
+	"trunc": func(n int, s string) string {
+		if len(s) > n {
+			return s[:n]
+		}
+
+		return s
+	},
+	"lower":   strings.ToLower,
+	"upper":   strings.ToUpper,
+	"replace": func(old, new, s string) string { return strings.Replace(s, old, new, -1) },
+	"env":     os.Getenv,
+}
+
+// envPlaceholder matches ${NAME} placeholders, a bare $NAME is left alone
+// as labels may well contain a dollar sign.
+var envPlaceholder = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandEnv replaces the ${NAME} placeholders with the environment
+// variables, failing on unset ones rather than leaving a hole in the label.
+func expandEnv(name, text string) (string, error) {
+	var missing []string
+
+	expanded := envPlaceholder.ReplaceAllStringFunc(text, func(placeholder string) string {
+		variable := envPlaceholder.FindStringSubmatch(placeholder)[1]
+		value, ok := os.LookupEnv(variable)
+
+		if !ok {
+			missing = append(missing, variable)
+		}
+
+		return value
+	})
+
+	if len(missing) > 0 {
+		return "", fmt.Errorf("%s refers to unset %s", name, strings.Join(missing, ", "))
+	}
+
+	return expanded, nil
+}
+
+// labelData is what version label and description templates can refer to.
+type labelData struct {
+	Application string
+	Repo        Repo
+	Build       Build
+	Commit      Commit
+}
+
+// expandLabel expands the ${NAME} placeholders of a setting and runs it as
+// a template, text without actions is returned as is.
+func (p *Plugin) expandLabel(name, text string) (string, error) {
+	text, err := expandEnv(name, text)
+
+	if err != nil {
+		return "", err
+	}
+
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+
+	t, err := template.New(name).Funcs(labelFuncs).Option("missingkey=error").Parse(text)
+
+	if err != nil {
+		return "", fmt.Errorf("invalid %s template: %s", name, err)
+	}
+
+	var b bytes.Buffer
+
+	err = t.Execute(&b, labelData{
+		Application: p.Application,
+		Repo:        p.Repo,
+		Build:       p.Build,
+		Commit:      p.Commit,
+	})
+
+	if err != nil {
+		return "", fmt.Errorf("invalid %s template: %s", name, err)
+	}
+
+	return strings.TrimSpace(b.String()), nil
+}
+
+// buildLabels expands the version label, description and bucket key
+// templates and fills the first two in from the build when they are left
+// out. Artifacts derive their label from their name instead.
+func (p *Plugin) buildLabels() error {
+	for _, setting := range []struct {
+		name  string
+		value *string
+	}{
+		{"version-label", &p.VersionLabel},
+		{"description", &p.Description},
+		{"bucket-key", &p.BucketKey},
+	} {
+		expanded, err := p.expandLabel(setting.name, *setting.value)
+
+		if err != nil {
+			return err
+		}
+
+		*setting.value = expanded
+	}
+
+	if p.VersionLabel == "" && !p.hasArtifact() && p.Build.Number != 0 {
+		p.VersionLabel = fmt.Sprint(p.Build.Number)
+
+		if p.Commit.SHA != "" {
+			p.VersionLabel += "-" + shortSHA(p.Commit.SHA)
+		}
+	}
+
+	if p.Description == "" {
+		p.Description = p.commitDescription()
+	}
+
+	return nil
+}
+
+// commitDescription describes the version with the first line of the
+// commit message, its author and branch.
+func (p *Plugin) commitDescription() string {
+	message := strings.TrimSpace(p.Commit.Message)
+
+	if i := strings.Index(message, "\n"); i >= 0 {
+		message = strings.TrimSpace(message[:i])
+	}
+
+	if message == "" {
+		return defaultDescription
+	}
+
+	var by []string
+
+	if p.Commit.Author != "" {
+		by = append(by, p.Commit.Author)
+	}
+
+	if p.Commit.Branch != "" {
+		by = append(by, p.Commit.Branch)
+	}
+
+	if len(by) > 0 {
+		message = fmt.Sprintf("%s (%s)", message, strings.Join(by, ", "))
+	}
+
+	if len(message) > maxDescription {
+		message = message[:maxDescription-3] + "..."
+	}
+
+	return message
+}
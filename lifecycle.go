@@ -0,0 +1,68 @@
+package main
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elasticbeanstalk"
+)
+
+// Lifecycle is the version lifecycle policy of the application, Beanstalk
+// then deletes old versions on its own.
+type Lifecycle struct {
+	MaxCount     int
+	MaxAgeInDays int
+	DeleteSource bool
+	ServiceRole  string
+}
+
+// enabled reports whether any rule is configured.
+func (l Lifecycle) enabled() bool {
+	return l.MaxCount > 0 || l.MaxAgeInDays > 0
+}
+
+// config builds the lifecycle configuration, a rule left out is disabled.
+func (l Lifecycle) config() *elasticbeanstalk.ApplicationResourceLifecycleConfig {
+	conf := &elasticbeanstalk.ApplicationResourceLifecycleConfig{
+		VersionLifecycleConfig: &elasticbeanstalk.ApplicationVersionLifecycleConfig{
+			MaxCountRule: &elasticbeanstalk.MaxCountRule{
+				Enabled: aws.Bool(l.MaxCount > 0),
+			},
+			MaxAgeRule: &elasticbeanstalk.MaxAgeRule{
+				Enabled: aws.Bool(l.MaxAgeInDays > 0),
+			},
+		},
+	}
+
+	if l.MaxCount > 0 {
+		conf.VersionLifecycleConfig.MaxCountRule.MaxCount = aws.Int64(int64(l.MaxCount))
+		conf.VersionLifecycleConfig.MaxCountRule.DeleteSourceFromS3 = aws.Bool(l.DeleteSource)
+	}
+
+	if l.MaxAgeInDays > 0 {
+		conf.VersionLifecycleConfig.MaxAgeRule.MaxAgeInDays = aws.Int64(int64(l.MaxAgeInDays))
+		conf.VersionLifecycleConfig.MaxAgeRule.DeleteSourceFromS3 = aws.Bool(l.DeleteSource)
+	}
+
+	if l.ServiceRole != "" {
+		conf.ServiceRole = aws.String(l.ServiceRole)
+	}
+
+	return conf
+}
+
+// applyLifecycle sets the version lifecycle policy of the application.
+func (p *Plugin) applyLifecycle(client *elasticbeanstalk.ElasticBeanstalk) error {
+	log.WithFields(log.Fields{
+		"application":   p.Application,
+		"max-count":     p.Lifecycle.MaxCount,
+		"max-age-days":  p.Lifecycle.MaxAgeInDays,
+		"delete-source": p.Lifecycle.DeleteSource,
+	}).Info("Updating application version lifecycle")
+
+	_, err := client.UpdateApplicationResourceLifecycle(&elasticbeanstalk.UpdateApplicationResourceLifecycleInput{
+		ApplicationName:         aws.String(p.Application),
+		ResourceLifecycleConfig: p.Lifecycle.config(),
+	})
+
+	return err
+}
@@ -3,10 +3,12 @@ package main
 import (
 	"fmt"
 	"os"
+	"regexp"
 	"strconv"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/service/elasticbeanstalk"
 	"github.com/urfave/cli"
 )
 
@@ -30,6 +32,32 @@ func main() {
 			Usage:  "aws secret key",
 			EnvVar: "PLUGIN_SECRET_KEY,AWS_SECRET_ACCESS_KEY",
 		},
+		cli.StringFlag{
+			Name:   "assume-role",
+			Usage:  "arn of the role to deploy as",
+			EnvVar: "PLUGIN_ASSUME_ROLE",
+		},
+		cli.StringFlag{
+			Name:   "external-id",
+			Usage:  "external id required by the trust policy of the role",
+			EnvVar: "PLUGIN_EXTERNAL_ID",
+		},
+		cli.StringFlag{
+			Name:   "role-session-name",
+			Usage:  "session name of the assumed role",
+			Value:  "drone-elastic-beanstalk",
+			EnvVar: "PLUGIN_ROLE_SESSION_NAME",
+		},
+		cli.StringFlag{
+			Name:   "role-arn",
+			Usage:  "arn of the role the web identity token is exchanged for",
+			EnvVar: "PLUGIN_ROLE_ARN,AWS_ROLE_ARN",
+		},
+		cli.StringFlag{
+			Name:   "token-file",
+			Usage:  "file holding the web identity token of the runner",
+			EnvVar: "PLUGIN_TOKEN_FILE,AWS_WEB_IDENTITY_TOKEN_FILE",
+		},
 		cli.StringFlag{
 			Name:   "bucket",
 			Usage:  "aws bucket",
@@ -46,6 +74,155 @@ func main() {
 			Usage:  "upload files from source folder",
 			EnvVar: "PLUGIN_BUCKET_KEY",
 		},
+		cli.StringFlag{
+			Name:   "artifact, source-file",
+			Usage:  "local zip to upload to the bucket and deploy",
+			EnvVar: "PLUGIN_ARTIFACT,PLUGIN_SOURCE_FILE",
+		},
+		cli.StringFlag{
+			Name:   "source",
+			Usage:  "local directory to zip, upload to the bucket and deploy",
+			EnvVar: "PLUGIN_SOURCE",
+		},
+		cli.StringSliceFlag{
+			Name:   "include",
+			Usage:  "glob patterns of the source directory files to package",
+			EnvVar: "PLUGIN_INCLUDE",
+		},
+		cli.StringSliceFlag{
+			Name:   "exclude",
+			Usage:  "glob patterns of the source directory files to leave out",
+			EnvVar: "PLUGIN_EXCLUDE",
+		},
+		cli.StringSliceFlag{
+			Name:   "wars",
+			Usage:  "war files to package for tomcat as context=path pairs",
+			EnvVar: "PLUGIN_WARS",
+		},
+		cli.StringSliceFlag{
+			Name:   "dotnet-sites",
+			Usage:  "published .net sites to package for windows server as iis-path=path pairs",
+			EnvVar: "PLUGIN_DOTNET_SITES",
+		},
+		cli.StringFlag{
+			Name:   "dotnet-deployment",
+			Usage:  "windows deployment type of the sites (aspNetCoreWeb or msDeploy)",
+			Value:  dotNetCore,
+			EnvVar: "PLUGIN_DOTNET_DEPLOYMENT",
+		},
+		cli.StringFlag{
+			Name:   "iis-website",
+			Usage:  "iis web site the .net sites are deployed to",
+			Value:  defaultWebSite,
+			EnvVar: "PLUGIN_IIS_WEBSITE",
+		},
+		cli.StringFlag{
+			Name:   "binary",
+			Usage:  "go binary or java se jar to package",
+			EnvVar: "PLUGIN_BINARY",
+		},
+		cli.StringFlag{
+			Name:   "procfile",
+			Usage:  "procfile packaged with the binary",
+			EnvVar: "PLUGIN_PROCFILE",
+		},
+		cli.StringFlag{
+			Name:   "rollout",
+			Usage:  "stages of environments updated in order",
+			EnvVar: "PLUGIN_ROLLOUT",
+		},
+		cli.StringSliceFlag{
+			Name:   "fleet",
+			Usage:  "environments rolled out to in waves",
+			EnvVar: "PLUGIN_FLEET",
+		},
+		cli.StringFlag{
+			Name:   "fleet-tag",
+			Usage:  "tag (key or key=value) of the environments rolled out to in waves",
+			EnvVar: "PLUGIN_FLEET_TAG",
+		},
+		cli.IntSliceFlag{
+			Name:   "waves",
+			Usage:  "cumulative percentages of the fleet updated by each wave",
+			EnvVar: "PLUGIN_WAVES",
+		},
+		cli.StringFlag{
+			Name:   "wave-parallel",
+			Usage:  "update the environments of a wave in parallel",
+			EnvVar: "PLUGIN_WAVE_PARALLEL",
+		},
+		cli.StringFlag{
+			Name:   "wave-bake",
+			Usage:  "how long to wait between waves",
+			EnvVar: "PLUGIN_WAVE_BAKE",
+		},
+		cli.Float64Flag{
+			Name:   "max-stage-failures",
+			Usage:  "percentage of environments of a stage that may fail before the rollout pauses",
+			EnvVar: "PLUGIN_MAX_STAGE_FAILURES",
+		},
+		cli.StringFlag{
+			Name:   "state-file",
+			Usage:  "file the state of a paused rollout is written to",
+			EnvVar: "PLUGIN_STATE_FILE",
+		},
+		cli.StringFlag{
+			Name:   "action",
+			Usage:  "action to run (deploy, resume, configure, report, verify, mark-bad, mark-good or serve)",
+			Value:  actionDeploy,
+			EnvVar: "PLUGIN_ACTION",
+		},
+		cli.StringFlag{
+			Name:   "deployments",
+			Usage:  "application, environment and bundle tuples deployed in order",
+			EnvVar: "PLUGIN_DEPLOYMENTS",
+		},
+		cli.StringFlag{
+			Name:   "deployments-file",
+			Usage:  "json file with the deployments",
+			EnvVar: "PLUGIN_DEPLOYMENTS_FILE",
+		},
+		cli.StringSliceFlag{
+			Name:   "versions",
+			Usage:  "bundles registered as versions and deployed as bundle=label@environment entries",
+			EnvVar: "PLUGIN_VERSIONS",
+		},
+		cli.StringFlag{
+			Name:   "presign-expiry",
+			Usage:  "log a presigned download url of the bundle valid this long (e.g. 24h)",
+			EnvVar: "PLUGIN_PRESIGN_EXPIRY",
+		},
+		cli.StringFlag{
+			Name:   "provenance",
+			Usage:  "record the bundle digest, commit, builder and pipeline with the version",
+			EnvVar: "PLUGIN_PROVENANCE",
+		},
+		cli.StringFlag{
+			Name:   "signing-key",
+			Usage:  "kms key signing uploaded bundles and verifying deployed ones",
+			EnvVar: "PLUGIN_SIGNING_KEY",
+		},
+		cli.StringFlag{
+			Name:   "signing-algorithm",
+			Usage:  "kms signing algorithm of the key",
+			Value:  "ECDSA_SHA_256",
+			EnvVar: "PLUGIN_SIGNING_ALGORITHM",
+		},
+		cli.StringFlag{
+			Name:   "verify-signature",
+			Usage:  "refuse to deploy a version whose bundle signature does not verify",
+			EnvVar: "PLUGIN_VERIFY_SIGNATURE",
+		},
+		cli.StringFlag{
+			Name:   "reuse-bundles",
+			Usage:  "reuse the version of an identical bundle instead of creating a new one",
+			EnvVar: "PLUGIN_REUSE_BUNDLES",
+		},
+		cli.StringSliceFlag{
+			Name:   "nginx-configs",
+			Usage:  "nginx configuration files injected into .platform/nginx/conf.d of the bundle",
+			EnvVar: "PLUGIN_NGINX_CONFIGS",
+		},
 		cli.StringFlag{
 			Name:   "application",
 			Usage:  "application name for beanstalk",
@@ -56,16 +233,25 @@ func main() {
 			Usage:  "environment name in the app to update",
 			EnvVar: "PLUGIN_ENVIRONMENT_NAME",
 		},
+		cli.StringSliceFlag{
+			Name:   "environments",
+			Usage:  "environment names in the app to update",
+			EnvVar: "PLUGIN_ENVIRONMENTS",
+		},
+		cli.StringFlag{
+			Name:   "parallel",
+			Usage:  "update the environments in parallel",
+			EnvVar: "PLUGIN_PARALLEL",
+		},
 		cli.StringFlag{
 			Name:   "version-label",
-			Usage:  "version label for the app",
+			Usage:  "version label for the app, a template of the build metadata",
 			EnvVar: "PLUGIN_VERSION_LABEL",
 		},
 		cli.StringFlag{
 			Name:   "description",
 			Usage:  "description for the app version",
 			EnvVar: "PLUGIN_DESCRIPTION",
-			Value:  "Update from quintoandar/drone-elasticbeanstalk plugin",
 		},
 		cli.StringFlag{
 			Name:   "auto-create",
@@ -77,49 +263,1486 @@ func main() {
 			Usage:  "Preprocess and validate manifest",
 			EnvVar: "PLUGIN_PROCESS",
 		},
+		cli.IntFlag{
+			Name:   "lifecycle-max-count",
+			Usage:  "number of application versions beanstalk keeps",
+			EnvVar: "PLUGIN_LIFECYCLE_MAX_COUNT",
+		},
+		cli.IntFlag{
+			Name:   "lifecycle-max-age",
+			Usage:  "days beanstalk keeps application versions",
+			EnvVar: "PLUGIN_LIFECYCLE_MAX_AGE",
+		},
+		cli.StringFlag{
+			Name:   "lifecycle-delete-source",
+			Usage:  "delete the source bundles of the versions beanstalk deletes",
+			EnvVar: "PLUGIN_LIFECYCLE_DELETE_SOURCE",
+		},
+		cli.StringFlag{
+			Name:   "lifecycle-service-role",
+			Usage:  "service role beanstalk deletes versions with",
+			EnvVar: "PLUGIN_LIFECYCLE_SERVICE_ROLE",
+		},
+		cli.IntFlag{
+			Name:   "keep-versions",
+			Usage:  "number of most recent application versions kept after a successful deploy, 0 keeps all",
+			EnvVar: "PLUGIN_KEEP_VERSIONS",
+		},
+		cli.StringFlag{
+			Name:   "delete-source-bundles",
+			Usage:  "also delete the source bundles of pruned versions",
+			EnvVar: "PLUGIN_DELETE_SOURCE_BUNDLES",
+		},
+		cli.StringFlag{
+			Name:   "poll-interval",
+			Usage:  "interval between polls of the environments, backing off from it while nothing happens",
+			EnvVar: "PLUGIN_POLL_INTERVAL",
+		},
+		cli.StringFlag{
+			Name:   "poll-jitter",
+			Usage:  "maximum random delay added to every poll",
+			EnvVar: "PLUGIN_POLL_JITTER",
+		},
+		cli.StringFlag{
+			Name:   "process-timeout",
+			Usage:  "how long to wait for a processed version to be validated",
+			Value:  "5m",
+			EnvVar: "PLUGIN_PROCESS_TIMEOUT",
+		},
+		cli.StringFlag{
+			Name:   "auto-suffix",
+			Usage:  "suffix the version label when it already exists for a different bundle",
+			EnvVar: "PLUGIN_AUTO_SUFFIX",
+		},
+		cli.StringFlag{
+			Name:   "on-existing-version",
+			Usage:  "what to do when the version label already exists (reuse, fail or recreate)",
+			EnvVar: "PLUGIN_ON_EXISTING_VERSION",
+		},
+		cli.StringFlag{
+			Name:   "xray",
+			Usage:  "enable or disable the aws x-ray daemon",
+			EnvVar: "PLUGIN_XRAY",
+		},
+		cli.StringFlag{
+			Name:   "stream-logs",
+			Usage:  "enable or disable cloudwatch log streaming",
+			EnvVar: "PLUGIN_STREAM_LOGS",
+		},
+		cli.IntFlag{
+			Name:   "log-retention-days",
+			Usage:  "retention in days of the streamed cloudwatch logs",
+			EnvVar: "PLUGIN_LOG_RETENTION_DAYS",
+		},
+		cli.StringFlag{
+			Name:   "rolling-update",
+			Usage:  "enable or disable rolling configuration updates",
+			EnvVar: "PLUGIN_ROLLING_UPDATE",
+		},
+		cli.StringFlag{
+			Name:   "rolling-update-type",
+			Usage:  "rolling configuration update type (Time, Health or Immutable)",
+			EnvVar: "PLUGIN_ROLLING_UPDATE_TYPE",
+		},
+		cli.IntFlag{
+			Name:   "rolling-update-max-batch-size",
+			Usage:  "maximum number of instances replaced at once",
+			EnvVar: "PLUGIN_ROLLING_UPDATE_MAX_BATCH_SIZE",
+		},
+		cli.IntFlag{
+			Name:   "rolling-update-min-in-service",
+			Usage:  "minimum number of instances kept in service",
+			EnvVar: "PLUGIN_ROLLING_UPDATE_MIN_IN_SERVICE",
+		},
+		cli.StringFlag{
+			Name:   "rolling-update-pause-time",
+			Usage:  "pause between batches of time based rolling updates (e.g. 5m)",
+			EnvVar: "PLUGIN_ROLLING_UPDATE_PAUSE_TIME",
+		},
+		cli.StringFlag{
+			Name:   "deployment-policy",
+			Usage:  "deployment policy (AllAtOnce, Rolling, RollingWithAdditionalBatch, Immutable or TrafficSplitting)",
+			EnvVar: "PLUGIN_DEPLOYMENT_POLICY",
+		},
+		cli.IntFlag{
+			Name:   "batch-size",
+			Usage:  "instances, or percentage of them, deployed to per batch",
+			EnvVar: "PLUGIN_BATCH_SIZE",
+		},
+		cli.StringFlag{
+			Name:   "batch-size-type",
+			Usage:  "whether the batch size is a Percentage or Fixed",
+			EnvVar: "PLUGIN_BATCH_SIZE_TYPE",
+		},
+		cli.IntFlag{
+			Name:   "canary-percent",
+			Usage:  "percentage of the traffic sent to the new version with traffic splitting",
+			EnvVar: "PLUGIN_CANARY_PERCENT",
+		},
+		cli.StringFlag{
+			Name:   "canary-duration",
+			Usage:  "how long the canary is evaluated before it is promoted (e.g. 10m)",
+			EnvVar: "PLUGIN_CANARY_DURATION",
+		},
+		cli.StringFlag{
+			Name:   "health-reporting",
+			Usage:  "health reporting system (basic or enhanced)",
+			EnvVar: "PLUGIN_HEALTH_REPORTING",
+		},
+		cli.StringFlag{
+			Name:   "health-success-threshold",
+			Usage:  "lowest health passing the health checks (Ok, Warning, Degraded or Severe)",
+			EnvVar: "PLUGIN_HEALTH_SUCCESS_THRESHOLD",
+		},
+		cli.StringFlag{
+			Name:   "health-config-document",
+			Usage:  "enhanced health config document as json",
+			EnvVar: "PLUGIN_HEALTH_CONFIG_DOCUMENT",
+		},
+		cli.StringSliceFlag{
+			Name:   "health-ignore",
+			Usage:  "enhanced health rules to disable (application-4xx, load-balancer-4xx)",
+			EnvVar: "PLUGIN_HEALTH_IGNORE",
+		},
+		cli.StringFlag{
+			Name:   "template-name",
+			Usage:  "saved configuration template environments are created and updated with",
+			EnvVar: "PLUGIN_TEMPLATE_NAME",
+		},
+		cli.StringFlag{
+			Name:   "template-file",
+			Usage:  "json or yaml file of option settings saved as the template before the deploy",
+			EnvVar: "PLUGIN_TEMPLATE_FILE",
+		},
+		cli.StringFlag{
+			Name:   "option-settings-file",
+			Usage:  "json or yaml file of option settings applied with the update",
+			EnvVar: "PLUGIN_OPTION_SETTINGS_FILE",
+		},
+		cli.StringFlag{
+			Name:   "env-vars",
+			Usage:  "environment variables set on the environment as KEY=value pairs or json",
+			EnvVar: "PLUGIN_ENV_VARS",
+		},
+		cli.StringFlag{
+			Name:   "tags",
+			Usage:  "tags of the application version and environments as KEY=value pairs or json",
+			EnvVar: "PLUGIN_TAGS",
+		},
+		cli.StringSliceFlag{
+			Name:   "remove-env-vars",
+			Usage:  "environment variables removed from the environment",
+			EnvVar: "PLUGIN_REMOVE_ENV_VARS",
+		},
+		cli.StringSliceFlag{
+			Name:   "visible-env-vars",
+			Usage:  "environment variable name patterns whose values are shown in the diff",
+			EnvVar: "PLUGIN_VISIBLE_ENV_VARS",
+		},
+		cli.StringFlag{
+			Name:   "managed-by-tag",
+			Usage:  "environment tag marking externally managed environments whose option settings are left alone",
+			Value:  "managed-by",
+			EnvVar: "PLUGIN_MANAGED_BY_TAG",
+		},
+		cli.StringFlag{
+			Name:   "ignore-managed-by",
+			Usage:  "change option settings of externally managed environments",
+			EnvVar: "PLUGIN_IGNORE_MANAGED_BY",
+		},
 		cli.StringFlag{
 			Name:   "environment-update",
 			Usage:  "update the environment",
 			EnvVar: "PLUGIN_ENVIRONMENT_UPDATE",
 		},
 		cli.StringFlag{
-			Name:   "timeout",
-			Usage:  "deploy timeout in minutes",
-			Value:  "30",
-			EnvVar: "PLUGIN_TIMEOUT",
+			Name:   "auto-create-environment",
+			Usage:  "create the environment if it doesn't exist",
+			EnvVar: "PLUGIN_AUTO_CREATE_ENVIRONMENT",
 		},
-	}
-	if err := app.Run(os.Args); err != nil {
-		log.Fatal(err)
-	}
-}
-func run(c *cli.Context) error {
-
-	timeout, err := strconv.Atoi(c.String("timeout"))
-
-	if err != nil {
-		log.WithFields(log.Fields{
-			"timeout": c.String("timeout"),
-			"error":   err,
-		}).Error("invalid timeout configuration")
-		return err
-	}
-
-	plugin := Plugin{
-		Region:            c.String("region"),
-		Key:               c.String("access-key"),
-		Secret:            c.String("secret-key"),
-		Bucket:            c.String("bucket"),
-		BucketKey:         c.String("bucket-key"),
-		Application:       c.String("application"),
-		EnvironmentName:   c.String("environment-name"),
-		VersionLabel:      c.String("version-label"),
-		Description:       c.String("description"),
-		AutoCreate:        c.Bool("auto-create"),
-		Process:           c.Bool("process"),
-		EnvironmentUpdate: c.Bool("environment-update"),
-		Timeout:           time.Duration(timeout) * time.Minute,
-	}
-
-	return plugin.Exec()
+		cli.StringFlag{
+			Name:   "solution-stack",
+			Usage:  "solution stack of created environments",
+			EnvVar: "PLUGIN_SOLUTION_STACK",
+		},
+		cli.StringFlag{
+			Name:   "platform-arn",
+			Usage:  "platform arn of created environments, instead of the solution stack",
+			EnvVar: "PLUGIN_PLATFORM_ARN",
+		},
+		cli.StringFlag{
+			Name:   "tier",
+			Usage:  "tier of created environments (WebServer or Worker)",
+			Value:  tierWebServer,
+			EnvVar: "PLUGIN_TIER",
+		},
+		cli.StringFlag{
+			Name:   "cname-prefix",
+			Usage:  "cname prefix of created environments",
+			EnvVar: "PLUGIN_CNAME_PREFIX",
+		},
+		cli.StringFlag{
+			Name:   "key-pair",
+			Usage:  "ec2 key pair of created environments",
+			EnvVar: "PLUGIN_KEY_PAIR",
+		},
+		cli.StringFlag{
+			Name:   "instance-profile",
+			Usage:  "iam instance profile of the environment instances",
+			EnvVar: "PLUGIN_INSTANCE_PROFILE",
+		},
+		cli.StringFlag{
+			Name:   "instance-type",
+			Usage:  "ec2 instance type of the environment instances",
+			EnvVar: "PLUGIN_INSTANCE_TYPE",
+		},
+		cli.StringFlag{
+			Name:   "root-volume-type",
+			Usage:  "root volume type of the environment instances (standard, gp2, gp3 or io1)",
+			EnvVar: "PLUGIN_ROOT_VOLUME_TYPE",
+		},
+		cli.IntFlag{
+			Name:   "root-volume-size",
+			Usage:  "root volume size in GB of the environment instances",
+			EnvVar: "PLUGIN_ROOT_VOLUME_SIZE",
+		},
+		cli.StringSliceFlag{
+			Name:   "security-groups",
+			Usage:  "security groups of the environment instances",
+			EnvVar: "PLUGIN_SECURITY_GROUPS",
+		},
+		cli.StringFlag{
+			Name:   "service-role",
+			Usage:  "service role of created environments",
+			EnvVar: "PLUGIN_SERVICE_ROLE",
+		},
+		cli.IntFlag{
+			Name:   "warmup-requests",
+			Usage:  "warm-up requests sent to the updated environment",
+			EnvVar: "PLUGIN_WARMUP_REQUESTS",
+		},
+		cli.StringSliceFlag{
+			Name:   "warmup-paths",
+			Usage:  "paths requested to warm up the environment",
+			EnvVar: "PLUGIN_WARMUP_PATHS",
+		},
+		cli.IntFlag{
+			Name:   "warmup-concurrency",
+			Usage:  "concurrent warm-up requests",
+			Value:  4,
+			EnvVar: "PLUGIN_WARMUP_CONCURRENCY",
+		},
+		cli.StringFlag{
+			Name:   "checks",
+			Usage:  "http checks run against the updated environment",
+			EnvVar: "PLUGIN_CHECKS",
+		},
+		cli.StringFlag{
+			Name:   "check-timeout",
+			Usage:  "how long to retry failing http checks",
+			Value:  "2m",
+			EnvVar: "PLUGIN_CHECK_TIMEOUT",
+		},
+		cli.StringFlag{
+			Name:   "smoke-test",
+			Usage:  "probe the health url once the environment is updated",
+			EnvVar: "PLUGIN_SMOKE_TEST",
+		},
+		cli.StringFlag{
+			Name:   "health-url",
+			Usage:  "url, or path of the environment cname, probed by the smoke test",
+			Value:  "/",
+			EnvVar: "PLUGIN_HEALTH_URL",
+		},
+		cli.IntFlag{
+			Name:   "health-status",
+			Usage:  "status code expected from the health url",
+			Value:  200,
+			EnvVar: "PLUGIN_HEALTH_STATUS",
+		},
+		cli.StringFlag{
+			Name:   "health-body",
+			Usage:  "regular expression the health url response must match",
+			EnvVar: "PLUGIN_HEALTH_BODY",
+		},
+		cli.IntFlag{
+			Name:   "health-attempts",
+			Usage:  "attempts of the smoke test before the step fails",
+			Value:  10,
+			EnvVar: "PLUGIN_HEALTH_ATTEMPTS",
+		},
+		cli.StringFlag{
+			Name:   "version-path",
+			Usage:  "endpoint reporting the version served by an instance",
+			EnvVar: "PLUGIN_VERSION_PATH",
+		},
+		cli.StringFlag{
+			Name:   "version-json-path",
+			Usage:  "jsonpath of the version in the version endpoint response",
+			EnvVar: "PLUGIN_VERSION_JSON_PATH",
+		},
+		cli.IntFlag{
+			Name:   "version-samples",
+			Usage:  "requests that must all report the new version",
+			Value:  10,
+			EnvVar: "PLUGIN_VERSION_SAMPLES",
+		},
+		cli.StringFlag{
+			Name:   "version-timeout",
+			Usage:  "how long to wait for every instance to serve the new version",
+			Value:  "5m",
+			EnvVar: "PLUGIN_VERSION_TIMEOUT",
+		},
+		cli.StringSliceFlag{
+			Name:   "alarms",
+			Usage:  "cloudwatch alarms failing the deploy when they go off",
+			EnvVar: "PLUGIN_ALARMS",
+		},
+		cli.StringFlag{
+			Name:   "alarm-window",
+			Usage:  "how long to watch the alarms after the deploy",
+			Value:  "5m",
+			EnvVar: "PLUGIN_ALARM_WINDOW",
+		},
+		cli.StringFlag{
+			Name:   "metrics-window",
+			Usage:  "how long to watch the error rate and latency after the deploy",
+			EnvVar: "PLUGIN_METRICS_WINDOW",
+		},
+		cli.Float64Flag{
+			Name:   "max-error-rate",
+			Usage:  "percentage of 5xx responses rolling the deploy back",
+			Value:  5,
+			EnvVar: "PLUGIN_MAX_ERROR_RATE",
+		},
+		cli.StringFlag{
+			Name:   "max-latency",
+			Usage:  "p99 latency rolling the deploy back",
+			EnvVar: "PLUGIN_MAX_LATENCY",
+		},
+		cli.StringFlag{
+			Name:   "metrics-baseline",
+			Usage:  "compare the metrics against a baseline captured before the deploy",
+			EnvVar: "PLUGIN_METRICS_BASELINE",
+		},
+		cli.Float64Flag{
+			Name:   "max-latency-factor",
+			Usage:  "multiple of the baseline p99 latency rolling the deploy back",
+			Value:  1.5,
+			EnvVar: "PLUGIN_MAX_LATENCY_FACTOR",
+		},
+		cli.StringFlag{
+			Name:   "verify-dns",
+			Usage:  "wait for the public name to resolve to the environment",
+			EnvVar: "PLUGIN_VERIFY_DNS",
+		},
+		cli.StringFlag{
+			Name:   "dns-name",
+			Usage:  "public name of the environment, defaults to its cname",
+			EnvVar: "PLUGIN_DNS_NAME",
+		},
+		cli.StringSliceFlag{
+			Name:   "dns-resolvers",
+			Usage:  "name servers queried for the public name",
+			Value:  &cli.StringSlice{"8.8.8.8", "1.1.1.1", "9.9.9.9"},
+			EnvVar: "PLUGIN_DNS_RESOLVERS",
+		},
+		cli.StringFlag{
+			Name:   "dns-timeout",
+			Usage:  "how long to wait for dns to propagate",
+			Value:  "10m",
+			EnvVar: "PLUGIN_DNS_TIMEOUT",
+		},
+		cli.StringFlag{
+			Name:   "wait-for-health",
+			Usage:  "wait for the enhanced health after the update",
+			EnvVar: "PLUGIN_WAIT_FOR_HEALTH",
+		},
+		cli.StringFlag{
+			Name:   "health-color",
+			Usage:  "lowest health color passing the health wait (Green or Yellow)",
+			Value:  elasticbeanstalk.EnvironmentHealthGreen,
+			EnvVar: "PLUGIN_HEALTH_COLOR",
+		},
+		cli.IntFlag{
+			Name:   "health-checks",
+			Usage:  "consecutive passing health checks required",
+			Value:  3,
+			EnvVar: "PLUGIN_HEALTH_CHECKS",
+		},
+		cli.StringFlag{
+			Name:   "health-timeout",
+			Usage:  "how long to wait for the environment to be healthy",
+			Value:  "10m",
+			EnvVar: "PLUGIN_HEALTH_TIMEOUT",
+		},
+		cli.StringFlag{
+			Name:   "deploy-strategy",
+			Usage:  "how environments are updated (in-place or blue-green)",
+			Value:  strategyInPlace,
+			EnvVar: "PLUGIN_DEPLOY_STRATEGY",
+		},
+		cli.StringFlag{
+			Name:   "green-environment",
+			Usage:  "name of the idle environment of blue/green deploys",
+			EnvVar: "PLUGIN_GREEN_ENVIRONMENT",
+		},
+		cli.StringFlag{
+			Name:   "live-cname",
+			Usage:  "cname prefix serving production in blue/green deploys",
+			EnvVar: "PLUGIN_LIVE_CNAME",
+		},
+		cli.StringFlag{
+			Name:   "green-template",
+			Usage:  "saved configuration the idle environment is created from",
+			EnvVar: "PLUGIN_GREEN_TEMPLATE",
+		},
+		cli.StringFlag{
+			Name:   "terminate-old",
+			Usage:  "terminate the old environment after a blue/green swap",
+			EnvVar: "PLUGIN_TERMINATE_OLD",
+		},
+		cli.StringFlag{
+			Name:   "terminate-grace",
+			Usage:  "how long to wait before terminating the old environment",
+			EnvVar: "PLUGIN_TERMINATE_GRACE",
+		},
+		cli.StringFlag{
+			Name:   "review-app",
+			Usage:  "deploy pull requests to their own environments",
+			EnvVar: "PLUGIN_REVIEW_APP",
+		},
+		cli.StringFlag{
+			Name:   "review-app-prefix",
+			Usage:  "prefix of the review app environment names",
+			EnvVar: "PLUGIN_REVIEW_APP_PREFIX",
+		},
+		cli.StringFlag{
+			Name:   "review-app-action",
+			Usage:  "review app action (deploy or cleanup)",
+			Value:  reviewActionDeploy,
+			EnvVar: "PLUGIN_REVIEW_APP_ACTION",
+		},
+		cli.StringFlag{
+			Name:   "review-app-scale-down",
+			Usage:  "cron expression in utc scaling review apps to zero instances",
+			EnvVar: "PLUGIN_REVIEW_APP_SCALE_DOWN",
+		},
+		cli.StringFlag{
+			Name:   "review-app-scale-up",
+			Usage:  "cron expression in utc scaling review apps back up",
+			EnvVar: "PLUGIN_REVIEW_APP_SCALE_UP",
+		},
+		cli.IntFlag{
+			Name:   "review-app-capacity",
+			Usage:  "instances of review apps once scaled back up",
+			Value:  1,
+			EnvVar: "PLUGIN_REVIEW_APP_CAPACITY",
+		},
+		cli.StringFlag{
+			Name:   "github-token",
+			Usage:  "github token posting the review app url on the pull request",
+			EnvVar: "PLUGIN_GITHUB_TOKEN,GITHUB_TOKEN",
+		},
+		cli.StringFlag{
+			Name:   "github-url",
+			Usage:  "github api url",
+			Value:  githubURL,
+			EnvVar: "PLUGIN_GITHUB_URL",
+		},
+		cli.StringSliceFlag{
+			Name:   "deploy-windows",
+			Usage:  "cron-like expressions of the minutes deploys are allowed in (e.g. \"* 9-16 * * 1-5\")",
+			EnvVar: "PLUGIN_DEPLOY_WINDOWS",
+		},
+		cli.StringFlag{
+			Name:   "deploy-window-timezone",
+			Usage:  "timezone of the deploy windows",
+			Value:  "UTC",
+			EnvVar: "PLUGIN_DEPLOY_WINDOW_TIMEZONE",
+		},
+		cli.StringFlag{
+			Name:   "wait-for-window",
+			Usage:  "wait for the next deploy window instead of failing",
+			EnvVar: "PLUGIN_WAIT_FOR_WINDOW",
+		},
+		cli.StringFlag{
+			Name:   "freeze-tag",
+			Usage:  "environment tag that blocks deploys",
+			EnvVar: "PLUGIN_FREEZE_TAG",
+		},
+		cli.StringFlag{
+			Name:   "stale-guard",
+			Usage:  "refuse to deploy builds older than the deployed one",
+			EnvVar: "PLUGIN_STALE_GUARD",
+		},
+		cli.StringFlag{
+			Name:   "build-pattern",
+			Usage:  "regular expression capturing the build number of version labels",
+			Value:  defaultBuildPattern,
+			EnvVar: "PLUGIN_BUILD_PATTERN",
+		},
+		cli.StringFlag{
+			Name:   "serve-addr",
+			Usage:  "address the serve action listens on",
+			Value:  ":8080",
+			EnvVar: "PLUGIN_SERVE_ADDR",
+		},
+		cli.StringFlag{
+			Name:   "serve-token",
+			Usage:  "bearer token the requests to the serve action authenticate with",
+			EnvVar: "PLUGIN_SERVE_TOKEN,SERVE_TOKEN",
+		},
+		cli.StringFlag{
+			Name:   "terraform-outputs",
+			Usage:  "terraform output -json file the application, environments and bucket are read from",
+			EnvVar: "PLUGIN_TERRAFORM_OUTPUTS",
+		},
+		cli.StringFlag{
+			Name:   "stack",
+			Usage:  "cloudformation stack the application, environments and bucket are read from",
+			EnvVar: "PLUGIN_STACK",
+		},
+		cli.StringSliceFlag{
+			Name:   "output-names",
+			Usage:  "outputs of the application, environments and bucket as setting=output",
+			EnvVar: "PLUGIN_OUTPUT_NAMES",
+		},
+		cli.StringSliceFlag{
+			Name:   "chaos",
+			Usage:  "simulate failures to test the pipeline (throttle, timeout or red-health)",
+			EnvVar: "PLUGIN_CHAOS",
+			Hidden: true,
+		},
+		cli.StringFlag{
+			Name:   "allow-known-bad",
+			Usage:  "deploy versions the history marks as bad for the environment",
+			EnvVar: "PLUGIN_ALLOW_KNOWN_BAD",
+		},
+		cli.StringFlag{
+			Name:   "force",
+			Usage:  "deploy even when the guards would refuse to",
+			EnvVar: "PLUGIN_FORCE",
+		},
+		cli.StringFlag{
+			Name:   "min-health",
+			Usage:  "health the environment needs before the update (Green or Yellow)",
+			EnvVar: "PLUGIN_MIN_HEALTH",
+		},
+		cli.IntFlag{
+			Name:   "min-healthy-instances",
+			Usage:  "healthy instances the environment needs before the update",
+			EnvVar: "PLUGIN_MIN_HEALTHY_INSTANCES",
+		},
+		cli.StringFlag{
+			Name:   "no-managed-actions",
+			Usage:  "refuse to deploy while a managed action is running",
+			EnvVar: "PLUGIN_NO_MANAGED_ACTIONS",
+		},
+		cli.StringFlag{
+			Name:   "no-alarms",
+			Usage:  "refuse to deploy while one of the alarms is in alarm",
+			EnvVar: "PLUGIN_NO_ALARMS",
+		},
+		cli.StringFlag{
+			Name:   "concurrency-window",
+			Usage:  "fail when another build started deploying to the environment this recently",
+			EnvVar: "PLUGIN_CONCURRENCY_WINDOW",
+		},
+		cli.StringFlag{
+			Name:   "wait-for-concurrent",
+			Usage:  "wait for deploys of other builds to complete instead of failing",
+			EnvVar: "PLUGIN_WAIT_FOR_CONCURRENT",
+		},
+		cli.StringSliceFlag{
+			Name:   "approval-environments",
+			Usage:  "environment patterns waiting for the approval before deploying",
+			EnvVar: "PLUGIN_APPROVAL_ENVIRONMENTS",
+		},
+		cli.StringFlag{
+			Name:   "approval-file",
+			Usage:  "file whose existence approves the deploy",
+			EnvVar: "PLUGIN_APPROVAL_FILE",
+		},
+		cli.StringFlag{
+			Name:   "approval-url",
+			Usage:  "url answering 200 once the deploy is approved",
+			EnvVar: "PLUGIN_APPROVAL_URL",
+		},
+		cli.StringFlag{
+			Name:   "approval-parameter",
+			Usage:  "ssm parameter approving the deploy",
+			EnvVar: "PLUGIN_APPROVAL_PARAMETER",
+		},
+		cli.StringFlag{
+			Name:   "approval-value",
+			Usage:  "ssm parameter value approving the deploy",
+			Value:  "approved",
+			EnvVar: "PLUGIN_APPROVAL_VALUE",
+		},
+		cli.StringFlag{
+			Name:   "approval-timeout",
+			Usage:  "how long to wait for the approval",
+			Value:  "1h",
+			EnvVar: "PLUGIN_APPROVAL_TIMEOUT",
+		},
+		cli.StringSliceFlag{
+			Name:   "pre-upload",
+			Usage:  "commands or URLs run before the artifact is uploaded",
+			EnvVar: "PLUGIN_PRE_UPLOAD",
+		},
+		cli.StringSliceFlag{
+			Name:   "pre-update",
+			Usage:  "commands or URLs run before each environment is updated",
+			EnvVar: "PLUGIN_PRE_UPDATE",
+		},
+		cli.StringSliceFlag{
+			Name:   "post-update",
+			Usage:  "commands or URLs run after each environment is updated and verified",
+			EnvVar: "PLUGIN_POST_UPDATE",
+		},
+		cli.StringSliceFlag{
+			Name:   "on-failure",
+			Usage:  "commands or URLs run when the deploy fails",
+			EnvVar: "PLUGIN_ON_FAILURE",
+		},
+		cli.StringFlag{
+			Name:   "migration",
+			Usage:  "command run once per version before the environments are updated",
+			EnvVar: "PLUGIN_MIGRATION",
+		},
+		cli.StringFlag{
+			Name:   "migration-timeout",
+			Usage:  "how long to wait for the migration of another deploy",
+			Value:  "30m",
+			EnvVar: "PLUGIN_MIGRATION_TIMEOUT",
+		},
+		cli.StringFlag{
+			Name:   "api-timeout",
+			Usage:  "timeout of every single aws api call",
+			Value:  "1m",
+			EnvVar: "PLUGIN_API_TIMEOUT",
+		},
+		cli.StringSliceFlag{
+			Name:   "api-timeouts",
+			Usage:  "timeouts of single aws api operations as Operation=duration pairs",
+			Value:  &cli.StringSlice{"PutObject=30m", "UploadPart=30m"},
+			EnvVar: "PLUGIN_API_TIMEOUTS",
+		},
+		cli.StringFlag{
+			Name:   "timeout",
+			Usage:  "deploy timeout in minutes",
+			Value:  "30",
+			EnvVar: "PLUGIN_TIMEOUT",
+		},
+		cli.StringFlag{
+			Name:   "stall-window",
+			Usage:  "fail when the environment keeps updating without new events for this long (e.g. 10m)",
+			EnvVar: "PLUGIN_STALL_WINDOW",
+		},
+		cli.StringFlag{
+			Name:   "abort-on-stall",
+			Usage:  "abort the environment update when it stalls",
+			EnvVar: "PLUGIN_ABORT_ON_STALL",
+		},
+		cli.StringFlag{
+			Name:   "abort-on-cancel",
+			Usage:  "abort the environment updates in flight when the build is cancelled",
+			EnvVar: "PLUGIN_ABORT_ON_CANCEL",
+		},
+		cli.StringFlag{
+			Name:   "auto-rollback",
+			Usage:  "abort stalled or failing updates and roll back to the previous version",
+			EnvVar: "PLUGIN_AUTO_ROLLBACK",
+		},
+		cli.StringFlag{
+			Name:   "grafana-url",
+			Usage:  "grafana url to post deploy annotations to",
+			EnvVar: "PLUGIN_GRAFANA_URL",
+		},
+		cli.StringFlag{
+			Name:   "grafana-token",
+			Usage:  "grafana api token",
+			EnvVar: "PLUGIN_GRAFANA_TOKEN,GRAFANA_TOKEN",
+		},
+		cli.StringSliceFlag{
+			Name:   "grafana-tags",
+			Usage:  "additional tags for the grafana annotations",
+			EnvVar: "PLUGIN_GRAFANA_TAGS",
+		},
+		cli.StringSliceFlag{
+			Name:   "production-environments",
+			Usage:  "glob patterns of production environments (defaults to all)",
+			EnvVar: "PLUGIN_PRODUCTION_ENVIRONMENTS",
+		},
+		cli.StringFlag{
+			Name:   "pagerduty-routing-key",
+			Usage:  "pagerduty routing key for change events",
+			EnvVar: "PLUGIN_PAGERDUTY_ROUTING_KEY,PAGERDUTY_ROUTING_KEY",
+		},
+		cli.StringFlag{
+			Name:   "opsgenie-api-key",
+			Usage:  "opsgenie api key for alerts on failed production deploys",
+			EnvVar: "PLUGIN_OPSGENIE_API_KEY,OPSGENIE_API_KEY",
+		},
+		cli.StringFlag{
+			Name:   "opsgenie-url",
+			Usage:  "opsgenie api url",
+			Value:  opsgenieURL,
+			EnvVar: "PLUGIN_OPSGENIE_URL",
+		},
+		cli.StringFlag{
+			Name:   "opsgenie-priority",
+			Usage:  "priority of the opsgenie alerts",
+			Value:  "P5",
+			EnvVar: "PLUGIN_OPSGENIE_PRIORITY",
+		},
+		cli.StringFlag{
+			Name:   "jira-cloud-id",
+			Usage:  "jira cloud id to push deployment information to",
+			EnvVar: "PLUGIN_JIRA_CLOUD_ID",
+		},
+		cli.StringFlag{
+			Name:   "jira-token",
+			Usage:  "jira oauth access token",
+			EnvVar: "PLUGIN_JIRA_TOKEN,JIRA_TOKEN",
+		},
+		cli.StringFlag{
+			Name:   "jira-url",
+			Usage:  "jira api url",
+			Value:  jiraURL,
+			EnvVar: "PLUGIN_JIRA_URL",
+		},
+		cli.StringFlag{
+			Name:   "history",
+			Usage:  "deployment history store (path of a json lines file or s3://bucket/key)",
+			EnvVar: "PLUGIN_HISTORY",
+		},
+		cli.StringFlag{
+			Name:   "audit",
+			Usage:  "record the intended change in the history store without applying it",
+			EnvVar: "PLUGIN_AUDIT",
+		},
+		cli.StringFlag{
+			Name:   "report-format",
+			Usage:  "format of the final deploy report (table or json, or markdown for the report action)",
+			Value:  "table",
+			EnvVar: "PLUGIN_REPORT_FORMAT",
+		},
+		cli.StringFlag{
+			Name:   "status-file",
+			Usage:  "file the outcome of the run is written to as json",
+			EnvVar: "PLUGIN_STATUS_FILE,STATUS_FILE",
+		},
+		cli.StringFlag{
+			Name:   "summary-file",
+			Usage:  "file a json summary of the deploy is written to",
+			EnvVar: "PLUGIN_SUMMARY_FILE",
+		},
+		cli.StringFlag{
+			Name:   "deadline",
+			Usage:  "when the job is killed, as seconds, a duration or an RFC 3339 time",
+			EnvVar: "PLUGIN_DEADLINE,ACTIVE_DEADLINE_SECONDS",
+		},
+		cli.StringFlag{
+			Name:   "trailer",
+			Usage:  "print a last line summing up the run (json or text)",
+			EnvVar: "PLUGIN_TRAILER",
+		},
+		cli.StringFlag{
+			Name:   "repo.fullname",
+			Usage:  "repository full name",
+			EnvVar: "DRONE_REPO",
+		},
+		cli.StringFlag{
+			Name:   "repo.name",
+			Usage:  "repository name",
+			EnvVar: "DRONE_REPO_NAME",
+		},
+		cli.IntFlag{
+			Name:   "build.number",
+			Usage:  "build number",
+			EnvVar: "DRONE_BUILD_NUMBER",
+		},
+		cli.StringFlag{
+			Name:   "build.link",
+			Usage:  "build link",
+			EnvVar: "DRONE_BUILD_LINK",
+		},
+		cli.StringFlag{
+			Name:   "build.event",
+			Usage:  "build event",
+			EnvVar: "DRONE_BUILD_EVENT",
+		},
+		cli.StringFlag{
+			Name:   "build.action",
+			Usage:  "build action",
+			EnvVar: "DRONE_BUILD_ACTION",
+		},
+		cli.IntFlag{
+			Name:   "build.pull-request",
+			Usage:  "pull request number",
+			EnvVar: "DRONE_PULL_REQUEST",
+		},
+		cli.StringFlag{
+			Name:   "commit.sha",
+			Usage:  "git commit sha",
+			EnvVar: "DRONE_COMMIT_SHA",
+		},
+		cli.StringFlag{
+			Name:   "commit.branch",
+			Usage:  "git commit branch",
+			EnvVar: "DRONE_COMMIT_BRANCH",
+		},
+		cli.StringFlag{
+			Name:   "commit.message",
+			Usage:  "git commit message",
+			EnvVar: "DRONE_COMMIT_MESSAGE",
+		},
+		cli.StringFlag{
+			Name:   "commit.author",
+			Usage:  "git commit author",
+			EnvVar: "DRONE_COMMIT_AUTHOR",
+		},
+	}
+	if err := app.Run(os.Args); err != nil {
+		log.WithField("failure", classifyError(err)).Error(err)
+		os.Exit(exitCode(err))
+	}
+}
+func run(c *cli.Context) error {
+
+	timeout, err := strconv.Atoi(c.String("timeout"))
+
+	if err != nil {
+		log.WithFields(log.Fields{
+			"timeout": c.String("timeout"),
+			"error":   err,
+		}).Error("invalid timeout configuration")
+		return err
+	}
+
+	stallWindow, err := parseDuration(c, "stall-window")
+
+	if err != nil {
+		return err
+	}
+
+	var history historyStore
+
+	if location := c.String("history"); location != "" {
+		history, err = openHistoryStore(location)
+
+		if err != nil {
+			log.WithFields(log.Fields{
+				"history": location,
+				"error":   err,
+			}).Error("invalid history configuration")
+			return err
+		}
+	}
+
+	checks, err := parseChecks(c.String("checks"))
+
+	if err != nil {
+		log.WithError(err).Error("invalid checks configuration")
+		return err
+	}
+
+	checkTimeout, err := parseDuration(c, "check-timeout")
+
+	if err != nil {
+		return err
+	}
+
+	versionTimeout, err := parseDuration(c, "version-timeout")
+
+	if err != nil {
+		return err
+	}
+
+	alarmWindow, err := parseDuration(c, "alarm-window")
+
+	if err != nil {
+		return err
+	}
+
+	metricsWindow, err := parseDuration(c, "metrics-window")
+
+	if err != nil {
+		return err
+	}
+
+	maxLatency, err := parseDuration(c, "max-latency")
+
+	if err != nil {
+		return err
+	}
+
+	dnsTimeout, err := parseDuration(c, "dns-timeout")
+
+	if err != nil {
+		return err
+	}
+
+	healthTimeout, err := parseDuration(c, "health-timeout")
+
+	if err != nil {
+		return err
+	}
+
+	processTimeout, err := parseDuration(c, "process-timeout")
+
+	if err != nil {
+		return err
+	}
+
+	pollInterval, err := parseDuration(c, "poll-interval")
+
+	if err != nil {
+		return err
+	}
+
+	pollJitter, err := parseDuration(c, "poll-jitter")
+
+	if err != nil {
+		return err
+	}
+
+	polling := Polling{
+		Interval: pollInterval,
+		Jitter:   pollJitter,
+	}
+
+	terminateGrace, err := parseDuration(c, "terminate-grace")
+
+	if err != nil {
+		return err
+	}
+
+	migrationTimeout, err := parseDuration(c, "migration-timeout")
+
+	if err != nil {
+		return err
+	}
+
+	presignExpiry, err := parseDuration(c, "presign-expiry")
+
+	if err != nil {
+		return err
+	}
+
+	apiTimeout, err := parseDuration(c, "api-timeout")
+
+	if err != nil {
+		return err
+	}
+
+	apiTimeouts, err := parseAPITimeouts(apiTimeout, c.StringSlice("api-timeouts"))
+
+	if err != nil {
+		log.WithError(err).Error("invalid api timeout configuration")
+		return err
+	}
+
+	rollout, err := parseRollout(c.String("rollout"))
+
+	if err != nil {
+		log.WithError(err).Error("invalid rollout configuration")
+		return err
+	}
+
+	deadline, err := parseDeadline(c.String("deadline"), time.Now())
+
+	if err != nil {
+		log.WithError(err).Error("invalid deadline configuration")
+		return err
+	}
+
+	outputNames, err := parseOutputNames(c.StringSlice("output-names"))
+
+	if err != nil {
+		log.WithError(err).Error("invalid output-names configuration")
+		return err
+	}
+
+	chaos, err := parseChaos(c.StringSlice("chaos"))
+
+	if err != nil {
+		log.WithError(err).Error("invalid chaos configuration")
+		return err
+	}
+
+	waveBake, err := parseDuration(c, "wave-bake")
+
+	if err != nil {
+		return err
+	}
+
+	deployments, err := parseDeployments(c.String("deployments"), c.String("deployments-file"))
+
+	if err != nil {
+		log.WithFields(log.Fields{
+			"deployments-file": c.String("deployments-file"),
+			"error":            err,
+		}).Error("invalid deployments configuration")
+		return err
+	}
+
+	versions, err := parseVersions(c.StringSlice("versions"))
+
+	if err != nil {
+		log.WithError(err).Error("invalid versions configuration")
+		return err
+	}
+
+	deployments = append(deployments, versions...)
+
+	windows := DeployWindows{
+		Wait: c.Bool("wait-for-window"),
+	}
+
+	if windows.Location, err = time.LoadLocation(c.String("deploy-window-timezone")); err != nil {
+		log.WithFields(log.Fields{
+			"deploy-window-timezone": c.String("deploy-window-timezone"),
+			"error":                  err,
+		}).Error("invalid deploy-window-timezone configuration")
+		return err
+	}
+
+	for _, expr := range c.StringSlice("deploy-windows") {
+		window, err := parseDeployWindow(expr)
+
+		if err != nil {
+			log.WithError(err).Error("invalid deploy-windows configuration")
+			return err
+		}
+
+		windows.Windows = append(windows.Windows, window)
+	}
+
+	var buildPattern *regexp.Regexp
+
+	if c.Bool("stale-guard") {
+		if buildPattern, err = regexp.Compile(c.String("build-pattern")); err != nil {
+			log.WithFields(log.Fields{
+				"build-pattern": c.String("build-pattern"),
+				"error":         err,
+			}).Error("invalid build-pattern configuration")
+			return err
+		}
+	}
+
+	concurrencyWindow, err := parseDuration(c, "concurrency-window")
+
+	if err != nil {
+		return err
+	}
+
+	approvalTimeout, err := parseDuration(c, "approval-timeout")
+
+	if err != nil {
+		return err
+	}
+
+	var settings []*elasticbeanstalk.ConfigurationOptionSetting
+
+	launch := LaunchConfiguration{
+		InstanceType:       c.String("instance-type"),
+		IamInstanceProfile: c.String("instance-profile"),
+		RootVolumeType:     c.String("root-volume-type"),
+		RootVolumeSize:     c.Int("root-volume-size"),
+		SecurityGroups:     c.StringSlice("security-groups"),
+	}
+
+	settings = append(settings, launch.optionSettings()...)
+
+	observability := Observability{
+		LogRetentionDays: c.Int("log-retention-days"),
+	}
+
+	if observability.XRay, err = parseToggle(c, "xray"); err != nil {
+		return err
+	}
+
+	if observability.StreamLogs, err = parseToggle(c, "stream-logs"); err != nil {
+		return err
+	}
+
+	settings = append(settings, observability.optionSettings()...)
+
+	rolling := RollingUpdate{
+		Type:                  c.String("rolling-update-type"),
+		MaxBatchSize:          c.Int("rolling-update-max-batch-size"),
+		MinInstancesInService: c.Int("rolling-update-min-in-service"),
+	}
+
+	if rolling.Enabled, err = parseToggle(c, "rolling-update"); err != nil {
+		return err
+	}
+
+	if rolling.PauseTime, err = parseDuration(c, "rolling-update-pause-time"); err != nil {
+		return err
+	}
+
+	settings = append(settings, rolling.optionSettings()...)
+
+	policy, err := parseDeploymentPolicy(
+		c.String("deployment-policy"),
+		c.Int("batch-size"),
+		c.String("batch-size-type"),
+	)
+
+	if err != nil {
+		log.WithError(err).Error("invalid deployment policy configuration")
+		return err
+	}
+
+	settings = append(settings, policy.optionSettings()...)
+
+	canary := Canary{Percent: c.Int("canary-percent")}
+
+	if canary.Duration, err = parseDuration(c, "canary-duration"); err != nil {
+		return err
+	}
+
+	if err := canary.validate(policy.Policy); err != nil {
+		log.WithError(err).Error("invalid canary configuration")
+		return err
+	}
+
+	settings = append(settings, canary.optionSettings()...)
+
+	health, err := parseHealthReporting(
+		c.String("health-reporting"),
+		c.String("health-success-threshold"),
+		c.String("health-config-document"),
+		c.StringSlice("health-ignore"),
+	)
+
+	if err != nil {
+		log.WithError(err).Error("invalid health reporting configuration")
+		return err
+	}
+
+	settings = append(settings, health.optionSettings()...)
+
+	envVars, err := parsePairs(c.String("env-vars"), "environment variable")
+
+	if err != nil {
+		log.WithError(err).Error("invalid env-vars configuration")
+		return err
+	}
+
+	settings = append(settings, envVarSettings(envVars)...)
+
+	tags, err := parsePairs(c.String("tags"), "tag")
+
+	if err != nil {
+		log.WithError(err).Error("invalid tags configuration")
+		return err
+	}
+
+	if file := c.String("option-settings-file"); file != "" {
+		fileSettings, err := readOptionSettingsFile(file)
+
+		if err != nil {
+			log.WithError(err).Error("invalid option-settings-file configuration")
+			return err
+		}
+
+		settings = append(settings, fileSettings...)
+	}
+
+	plugin := Plugin{
+		Region: c.String("region"),
+		Key:    c.String("access-key"),
+		Secret: c.String("secret-key"),
+		AssumeRole: AssumeRole{
+			RoleARN:     c.String("assume-role"),
+			ExternalID:  c.String("external-id"),
+			SessionName: c.String("role-session-name"),
+		},
+		WebIdentity: WebIdentity{
+			RoleARN:     c.String("role-arn"),
+			TokenFile:   c.String("token-file"),
+			SessionName: c.String("role-session-name"),
+		},
+		Bucket:    c.String("bucket"),
+		BucketKey: c.String("bucket-key"),
+		Artifact:  c.String("artifact"),
+		Source:    c.String("source"),
+		SourceFilter: SourceFilter{
+			Include: c.StringSlice("include"),
+			Exclude: c.StringSlice("exclude"),
+		},
+		WARs: c.StringSlice("wars"),
+		DotNet: DotNet{
+			Sites:      c.StringSlice("dotnet-sites"),
+			Deployment: c.String("dotnet-deployment"),
+			WebSite:    c.String("iis-website"),
+		},
+		Binary:        c.String("binary"),
+		Procfile:      c.String("procfile"),
+		NginxConfigs:  c.StringSlice("nginx-configs"),
+		ReuseBundles:  c.Bool("reuse-bundles"),
+		PresignExpiry: presignExpiry,
+		Provenance:    c.Bool("provenance"),
+		Canary:        canary,
+		Signing: Signing{
+			KeyID:     c.String("signing-key"),
+			Algorithm: c.String("signing-algorithm"),
+			Verify:    c.Bool("verify-signature"),
+		},
+		Deployments:      deployments,
+		Rollout:          rollout,
+		MaxStageFailures: c.Float64("max-stage-failures"),
+		StateFile:        c.String("state-file"),
+		Action:           c.String("action"),
+		Fleet: Fleet{
+			Environments: c.StringSlice("fleet"),
+			Tag:          c.String("fleet-tag"),
+			Waves:        c.IntSlice("waves"),
+			Parallel:     c.Bool("wave-parallel"),
+			Bake:         waveBake,
+		},
+		Application:     c.String("application"),
+		EnvironmentName: c.String("environment-name"),
+		Environments:    c.StringSlice("environments"),
+		Parallel:        c.Bool("parallel"),
+		VersionLabel:    c.String("version-label"),
+		Description:     c.String("description"),
+		AutoCreate:      c.Bool("auto-create"),
+		Process:         c.Bool("process"),
+		ProcessTimeout:  processTimeout,
+		Lifecycle: Lifecycle{
+			MaxCount:     c.Int("lifecycle-max-count"),
+			MaxAgeInDays: c.Int("lifecycle-max-age"),
+			DeleteSource: c.Bool("lifecycle-delete-source"),
+			ServiceRole:  c.String("lifecycle-service-role"),
+		},
+		Pruning: Pruning{
+			KeepVersions:  c.Int("keep-versions"),
+			DeleteBundles: c.Bool("delete-source-bundles"),
+		},
+		AutoSuffix:        c.Bool("auto-suffix"),
+		OnExistingVersion: c.String("on-existing-version"),
+		OptionSettings:    settings,
+		ValidateSettings:  c.String("option-settings-file") != "",
+		Template: ConfigTemplate{
+			Name: c.String("template-name"),
+			File: c.String("template-file"),
+		},
+		RemoveEnvVars:         c.StringSlice("remove-env-vars"),
+		VisibleEnvVars:        c.StringSlice("visible-env-vars"),
+		ManagedByTag:          c.String("managed-by-tag"),
+		Tags:                  tags,
+		IgnoreManagedBy:       c.Bool("ignore-managed-by"),
+		EnvironmentUpdate:     c.Bool("environment-update"),
+		AutoCreateEnvironment: c.Bool("auto-create-environment"),
+		Windows:               windows,
+		WarmUp: WarmUp{
+			Requests:    c.Int("warmup-requests"),
+			Paths:       c.StringSlice("warmup-paths"),
+			Concurrency: c.Int("warmup-concurrency"),
+		},
+		Checks:       checks,
+		CheckTimeout: checkTimeout,
+		SmokeTest: SmokeTest{
+			Enabled:  c.Bool("smoke-test"),
+			Check:    newHealthCheck(c.String("health-url"), c.Int("health-status"), c.String("health-body")),
+			Attempts: c.Int("health-attempts"),
+		},
+		VersionCheck: VersionCheck{
+			Path:     c.String("version-path"),
+			JSONPath: c.String("version-json-path"),
+			Samples:  c.Int("version-samples"),
+			Timeout:  versionTimeout,
+		},
+		Alarms: AlarmGate{
+			Names:  c.StringSlice("alarms"),
+			Window: alarmWindow,
+		},
+		Metrics: MetricsGuard{
+			Window:           metricsWindow,
+			MaxErrorRate:     c.Float64("max-error-rate"),
+			MaxLatency:       maxLatency,
+			Baseline:         c.Bool("metrics-baseline"),
+			MaxLatencyFactor: c.Float64("max-latency-factor"),
+		},
+		DNSCheck: DNSCheck{
+			Enabled:   c.Bool("verify-dns"),
+			Name:      c.String("dns-name"),
+			Resolvers: c.StringSlice("dns-resolvers"),
+			Timeout:   dnsTimeout,
+		},
+		HealthWait: HealthWait{
+			Enabled: c.Bool("wait-for-health"),
+			Color:   c.String("health-color"),
+			Checks:  c.Int("health-checks"),
+			Timeout: healthTimeout,
+			Polling: polling,
+		},
+		Strategy: c.String("deploy-strategy"),
+		BlueGreen: BlueGreen{
+			Green:     c.String("green-environment"),
+			LiveCNAME: c.String("live-cname"),
+			Template:  c.String("green-template"),
+			Terminate: c.Bool("terminate-old"),
+			Grace:     terminateGrace,
+		},
+		ReviewApp: ReviewApp{
+			Enabled: c.Bool("review-app"),
+			Prefix:  c.String("review-app-prefix"),
+			Action:  c.String("review-app-action"),
+			Schedule: ScaleSchedule{
+				ScaleDown: c.String("review-app-scale-down"),
+				ScaleUp:   c.String("review-app-scale-up"),
+				Capacity:  c.Int("review-app-capacity"),
+			},
+			GitHubToken: c.String("github-token"),
+			GitHubURL:   c.String("github-url"),
+		},
+		FreezeTag:    c.String("freeze-tag"),
+		BuildPattern: buildPattern,
+		Force:        c.Bool("force"),
+		Preconditions: Preconditions{
+			MinHealth:           c.String("min-health"),
+			MinHealthyInstances: c.Int("min-healthy-instances"),
+			NoManagedActions:    c.Bool("no-managed-actions"),
+			NoAlarms:            c.Bool("no-alarms"),
+		},
+		ConcurrencyWindow: concurrencyWindow,
+		WaitForConcurrent: c.Bool("wait-for-concurrent"),
+		Approval: &Approval{
+			Environments: c.StringSlice("approval-environments"),
+			File:         c.String("approval-file"),
+			URL:          c.String("approval-url"),
+			Parameter:    c.String("approval-parameter"),
+			Value:        c.String("approval-value"),
+			Timeout:      approvalTimeout,
+		},
+		Creation: EnvironmentCreation{
+			SolutionStack: c.String("solution-stack"),
+			PlatformARN:   c.String("platform-arn"),
+			Tier:          c.String("tier"),
+			CNAMEPrefix:   c.String("cname-prefix"),
+			KeyPair:       c.String("key-pair"),
+			ServiceRole:   c.String("service-role"),
+		},
+		Hooks: Hooks{
+			PreUpload:  c.StringSlice("pre-upload"),
+			PreUpdate:  c.StringSlice("pre-update"),
+			PostUpdate: c.StringSlice("post-update"),
+			OnFailure:  c.StringSlice("on-failure"),
+		},
+		Migration: Migration{
+			Command: c.String("migration"),
+			Timeout: migrationTimeout,
+		},
+		Timeout:          time.Duration(timeout) * time.Minute,
+		APITimeouts:      apiTimeouts,
+		StallWindow:      stallWindow,
+		AbortOnStall:     c.Bool("abort-on-stall"),
+		AbortOnCancel:    c.Bool("abort-on-cancel"),
+		AutoRollback:     c.Bool("auto-rollback"),
+		ReportFormat:     c.String("report-format"),
+		Trailer:          c.String("trailer"),
+		StatusFile:       c.String("status-file"),
+		SummaryFile:      c.String("summary-file"),
+		Polling:          polling,
+		Deadline:         deadline,
+		Audit:            c.Bool("audit"),
+		History:          history,
+		AllowKnownBad:    c.Bool("allow-known-bad"),
+		Chaos:            chaos,
+		TerraformOutputs: c.String("terraform-outputs"),
+		Stack:            c.String("stack"),
+		OutputNames:      outputNames,
+		Serve: Serve{
+			Addr:  c.String("serve-addr"),
+			Token: c.String("serve-token"),
+		},
+		ProductionEnvironments: c.StringSlice("production-environments"),
+		PagerDuty: PagerDuty{
+			RoutingKey: c.String("pagerduty-routing-key"),
+		},
+		Opsgenie: Opsgenie{
+			APIKey:   c.String("opsgenie-api-key"),
+			URL:      c.String("opsgenie-url"),
+			Priority: c.String("opsgenie-priority"),
+		},
+		Jira: Jira{
+			CloudID: c.String("jira-cloud-id"),
+			Token:   c.String("jira-token"),
+			URL:     c.String("jira-url"),
+		},
+		Repo: Repo{
+			FullName: c.String("repo.fullname"),
+			Name:     c.String("repo.name"),
+		},
+		Build: Build{
+			Number:      c.Int("build.number"),
+			Link:        c.String("build.link"),
+			Event:       c.String("build.event"),
+			Action:      c.String("build.action"),
+			PullRequest: c.Int("build.pull-request"),
+		},
+		Commit: Commit{
+			SHA:     c.String("commit.sha"),
+			Branch:  c.String("commit.branch"),
+			Message: c.String("commit.message"),
+			Author:  c.String("commit.author"),
+		},
+		Grafana: Grafana{
+			URL:   c.String("grafana-url"),
+			Token: c.String("grafana-token"),
+			Tags:  c.StringSlice("grafana-tags"),
+		},
+	}
+
+	return plugin.Exec()
+}
+
+// parseDuration reads an optional duration flag, an empty value is zero.
+func parseDuration(c *cli.Context, name string) (time.Duration, error) {
+	value := c.String(name)
+
+	if value == "" {
+		return 0, nil
+	}
+
+	d, err := time.ParseDuration(value)
+
+	if err != nil {
+		log.WithFields(log.Fields{
+			name:    value,
+			"error": err,
+		}).Errorf("invalid %s configuration", name)
+		return 0, err
+	}
+
+	return d, nil
+}
+
+// parseToggle reads an optional boolean flag, an empty value is nil so the
+// current setting is left untouched.
+func parseToggle(c *cli.Context, name string) (*bool, error) {
+	value := c.String(name)
+
+	if value == "" {
+		return nil, nil
+	}
+
+	b, err := strconv.ParseBool(value)
+
+	if err != nil {
+		log.WithFields(log.Fields{
+			name:    value,
+			"error": err,
+		}).Errorf("invalid %s configuration", name)
+		return nil, err
+	}
+
+	return &b, nil
 }
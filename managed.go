@@ -0,0 +1,40 @@
+package main
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/service/elasticbeanstalk"
+)
+
+// changesConfiguration reports whether updates change the configuration of
+// environments besides their version, applying a saved configuration
+// template included.
+func (p *Plugin) changesConfiguration() bool {
+	return len(p.OptionSettings) > 0 || len(p.RemoveEnvVars) > 0 || p.Template.Name != ""
+}
+
+// mayConfigure reports whether the configuration of the environment may be
+// changed. Environments tagged as managed by another tool, such as
+// managed-by=terraform, only get their version updated unless the guard is
+// explicitly overridden.
+func (p *Plugin) mayConfigure(client *elasticbeanstalk.ElasticBeanstalk, envLog *log.Entry, environment string) bool {
+	if !p.changesConfiguration() || p.ManagedByTag == "" || p.IgnoreManagedBy {
+		return true
+	}
+
+	tags, err := p.environmentTags(client, environment)
+
+	if err != nil {
+		envLog.WithError(err).Warn("Problem retrieving environment tags, not changing the configuration")
+		return false
+	}
+
+	if owner := tags[p.ManagedByTag]; owner != "" {
+		envLog.WithFields(log.Fields{
+			"tag":        p.ManagedByTag,
+			"managed-by": owner,
+		}).Warn("Environment is managed externally, only updating the version")
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elasticbeanstalk"
+)
+
+func TestMayConfigure(t *testing.T) {
+	settings := []*elasticbeanstalk.ConfigurationOptionSetting{{
+		Namespace:  aws.String("aws:autoscaling:asg"),
+		OptionName: aws.String("MinSize"),
+		Value:      aws.String("2"),
+	}}
+
+	managed := "<member><Key>managed-by</Key><Value>terraform</Value></member>"
+
+	tests := []struct {
+		name     string
+		tags     string
+		tagsErr  error
+		tag      string
+		ignore   bool
+		settings []*elasticbeanstalk.ConfigurationOptionSetting
+		removed  []string
+		template string
+		allowed  bool
+	}{
+		{name: "version only", tags: managed, tag: "managed-by", allowed: true},
+		{name: "guard disabled", tags: managed, settings: settings, allowed: true},
+		{name: "unmanaged", tags: "<member><Key>team</Key><Value>web</Value></member>", tag: "managed-by", settings: settings, allowed: true},
+		{name: "managed", tags: managed, tag: "managed-by", settings: settings},
+		{name: "managed removals", tags: managed, tag: "managed-by", removed: []string{"LEGACY"}},
+		{name: "managed template", tags: managed, tag: "managed-by", template: "base"},
+		{name: "managed but ignored", tags: managed, tag: "managed-by", ignore: true, settings: settings, allowed: true},
+		{name: "tags unavailable", tagsErr: errors.New("access denied"), tag: "managed-by", settings: settings},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		sess := querySession(t, func(action string, form url.Values) (string, error) {
+			switch action {
+			case "GetCallerIdentity":
+				return "<Account>123456789012</Account>", nil
+			case "ListTagsForResource":
+				return "<ResourceTags>" + test.tags + "</ResourceTags>", test.tagsErr
+			}
+
+			return "", errors.New("unexpected " + action)
+		})
+
+		p := &Plugin{
+			Region:          "us-east-1",
+			Application:     "app",
+			OptionSettings:  test.settings,
+			RemoveEnvVars:   test.removed,
+			Template:        ConfigTemplate{Name: test.template},
+			ManagedByTag:    test.tag,
+			IgnoreManagedBy: test.ignore,
+			sess:            sess,
+			identity:        &callerIdentity{},
+		}
+
+		if allowed := p.mayConfigure(elasticbeanstalk.New(sess), log.WithField("test", test.name), "app-prod"); allowed != test.allowed {
+			t.Errorf("%s: got allowed %v, want %v", test.name, allowed, test.allowed)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"errors"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elasticbeanstalk"
+)
+
+var errUnhealthyMetrics = errors.New("error rate or latency exceeded the thresholds")
+
+const (
+	// metricsInterval is how often the enhanced health metrics are sampled.
+	metricsInterval = 15 * time.Second
+
+	// baselineSamples are averaged into the pre-deploy baseline.
+	baselineSamples  = 3
+	baselineInterval = 5 * time.Second
+)
+
+// healthMetrics are the application metrics enhanced health reports for the
+// last few seconds.
+type healthMetrics struct {
+	Requests  int64   `json:"requests"`
+	ErrorRate float64 `json:"error_rate"`
+	P99       float64 `json:"p99_seconds"`
+}
+
+// environmentMetrics samples the application metrics of the environment,
+// nil when enhanced health has none yet.
+func environmentMetrics(client *elasticbeanstalk.ElasticBeanstalk, environment string) (*healthMetrics, error) {
+	out, err := client.DescribeEnvironmentHealth(&elasticbeanstalk.DescribeEnvironmentHealthInput{
+		EnvironmentName: aws.String(environment),
+		AttributeNames:  aws.StringSlice([]string{"ApplicationMetrics"}),
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	app := out.ApplicationMetrics
+
+	if app == nil || aws.Int64Value(app.RequestCount) == 0 {
+		return nil, nil
+	}
+
+	m := &healthMetrics{Requests: aws.Int64Value(app.RequestCount)}
+
+	if app.StatusCodes != nil {
+		m.ErrorRate = float64(aws.Int64Value(app.StatusCodes.Status5xx)) * 100 / float64(m.Requests)
+	}
+
+	if app.Latency != nil {
+		m.P99 = aws.Float64Value(app.Latency.P99)
+	}
+
+	return m, nil
+}
+
+// captureBaseline averages a few samples of the metrics before the deploy,
+// nil when the environment serves no traffic.
+func captureBaseline(client *elasticbeanstalk.ElasticBeanstalk, envLog *log.Entry, environment string) *healthMetrics {
+	var sum healthMetrics
+	samples := 0
+
+	for i := 0; i < baselineSamples; i++ {
+		if i > 0 {
+			time.Sleep(baselineInterval)
+		}
+
+		m, err := environmentMetrics(client, environment)
+
+		if err != nil {
+			envLog.WithError(err).Warning("Problem retrieving environment health for the baseline")
+			continue
+		}
+
+		if m == nil {
+			continue
+		}
+
+		sum.Requests += m.Requests
+		sum.ErrorRate += m.ErrorRate
+		sum.P99 += m.P99
+		samples++
+	}
+
+	if samples == 0 {
+		envLog.Info("No traffic to capture a baseline from")
+		return nil
+	}
+
+	baseline := &healthMetrics{
+		Requests:  sum.Requests / int64(samples),
+		ErrorRate: sum.ErrorRate / float64(samples),
+		P99:       sum.P99 / float64(samples),
+	}
+
+	envLog.WithFields(log.Fields{
+		"requests":   baseline.Requests,
+		"error-rate": baseline.ErrorRate,
+		"p99":        baseline.P99,
+	}).Info("Captured pre-deploy baseline")
+
+	return baseline
+}
+
+// MetricsGuard watches the error rate and latency of the environment for a
+// while after the deploy, rolling back when they exceed the thresholds. With
+// a baseline, MaxErrorRate is the allowed increase in percentage points and
+// MaxLatencyFactor the allowed multiple of the baseline p99 latency.
+type MetricsGuard struct {
+	Window           time.Duration
+	MaxErrorRate     float64
+	MaxLatency       time.Duration
+	Baseline         bool
+	MaxLatencyFactor float64
+}
+
+// exceeds reports whether a sample is over the thresholds.
+func (g *MetricsGuard) exceeds(m, baseline *healthMetrics) bool {
+	maxErrorRate := g.MaxErrorRate
+
+	if baseline != nil {
+		maxErrorRate += baseline.ErrorRate
+	}
+
+	if g.MaxErrorRate > 0 && m.ErrorRate > maxErrorRate {
+		return true
+	}
+
+	if baseline != nil && g.MaxLatencyFactor > 0 && baseline.P99 > 0 && m.P99 > baseline.P99*g.MaxLatencyFactor {
+		return true
+	}
+
+	return g.MaxLatency > 0 && m.P99 > g.MaxLatency.Seconds()
+}
+
+// watch samples the metrics for the whole window.
+func (g *MetricsGuard) watch(client *elasticbeanstalk.ElasticBeanstalk, envLog *log.Entry, environment string, baseline *healthMetrics) error {
+	fields := envLog.WithFields(log.Fields{
+		"window":         g.Window,
+		"max-error-rate": g.MaxErrorRate,
+		"max-latency":    g.MaxLatency,
+		"baseline":       baseline != nil,
+	})
+
+	fields.Info("Watching error rate and latency")
+
+	tick := time.NewTicker(metricsInterval)
+	defer tick.Stop()
+
+	tout := time.After(g.Window)
+
+	for {
+		m, err := environmentMetrics(client, environment)
+
+		if err != nil {
+			fields.WithError(err).Warning("Problem retrieving environment health")
+		}
+
+		if m != nil && g.exceeds(m, baseline) {
+			fields.WithFields(log.Fields{
+				"requests":   m.Requests,
+				"error-rate": m.ErrorRate,
+				"p99":        m.P99,
+			}).WithError(errUnhealthyMetrics).Error("Error rate or latency exceeded the thresholds")
+			return errUnhealthyMetrics
+		}
+
+		select {
+		case <-tout:
+			fields.Info("Error rate and latency stayed within the thresholds")
+			return nil
+		case <-tick.C:
+		}
+	}
+}
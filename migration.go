@@ -0,0 +1,295 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+const hookMigration = "migration"
+
+// migrationLease is how long a lock stays held without being renewed, the
+// holder renews it every quarter of the lease while the migration runs.
+const migrationLease = 2 * time.Minute
+
+var (
+	errMigrationTimeout  = errors.New("timed out waiting for the migration of another deploy")
+	errMigrationLockLost = errors.New("another deploy took over the migration lock")
+)
+
+// Migration runs a command exactly once per version label before any
+// environment is updated. A lock object in the bucket makes concurrent
+// pipelines wait for the one running it, a marker object records it ran.
+type Migration struct {
+	Command string
+
+	// Timeout bounds waiting for another pipeline. A lock its holder
+	// stopped renewing for longer than the lease is abandoned instead.
+	Timeout time.Duration
+}
+
+// migrationLock is the content of the lock object.
+type migrationLock struct {
+	Build    int       `json:"build"`
+	Commit   string    `json:"commit"`
+	Acquired time.Time `json:"acquired"`
+	Renewed  time.Time `json:"renewed"`
+}
+
+// expired reports whether the holder stopped renewing the lock, locks
+// written before renewals count from when they were acquired.
+func (l *migrationLock) expired() bool {
+	renewed := l.Renewed
+
+	if renewed.IsZero() {
+		renewed = l.Acquired
+	}
+
+	return time.Since(renewed) > migrationLease
+}
+
+// migrationKey returns the key of the lock or marker object of the version.
+func (p *Plugin) migrationKey(suffix string) string {
+	return p.Application + "/.migrations/" + p.VersionLabel + suffix
+}
+
+// migrate runs the migration command unless it already ran for the version
+// label, waiting for other pipelines holding the lock.
+func (p *Plugin) migrate() error {
+	if p.Migration.Command == "" {
+		return nil
+	}
+
+	migrationLog := log.WithFields(log.Fields{
+		"application":  p.Application,
+		"versionlabel": p.VersionLabel,
+	})
+
+	if p.Bucket == "" {
+		err := errors.New("migrations need a bucket to hold the lock")
+		migrationLog.WithError(err).Error("Problem running migration")
+		return err
+	}
+
+	tout := time.After(p.Migration.Timeout)
+
+	for {
+		done, err := p.objectExists(p.migrationKey(".done"))
+
+		if err != nil {
+			migrationLog.WithError(err).Error("Problem checking the migration marker")
+			return err
+		}
+
+		if done {
+			migrationLog.Info("Migration already ran for this version")
+			return nil
+		}
+
+		acquired, err := p.acquireMigrationLock()
+
+		if err != nil {
+			migrationLog.WithError(err).Error("Problem acquiring the migration lock")
+			return err
+		}
+
+		if acquired {
+			return p.runMigration(migrationLog)
+		}
+
+		migrationLog.Info("Waiting for the migration of another deploy")
+
+		select {
+		case <-time.After(15 * time.Second):
+		case <-tout:
+			migrationLog.WithError(errMigrationTimeout).Error("Problem running migration")
+			return errMigrationTimeout
+		}
+	}
+}
+
+// runMigration runs the command holding the lock and records it ran. The
+// command is stopped when another deploy took the lock over meanwhile.
+func (p *Plugin) runMigration(migrationLog *log.Entry) error {
+	stop := make(chan struct{})
+	lost := make(chan struct{})
+	renewed := make(chan bool)
+
+	go func() {
+		renewed <- p.renewMigrationLock(migrationLog, stop, lost)
+	}()
+
+	err := p.runHooksUntil(lost, hookMigration, "", nil)
+
+	// the lock is only released once nothing renews it anymore
+	close(stop)
+
+	if !<-renewed {
+		migrationLog.WithError(errMigrationLockLost).Error("Problem running migration")
+		return errMigrationLockLost
+	}
+
+	if err == nil {
+		err = writeStateData(p.sess, "s3://"+p.Bucket+"/"+p.migrationKey(".done"), []byte(time.Now().UTC().Format(time.RFC3339)))
+	}
+
+	p.releaseMigrationLock(migrationLog)
+
+	return err
+}
+
+// releaseMigrationLock removes the lock unless another deploy took it over.
+func (p *Plugin) releaseMigrationLock(migrationLog *log.Entry) {
+	held, err := p.holdsMigrationLock()
+
+	if err == nil && !held {
+		migrationLog.Warning("Migration lock was taken over, leaving it in place")
+		return
+	}
+
+	if err == nil {
+		err = removeStateData(p.sess, "s3://"+p.Bucket+"/"+p.migrationKey(".lock"))
+	}
+
+	if err != nil {
+		migrationLog.WithError(err).Warning("Problem releasing the migration lock")
+	}
+}
+
+// renewMigrationLock keeps the lock held until stopped, so a migration
+// running longer than the lease is never taken over. It only renews the
+// lock while it is still the one of this deploy, and closes lost and
+// reports false once another deploy took it over.
+func (p *Plugin) renewMigrationLock(migrationLog *log.Entry, stop <-chan struct{}, lost chan<- struct{}) bool {
+	acquired := time.Now()
+	tick := time.NewTicker(migrationLease / 4)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return true
+		case <-tick.C:
+		}
+
+		held, err := p.holdsMigrationLock()
+
+		if err != nil {
+			migrationLog.WithError(err).Warning("Problem renewing the migration lock")
+			continue
+		}
+
+		if !held {
+			close(lost)
+			return false
+		}
+
+		lock, err := json.Marshal(migrationLock{
+			Build:    p.Build.Number,
+			Commit:   p.Commit.SHA,
+			Acquired: acquired,
+			Renewed:  time.Now(),
+		})
+
+		if err == nil {
+			err = writeStateData(p.sess, "s3://"+p.Bucket+"/"+p.migrationKey(".lock"), lock)
+		}
+
+		if err != nil {
+			migrationLog.WithError(err).Warning("Problem renewing the migration lock")
+		}
+	}
+}
+
+// holdsMigrationLock reports whether the stored lock still names the build
+// and commit of this deploy.
+func (p *Plugin) holdsMigrationLock() (bool, error) {
+	data, err := readStateData(p.sess, "s3://"+p.Bucket+"/"+p.migrationKey(".lock"))
+
+	if err != nil || data == nil {
+		return false, err
+	}
+
+	held := &migrationLock{}
+
+	if err := json.Unmarshal(data, held); err != nil {
+		return false, nil
+	}
+
+	return held.Build == p.Build.Number && held.Commit == p.Commit.SHA, nil
+}
+
+// acquireMigrationLock creates the lock object unless it exists, taking
+// over locks their holder stopped renewing.
+func (p *Plugin) acquireMigrationLock() (bool, error) {
+	location := "s3://" + p.Bucket + "/" + p.migrationKey(".lock")
+
+	data, err := readStateData(p.sess, location)
+
+	if err != nil {
+		return false, err
+	}
+
+	if data != nil {
+		held := &migrationLock{}
+
+		if err := json.Unmarshal(data, held); err == nil && !held.expired() {
+			return false, nil
+		}
+
+		log.WithField("build", held.Build).Warning("Taking over the abandoned migration lock")
+
+		if err := removeStateData(p.sess, location); err != nil {
+			return false, err
+		}
+	}
+
+	lock, err := json.Marshal(migrationLock{
+		Build:    p.Build.Number,
+		Commit:   p.Commit.SHA,
+		Acquired: time.Now(),
+		Renewed:  time.Now(),
+	})
+
+	if err != nil {
+		return false, err
+	}
+
+	req, _ := s3.New(p.sess).PutObjectRequest(&s3.PutObjectInput{
+		Bucket:      aws.String(p.Bucket),
+		Key:         aws.String(p.migrationKey(".lock")),
+		Body:        strings.NewReader(string(lock)),
+		ContentType: aws.String("application/json"),
+	})
+
+	// the SDK input has no If-None-Match, set it so the write fails when
+	// another deploy holds the lock
+	req.HTTPRequest.Header.Set("If-None-Match", "*")
+	err = req.Send()
+
+	if aerr, ok := err.(awserr.RequestFailure); ok && (aerr.StatusCode() == 412 || aerr.StatusCode() == 409) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// objectExists reports whether the key exists in the bucket.
+func (p *Plugin) objectExists(key string) (bool, error) {
+	_, err := s3.New(p.sess).HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(p.Bucket),
+		Key:    aws.String(key),
+	})
+
+	if aerr, ok := err.(awserr.RequestFailure); ok && aerr.StatusCode() == 404 {
+		return false, nil
+	}
+
+	return err == nil, err
+}
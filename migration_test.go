@@ -0,0 +1,200 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// fakeBucket is a bucket answering the object calls of the plugin from
+// memory. Conflict fails conditional writes as if another deploy created
+// the object first.
+type fakeBucket struct {
+	mu       sync.Mutex
+	objects  map[string][]byte
+	conflict bool
+}
+
+func (b *fakeBucket) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, "/bucket/")
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	data, exists := b.objects[key]
+
+	switch r.Method {
+	case "GET", "HEAD":
+		if !exists {
+			w.WriteHeader(http.StatusNotFound)
+
+			if r.Method == "GET" {
+				w.Write([]byte("<Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message></Error>"))
+			}
+
+			return
+		}
+
+		if r.Method == "GET" {
+			w.Write(data)
+		}
+	case "PUT":
+		if r.Header.Get("If-None-Match") == "*" && (exists || b.conflict) {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			w.Write([]byte("<Error><Code>PreconditionFailed</Code><Message>At least one of the pre-conditions you specified did not hold</Message></Error>"))
+			return
+		}
+
+		b.objects[key], _ = ioutil.ReadAll(r.Body)
+	case "DELETE":
+		delete(b.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// lock returns the migration lock stored under the key, nil when there is
+// none.
+func (b *fakeBucket) lock(t *testing.T, key string) *migrationLock {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	data, ok := b.objects[key]
+
+	if !ok {
+		return nil
+	}
+
+	lock := &migrationLock{}
+
+	if err := json.Unmarshal(data, lock); err != nil {
+		t.Fatal(err)
+	}
+
+	return lock
+}
+
+func TestAcquireMigrationLock(t *testing.T) {
+	const key = "app/.migrations/v2.lock"
+
+	held := func(build int, acquired time.Time) []byte {
+		data, _ := json.Marshal(migrationLock{Build: build, Commit: "0123abcd", Acquired: acquired})
+		return data
+	}
+
+	tests := []struct {
+		name     string
+		lock     []byte
+		conflict bool
+		acquired bool
+		holder   int
+	}{
+		{name: "free", acquired: true, holder: 42},
+		{name: "held", lock: held(41, time.Now()), holder: 41},
+		{name: "abandoned", lock: held(41, time.Now().Add(-24*time.Hour)), acquired: true, holder: 42},
+		{name: "unreadable", lock: []byte("garbage"), acquired: true, holder: 42},
+		{name: "taken meanwhile", conflict: true},
+	}
+
+	for _, test := range tests {
+		bucket := &fakeBucket{objects: map[string][]byte{}, conflict: test.conflict}
+
+		if test.lock != nil {
+			bucket.objects[key] = test.lock
+		}
+
+		p := &Plugin{
+			Application:  "app",
+			VersionLabel: "v2",
+			Bucket:       "bucket",
+			Build:        Build{Number: 42},
+			Commit:       Commit{SHA: "4567cdef"},
+			Migration:    Migration{Timeout: 10 * time.Minute},
+			sess:         testSession(t, bucket),
+		}
+
+		acquired, err := p.acquireMigrationLock()
+
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		if acquired != test.acquired {
+			t.Errorf("%s: got acquired %v, want %v", test.name, acquired, test.acquired)
+		}
+
+		if lock := bucket.lock(t, key); test.holder != 0 && (lock == nil || lock.Build != test.holder) {
+			t.Errorf("%s: got lock %+v, want held by build %d", test.name, lock, test.holder)
+		}
+	}
+}
+
+func TestReleaseMigrationLock(t *testing.T) {
+	const key = "app/.migrations/v2.lock"
+
+	held := func(build int, commit string) []byte {
+		data, _ := json.Marshal(migrationLock{Build: build, Commit: commit, Acquired: time.Now()})
+		return data
+	}
+
+	tests := []struct {
+		name   string
+		lock   []byte
+		holder int
+	}{
+		{name: "ours", lock: held(42, "4567cdef")},
+		{name: "taken over", lock: held(43, "89abcdef"), holder: 43},
+		{name: "same build of another commit", lock: held(42, "89abcdef"), holder: 42},
+		{name: "gone"},
+	}
+
+	for _, test := range tests {
+		bucket := &fakeBucket{objects: map[string][]byte{}}
+
+		if test.lock != nil {
+			bucket.objects[key] = test.lock
+		}
+
+		p := &Plugin{
+			Application:  "app",
+			VersionLabel: "v2",
+			Bucket:       "bucket",
+			Build:        Build{Number: 42},
+			Commit:       Commit{SHA: "4567cdef"},
+			sess:         testSession(t, bucket),
+		}
+
+		p.releaseMigrationLock(log.WithField("test", test.name))
+
+		lock := bucket.lock(t, key)
+
+		if test.holder == 0 && lock != nil {
+			t.Errorf("%s: got lock %+v, want it released", test.name, lock)
+		}
+
+		if test.holder != 0 && (lock == nil || lock.Build != test.holder) {
+			t.Errorf("%s: got lock %+v, want it left to build %d", test.name, lock, test.holder)
+		}
+	}
+}
+
+func TestHookCommandStopped(t *testing.T) {
+	stop := make(chan struct{})
+
+	time.AfterFunc(50*time.Millisecond, func() { close(stop) })
+
+	started := time.Now()
+
+	if err := runHookCommand("sleep 10", hookContext{}, stop); err == nil {
+		t.Error("stopped command succeeded")
+	}
+
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Errorf("command ran for %s after being stopped", elapsed)
+	}
+}
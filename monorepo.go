@@ -0,0 +1,229 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/service/elasticbeanstalk"
+)
+
+// Deployment is a single application, environment and bundle tuple of a
+// monorepo deploy, empty fields fall back to the plugin settings.
+type Deployment struct {
+	Application  string `json:"application"`
+	Environment  string `json:"environment"`
+	Artifact     string `json:"artifact"`
+	BucketKey    string `json:"bucket_key"`
+	VersionLabel string `json:"version_label"`
+	Description  string `json:"description"`
+	Region       string `json:"region"`
+	RoleARN      string `json:"role_arn"`
+}
+
+// parseDeployments reads the deployments setting, Drone hands YAML lists
+// over as JSON, or the JSON document of the deployments file.
+func parseDeployments(setting, file string) ([]Deployment, error) {
+	data := []byte(setting)
+
+	if file != "" {
+		var err error
+
+		if data, err = ioutil.ReadFile(file); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	var deployments []Deployment
+
+	if err := json.Unmarshal(data, &deployments); err != nil {
+		return nil, err
+	}
+
+	for i, d := range deployments {
+		if d.Application == "" && d.Environment == "" {
+			return nil, fmt.Errorf("deployment %d needs an application or an environment", i+1)
+		}
+	}
+
+	return deployments, nil
+}
+
+// parseVersions turns bundle=label@environment entries into deployments,
+// the label is generated when left out.
+func parseVersions(entries []string) ([]Deployment, error) {
+	var deployments []Deployment
+
+	for _, entry := range entries {
+		i := strings.LastIndex(entry, "@")
+
+		if i < 0 || i == len(entry)-1 {
+			return nil, fmt.Errorf("version %s needs an @environment", entry)
+		}
+
+		d := Deployment{Artifact: entry[:i], Environment: entry[i+1:]}
+
+		if j := strings.Index(d.Artifact, "="); j >= 0 {
+			d.Artifact, d.VersionLabel = d.Artifact[:j], d.Artifact[j+1:]
+		}
+
+		if d.Artifact == "" {
+			return nil, fmt.Errorf("version %s needs a bundle", entry)
+		}
+
+		deployments = append(deployments, d)
+	}
+
+	return deployments, nil
+}
+
+// forDeployment returns a copy of the plugin targeting the deployment.
+func (p *Plugin) forDeployment(d Deployment) (*Plugin, error) {
+	q := *p
+	q.Deployments = nil
+	q.bundleChecksum = ""
+	q.reusedVersion = false
+	q.attestation = nil
+
+	if d.Application != "" {
+		q.Application = d.Application
+	}
+
+	if d.Environment != "" {
+		q.EnvironmentName = d.Environment
+		q.Environments = nil
+	}
+
+	if d.Artifact != "" {
+		q.Artifact = d.Artifact
+		q.Source = ""
+		q.WARs = nil
+		q.DotNet.Sites = nil
+		q.Binary = ""
+		q.BucketKey = d.BucketKey
+		q.VersionLabel = d.VersionLabel
+	}
+
+	if d.BucketKey != "" {
+		q.BucketKey = d.BucketKey
+	}
+
+	if d.VersionLabel != "" {
+		q.VersionLabel = d.VersionLabel
+	}
+
+	if d.Description != "" {
+		q.Description = d.Description
+	}
+
+	if err := q.buildLabels(); err != nil {
+		return nil, err
+	}
+
+	if q.hasArtifact() {
+		q.artifactNames()
+	}
+
+	if d.Region != "" || d.RoleARN != "" {
+		if d.Region != "" {
+			q.Region = d.Region
+		}
+
+		if d.RoleARN != "" {
+			q.AssumeRole.RoleARN = d.RoleARN
+		}
+
+		clients := p.clients.get(q.Region, q.AssumeRole.RoleARN)
+		q.sess = clients.sess
+		q.identity = clients.identity
+	}
+
+	return &q, nil
+}
+
+// beanstalk returns the Beanstalk client of the region and role of the
+// plugin.
+func (p *Plugin) beanstalk() *elasticbeanstalk.ElasticBeanstalk {
+	return p.clients.get(p.Region, p.AssumeRole.RoleARN).beanstalk
+}
+
+// deployAll registers the version of every deployment first, so a bundle
+// that fails to upload leaves every environment untouched, then deploys
+// them in order with the session of their region and role, shared by the
+// deployments alike, and prints a single report,
+// stopping at the first failure so later deployments never run against a
+// broken dependency.
+func (p *Plugin) deployAll() error {
+	var targets []*Plugin
+	var results []*envResult
+
+	for i, d := range p.Deployments {
+		q, err := p.forDeployment(d)
+
+		if err != nil {
+			log.WithError(err).Error("invalid deployment configuration")
+			return err
+		}
+
+		client := q.beanstalk()
+
+		if current := q.upToDate(client); current != nil {
+			results = append(results, current...)
+			continue
+		}
+
+		log.WithFields(log.Fields{
+			"application":  q.Application,
+			"versionlabel": q.VersionLabel,
+		}).Infof("Registering version %d of %d", i+1, len(p.Deployments))
+
+		if err := q.register(client); err != nil {
+			result := newEnvResult(q.Application, q.EnvironmentName, q.VersionLabel).finish(err)
+			printReport(p.ReportFormat, []*envResult{result})
+			return err
+		}
+
+		targets = append(targets, q)
+	}
+
+	if !p.EnvironmentUpdate {
+		return nil
+	}
+
+	for i, q := range targets {
+		log.WithFields(log.Fields{
+			"application":  q.Application,
+			"environment":  q.EnvironmentName,
+			"versionlabel": q.VersionLabel,
+		}).Infof("Deploying %d of %d", i+1, len(targets))
+
+		deployed, err := q.update(q.beanstalk())
+
+		if err != nil {
+			deployed = []*envResult{
+				newEnvResult(q.Application, q.EnvironmentName, q.VersionLabel).finish(err),
+			}
+		}
+
+		results = append(results, deployed...)
+
+		if resultsError(deployed) != nil {
+			if skipped := len(targets) - i - 1; skipped > 0 {
+				log.WithField("skipped", skipped).Warning("Skipping the remaining deployments")
+			}
+
+			break
+		}
+	}
+
+	p.results = results
+	printReport(p.ReportFormat, results)
+
+	return resultsError(results)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+// notify sends the deploy results to every configured integration. Problems
+// are only logged, a failing integration never fails the deploy.
+func (p *Plugin) notify(results []*envResult) {
+	if p.Grafana.URL != "" {
+		for _, r := range results {
+			if err := p.Grafana.annotate(p.Application, r); err != nil {
+				log.WithError(err).WithField("environment", r.Environment).Error("Problem posting Grafana annotation")
+			}
+		}
+	}
+
+	if p.PagerDuty.RoutingKey != "" {
+		for _, r := range results {
+			if !p.isProduction(r.Environment) {
+				continue
+			}
+
+			if err := p.PagerDuty.changeEvent(p.Application, r); err != nil {
+				log.WithError(err).WithField("environment", r.Environment).Error("Problem sending PagerDuty change event")
+			}
+		}
+	}
+
+	if p.Opsgenie.APIKey != "" {
+		for _, r := range results {
+			if r.err == nil || !p.isProduction(r.Environment) {
+				continue
+			}
+
+			if err := p.Opsgenie.alert(p.Application, r); err != nil {
+				log.WithError(err).WithField("environment", r.Environment).Error("Problem creating Opsgenie alert")
+			}
+		}
+	}
+
+	if p.Jira.CloudID != "" {
+		keys := issueKeys(p.Commit.Message, p.Description)
+
+		if len(keys) == 0 {
+			log.Info("No Jira issue keys found, skipping Jira deployment information")
+		} else if err := p.Jira.deployments(p, keys, results); err != nil {
+			log.WithError(err).Error("Problem sending Jira deployment information")
+		}
+	}
+}
+
+// isProduction matches the environment against the production patterns,
+// without any pattern every environment counts as production.
+func (p *Plugin) isProduction(environment string) bool {
+	if len(p.ProductionEnvironments) == 0 {
+		return true
+	}
+
+	for _, pattern := range p.ProductionEnvironments {
+		if ok, _ := path.Match(pattern, environment); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// postJSON sends the payload as JSON and fails on any non 2xx response.
+func postJSON(url string, headers map[string]string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := httpClient.Do(req)
+
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s returned %s: %s", url, resp.Status, bytes.TrimSpace(msg))
+	}
+
+	return nil
+}
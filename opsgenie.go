@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+const opsgenieURL = "https://api.opsgenie.com"
+
+// Opsgenie defines where alerts for failed deploys are created.
+type Opsgenie struct {
+	APIKey   string
+	URL      string
+	Priority string
+}
+
+type opsgenieAlert struct {
+	Message     string            `json:"message"`
+	Alias       string            `json:"alias"`
+	Description string            `json:"description"`
+	Tags        []string          `json:"tags"`
+	Details     map[string]string `json:"details"`
+	Priority    string            `json:"priority,omitempty"`
+}
+
+// alert creates an alert for the failed deploy of a single environment.
+func (o *Opsgenie) alert(application string, r *envResult) error {
+	url := o.URL
+
+	if url == "" {
+		url = opsgenieURL
+	}
+
+	return postJSON(
+		strings.TrimSuffix(url, "/")+"/v2/alerts",
+		map[string]string{"Authorization": "GenieKey " + o.APIKey},
+		opsgenieAlert{
+			Message:     fmt.Sprintf("Deploy of %s to %s/%s failed", r.Version, application, r.Environment),
+			Alias:       fmt.Sprintf("eb-deploy-%s-%s-%s", application, r.Environment, r.Version),
+			Description: fmt.Sprintf("%s\n\nLast event: %s", r.Error, orDash(r.LastEvent)),
+			Tags:        []string{"deploy", "elastic-beanstalk", application, r.Environment},
+			Details: map[string]string{
+				"application":      application,
+				"environment":      r.Environment,
+				"version":          r.Version,
+				"previous_version": r.PreviousVersion,
+				"failure_class":    r.FailureClass,
+				"rolled_back_to":   r.RolledBackTo,
+				"last_event":       r.LastEvent,
+				"error":            r.Error,
+				"console":          r.Console,
+			},
+			Priority: o.Priority,
+		},
+	)
+}
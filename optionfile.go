@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elasticbeanstalk"
+)
+
+var errInvalidSettings = errors.New("option settings did not validate")
+
+// fileOptionSetting is an entry of the option settings file.
+type fileOptionSetting struct {
+	Namespace  string  `json:"Namespace"`
+	OptionName string  `json:"OptionName"`
+	Value      *string `json:"Value"`
+}
+
+// readOptionSettingsFile reads the option settings kept in the repository,
+// a JSON array or a YAML list of Namespace, OptionName and Value entries.
+func readOptionSettingsFile(file string) ([]*elasticbeanstalk.ConfigurationOptionSetting, error) {
+	data, err := ioutil.ReadFile(file)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []fileOptionSetting
+
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		err = json.Unmarshal(trimmed, &entries)
+	} else {
+		entries, err = parseOptionSettingsYAML(data)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", file, err)
+	}
+
+	var settings []*elasticbeanstalk.ConfigurationOptionSetting
+
+	for i, e := range entries {
+		if e.Namespace == "" || e.OptionName == "" || e.Value == nil {
+			return nil, fmt.Errorf("%s: entry %d needs a Namespace, OptionName and Value", file, i+1)
+		}
+
+		settings = append(settings, optionSetting(e.Namespace, e.OptionName, *e.Value))
+	}
+
+	return settings, nil
+}
+
+// parseOptionSettingsYAML reads a YAML list of flat mappings, which is all
+// the file needs, such as:
+//
+//   - Namespace: aws:autoscaling:asg
+//     OptionName: MaxSize
+//     Value: "4"
+func parseOptionSettingsYAML(data []byte) ([]fileOptionSetting, error) {
+	var entries []fileOptionSetting
+	var entry *fileOptionSetting
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" || strings.HasPrefix(line, "#") || line == "---" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "- ") || line == "-" {
+			entries = append(entries, fileOptionSetting{})
+			entry = &entries[len(entries)-1]
+			line = strings.TrimSpace(strings.TrimPrefix(line, "-"))
+
+			if line == "" {
+				continue
+			}
+		}
+
+		if entry == nil {
+			return nil, fmt.Errorf("line %d: expected a list entry", n)
+		}
+
+		// namespaces contain colons, the key ends at the first ": "
+		i := strings.Index(line, ": ")
+
+		if i < 0 && strings.HasSuffix(line, ":") {
+			i = len(line) - 1
+		}
+
+		if i < 0 {
+			return nil, fmt.Errorf("line %d: expected key: value", n)
+		}
+
+		key := strings.TrimSpace(line[:i])
+		value, err := yamlScalar(strings.TrimSpace(line[i+1:]))
+
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", n, err)
+		}
+
+		switch key {
+		case "Namespace":
+			entry.Namespace = value
+		case "OptionName":
+			entry.OptionName = value
+		case "Value":
+			entry.Value = aws.String(value)
+		default:
+			return nil, fmt.Errorf("line %d: unknown key %s", n, key)
+		}
+	}
+
+	return entries, scanner.Err()
+}
+
+// yamlScalar unquotes a quoted scalar and strips trailing comments from
+// plain ones.
+func yamlScalar(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, `"`):
+		return strconv.Unquote(value)
+	case strings.HasPrefix(value, "'"):
+		if len(value) < 2 || !strings.HasSuffix(value, "'") {
+			return "", fmt.Errorf("unterminated string %s", value)
+		}
+
+		return strings.Replace(value[1:len(value)-1], "''", "'", -1), nil
+	}
+
+	if i := strings.Index(value, " #"); i >= 0 {
+		value = strings.TrimSpace(value[:i])
+	}
+
+	return value, nil
+}
+
+// validateOptionSettings has Beanstalk check the settings against the
+// environment before it is updated, failing on errors and logging warnings.
+func (p *Plugin) validateOptionSettings(client *elasticbeanstalk.ElasticBeanstalk, envLog *log.Entry, environment string, settings []*elasticbeanstalk.ConfigurationOptionSetting) error {
+	if len(settings) == 0 {
+		return nil
+	}
+
+	out, err := client.ValidateConfigurationSettings(
+		&elasticbeanstalk.ValidateConfigurationSettingsInput{
+			ApplicationName: aws.String(p.Application),
+			EnvironmentName: aws.String(environment),
+			OptionSettings:  settings,
+		},
+	)
+
+	if err != nil {
+		envLog.WithError(err).Error("Problem validating option settings")
+		return err
+	}
+
+	invalid := false
+
+	for _, m := range out.Messages {
+		fields := envLog.WithFields(log.Fields{
+			"namespace": aws.StringValue(m.Namespace),
+			"option":    aws.StringValue(m.OptionName),
+		})
+
+		if aws.StringValue(m.Severity) == "error" {
+			invalid = true
+			fields.Error(aws.StringValue(m.Message))
+		} else {
+			fields.Warn(aws.StringValue(m.Message))
+		}
+	}
+
+	if invalid {
+		return errInvalidSettings
+	}
+
+	return nil
+}
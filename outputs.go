@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+)
+
+// defaultOutputNames are the outputs looked up for each setting, in order,
+// when output-names does not name one. The terraform and CloudFormation
+// spellings are both looked up.
+var defaultOutputNames = map[string][]string{
+	"application":  {"application", "application_name", "ApplicationName"},
+	"environments": {"environments", "environment_names", "environment", "environment_name", "EnvironmentNames", "EnvironmentName"},
+	"bucket":       {"bucket", "bucket_name", "BucketName"},
+}
+
+// parseOutputNames reads setting=output pairs naming the output of each
+// setting.
+func parseOutputNames(entries []string) (map[string][]string, error) {
+	names := map[string][]string{}
+
+	for setting, outputs := range defaultOutputNames {
+		names[setting] = outputs
+	}
+
+	for _, entry := range entries {
+		i := strings.Index(entry, "=")
+
+		if i <= 0 || i == len(entry)-1 {
+			return nil, fmt.Errorf("output name %q is not setting=output", entry)
+		}
+
+		setting := entry[:i]
+
+		if _, ok := defaultOutputNames[setting]; !ok {
+			return nil, fmt.Errorf("unknown output setting %s", setting)
+		}
+
+		names[setting] = []string{entry[i+1:]}
+	}
+
+	return names, nil
+}
+
+// terraformOutput is a single output of terraform output -json.
+type terraformOutput struct {
+	Sensitive bool        `json:"sensitive"`
+	Value     interface{} `json:"value"`
+}
+
+// readTerraformOutputs reads the file written by terraform output -json.
+func readTerraformOutputs(path string) (map[string]interface{}, error) {
+	data, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	doc := map[string]terraformOutput{}
+
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	outputs := map[string]interface{}{}
+
+	for name, output := range doc {
+		outputs[name] = output.Value
+	}
+
+	return outputs, nil
+}
+
+// readStackOutputs returns the outputs of a CloudFormation stack, by key
+// and by export name. Comma separated values are lists, as CloudFormation
+// outputs are strings.
+func (p *Plugin) readStackOutputs(stack string) (map[string]interface{}, error) {
+	out, err := cloudformation.New(p.sess).DescribeStacks(&cloudformation.DescribeStacksInput{
+		StackName: aws.String(stack),
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	outputs := map[string]interface{}{}
+
+	for _, s := range out.Stacks {
+		for _, output := range s.Outputs {
+			var values []interface{}
+
+			for _, value := range strings.Split(aws.StringValue(output.OutputValue), ",") {
+				values = append(values, strings.TrimSpace(value))
+			}
+
+			outputs[aws.StringValue(output.OutputKey)] = values
+
+			if export := aws.StringValue(output.ExportName); export != "" {
+				outputs[export] = values
+			}
+		}
+	}
+
+	return outputs, nil
+}
+
+// outputStrings turns a string or list output into strings.
+func outputStrings(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		if v != "" {
+			return []string{v}
+		}
+	case []interface{}:
+		var out []string
+
+		for _, item := range v {
+			if s, ok := item.(string); ok && s != "" {
+				out = append(out, s)
+			}
+		}
+
+		return out
+	}
+
+	return nil
+}
+
+// lookupOutput returns the first of the named outputs that is set.
+func lookupOutput(outputs map[string]interface{}, names []string) (string, []string) {
+	for _, name := range names {
+		if values := outputStrings(outputs[name]); len(values) > 0 {
+			return name, values
+		}
+	}
+
+	return "", nil
+}
+
+// applyOutputs fills the application, environments and bucket left empty
+// from the outputs of the stack that provisioned them.
+func (p *Plugin) applyOutputs(source string, outputs map[string]interface{}) {
+	outputLog := log.WithField("source", source)
+
+	if p.Application == "" {
+		if name, values := lookupOutput(outputs, p.OutputNames["application"]); name != "" {
+			p.Application = values[0]
+			outputLog.WithFields(log.Fields{"output": name, "application": p.Application}).Info("Using application from output")
+		}
+	}
+
+	if p.EnvironmentName == "" && len(p.Environments) == 0 {
+		if name, values := lookupOutput(outputs, p.OutputNames["environments"]); name != "" {
+			if len(values) == 1 {
+				p.EnvironmentName = values[0]
+			} else {
+				p.Environments = values
+			}
+
+			outputLog.WithFields(log.Fields{"output": name, "environments": values}).Info("Using environments from output")
+		}
+	}
+
+	if p.Bucket == "" {
+		if name, values := lookupOutput(outputs, p.OutputNames["bucket"]); name != "" {
+			p.Bucket = values[0]
+			outputLog.WithFields(log.Fields{"output": name, "bucket": p.Bucket}).Info("Using bucket from output")
+		}
+	}
+}
+
+// discoverOutputs applies the configured stack outputs.
+func (p *Plugin) discoverOutputs() error {
+	if p.TerraformOutputs != "" {
+		outputs, err := readTerraformOutputs(p.TerraformOutputs)
+
+		if err != nil {
+			log.WithError(err).WithField("file", p.TerraformOutputs).Error("Problem reading the terraform outputs")
+			return err
+		}
+
+		p.applyOutputs("terraform", outputs)
+	}
+
+	if p.Stack != "" {
+		outputs, err := p.readStackOutputs(p.Stack)
+
+		if err != nil {
+			log.WithError(err).WithField("stack", p.Stack).Error("Problem reading the stack outputs")
+			return err
+		}
+
+		p.applyOutputs("cloudformation", outputs)
+	}
+
+	return nil
+}
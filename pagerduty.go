@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+const pagerDutyChangeURL = "https://events.pagerduty.com/v2/change/enqueue"
+
+// PagerDuty defines where change events are sent.
+type PagerDuty struct {
+	RoutingKey string
+}
+
+type pagerDutyChange struct {
+	RoutingKey string                 `json:"routing_key"`
+	Payload    pagerDutyChangePayload `json:"payload"`
+	Links      []pagerDutyLink        `json:"links,omitempty"`
+}
+
+type pagerDutyLink struct {
+	Href string `json:"href"`
+	Text string `json:"text"`
+}
+
+type pagerDutyChangePayload struct {
+	Summary       string                 `json:"summary"`
+	Timestamp     string                 `json:"timestamp"`
+	Source        string                 `json:"source"`
+	CustomDetails map[string]interface{} `json:"custom_details"`
+}
+
+// changeEvent reports the deploy of a single environment.
+func (pd *PagerDuty) changeEvent(application string, r *envResult) error {
+	var links []pagerDutyLink
+
+	if r.Console != "" {
+		links = append(links, pagerDutyLink{Href: r.Console, Text: "Environment dashboard"})
+	}
+
+	return postJSON(
+		pagerDutyChangeURL,
+		nil,
+		pagerDutyChange{
+			RoutingKey: pd.RoutingKey,
+			Payload: pagerDutyChangePayload{
+				Summary:   fmt.Sprintf("Deployed %s to %s/%s (%s)", r.Version, application, r.Environment, r.Outcome),
+				Timestamp: r.Finished.UTC().Format(time.RFC3339),
+				Source:    "elastic-beanstalk/" + application + "/" + r.Environment,
+				CustomDetails: map[string]interface{}{
+					"application":      application,
+					"environment":      r.Environment,
+					"version":          r.Version,
+					"previous_version": r.PreviousVersion,
+					"outcome":          r.Outcome,
+					"error":            r.Error,
+				},
+			},
+			Links: links,
+		},
+	)
+}
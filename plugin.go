@@ -1,12 +1,13 @@
 package main
 
 import (
-	"errors"
+	"regexp"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/elasticbeanstalk"
 )
@@ -17,6 +18,14 @@ type Plugin struct {
 	Secret string
 	Bucket string
 
+	// AssumeRole is the role deploys run as, assumed with the credentials
+	// above.
+	AssumeRole AssumeRole
+
+	// WebIdentity exchanges the token of the runner for credentials of a
+	// role when no key is given.
+	WebIdentity WebIdentity
+
 	// us-east-1
 	// us-west-1
 	// us-west-2
@@ -30,17 +39,335 @@ type Plugin struct {
 	BucketKey         string
 	Application       string
 	EnvironmentName   string
+	Environments      []string
+	Parallel          bool
 	VersionLabel      string
 	Description       string
 	AutoCreate        bool
 	Process           bool
 	EnvironmentUpdate bool
 
+	// ProcessTimeout bounds the wait for a processed version to be
+	// validated.
+	ProcessTimeout time.Duration
+
+	// AutoCreateEnvironment creates missing environments with the Creation
+	// settings, running the version label right away.
+	AutoCreateEnvironment bool
+	Creation              EnvironmentCreation
+
+	// WarmUp primes updated environments with requests.
+	WarmUp WarmUp
+
+	// Checks must pass against updated environments within CheckTimeout.
+	Checks       []HTTPCheck
+	CheckTimeout time.Duration
+
+	// SmokeTest probes the health URL of updated environments.
+	SmokeTest SmokeTest
+
+	// VersionCheck waits for every instance to serve the version label.
+	VersionCheck VersionCheck
+
+	// Alarms fail deploys that set off a CloudWatch alarm.
+	Alarms AlarmGate
+
+	// Metrics rolls back deploys raising the error rate or latency.
+	Metrics MetricsGuard
+
+	// DNSCheck waits for the public name to resolve to updated environments.
+	DNSCheck DNSCheck
+
+	// HealthWait waits for the enhanced health after the update.
+	HealthWait HealthWait
+
+	// Strategy selects in-place updates or BlueGreen deploys with a CNAME
+	// swap.
+	Strategy  string
+	BlueGreen BlueGreen
+
+	// ReviewApp deploys pull requests to their own environments.
+	ReviewApp ReviewApp
+
+	// Windows restricts deploys to the configured windows, FreezeTag names
+	// the environment tag that blocks deploys entirely.
+	Windows   DeployWindows
+	FreezeTag string
+
+	// BuildPattern extracts build numbers from version labels to refuse
+	// deploying builds older than the live one, unless Force is set.
+	BuildPattern *regexp.Regexp
+	Force        bool
+
+	// Preconditions the environment has to meet before it is updated.
+	Preconditions Preconditions
+
+	// ConcurrencyWindow fails deploys when another build started deploying
+	// to the environment this recently and is not done yet, or waits for it
+	// with WaitForConcurrent.
+	ConcurrencyWindow time.Duration
+	WaitForConcurrent bool
+
+	// Approval holds deploys to the gated environments until signed off.
+	Approval *Approval
+
+	// Artifact is a local source bundle uploaded to Bucket/BucketKey.
+	Artifact string
+
+	// Source is a directory zipped into the source bundle.
+	Source string
+
+	// SourceFilter selects the files of Source, on top of its .ebignore.
+	SourceFilter SourceFilter
+
+	// WARs are context=path pairs packaged for the Tomcat platform.
+	WARs []string
+
+	// DotNet packages published sites for the Windows Server platforms.
+	DotNet DotNet
+
+	// Binary is a built Go binary or Java SE jar packaged together with the
+	// optional Procfile.
+	Binary   string
+	Procfile string
+
+	// Rollout is a plan of stages the environments are updated in, instead
+	// of the single EnvironmentName.
+	Rollout []Stage
+
+	// MaxStageFailures is the percentage of environments of a stage that
+	// may fail before the rollout pauses, writing the StateFile.
+	MaxStageFailures float64
+	StateFile        string
+
+	// Action is deploy, or resume to continue a paused rollout.
+	Action string
+
+	// Fleet plans the rollout as percentage based waves of environments.
+	Fleet Fleet
+
+	// Deployments are the application, environment and bundle tuples of a
+	// monorepo, deployed in order with the settings above as defaults.
+	Deployments []Deployment
+
+	// PresignExpiry logs a download URL of the uploaded bundle valid this
+	// long, zero disables it.
+	PresignExpiry time.Duration
+
+	// Provenance records the bundle digest, commit, builder and pipeline as
+	// bundle metadata and version tags, checked by the verify action.
+	Provenance bool
+
+	// Signing signs uploaded bundles and verifies the deployed one.
+	Signing Signing
+
+	// Canary deploys with traffic splitting, aborting when the metrics
+	// guard thresholds are exceeded during the evaluation.
+	Canary Canary
+
+	// ReuseBundles deploys the version of an identical bundle registered
+	// before instead of creating a duplicate one.
+	ReuseBundles bool
+
+	// NginxConfigs are proxy configuration files injected into the bundle.
+	NginxConfigs []string
+
+	// Hooks run commands or URLs at the lifecycle phases of the deploy.
+	Hooks Hooks
+
+	// Migration runs once per version label before the environments are
+	// updated.
+	Migration Migration
+
 	Timeout time.Duration
+
+	// APITimeouts bound the single AWS API calls.
+	APITimeouts APITimeouts
+
+	Repo   Repo
+	Build  Build
+	Commit Commit
+
+	// StallWindow fails the update when the environment keeps updating
+	// without any new event for this long, zero disables the watchdog.
+	StallWindow  time.Duration
+	AbortOnStall bool
+
+	// AbortOnCancel aborts the updates in flight when the build is
+	// cancelled.
+	AbortOnCancel bool
+
+	// AutoRollback aborts stalled or failing updates and redeploys the
+	// version that was running before.
+	AutoRollback bool
+
+	// AutoSuffix retries the version creation with a -2, -3, ... suffix
+	// when the label already exists for a different source bundle.
+	AutoSuffix bool
+
+	// Serve is where the server of the serve action listens.
+	Serve Serve
+
+	// TerraformOutputs is the terraform output -json file the application,
+	// environments and bucket left empty are read from, OutputNames names
+	// the output of each.
+	TerraformOutputs string
+	OutputNames      map[string][]string
+
+	// Stack is the CloudFormation stack whose outputs, or their export
+	// names, are read like the terraform outputs.
+	Stack string
+
+	// Chaos simulates failures to test the failure handling of pipelines.
+	Chaos Chaos
+
+	// Lifecycle is the version retention Beanstalk applies on its own.
+	Lifecycle Lifecycle
+
+	// Pruning deletes old application versions after a successful deploy.
+	Pruning Pruning
+
+	// OnExistingVersion reuses, fails on or recreates a version label that
+	// already exists.
+	OnExistingVersion string
+
+	// OptionSettings are applied to the environment along with the version.
+	OptionSettings []*elasticbeanstalk.ConfigurationOptionSetting
+
+	// Template is the saved configuration environments are created and
+	// updated with, unless they are managed externally.
+	Template ConfigTemplate
+
+	// ValidateSettings has Beanstalk validate the option settings before
+	// the update, set when they come from a file.
+	ValidateSettings bool
+
+	// RemoveEnvVars are environment variables removed along with the
+	// version, unless the environment is managed externally. Changed
+	// variables are reported with their values masked unless their name
+	// matches VisibleEnvVars.
+	RemoveEnvVars  []string
+	VisibleEnvVars []string
+
+	// Tags are added to the application version and the environments,
+	// along with tags naming the build.
+	Tags map[string]string
+
+	// ManagedByTag names the environment tag marking environments managed by
+	// an infrastructure as code tool, whose option settings are left alone
+	// unless IgnoreManagedBy is set.
+	ManagedByTag    string
+	IgnoreManagedBy bool
+
+	// ProductionEnvironments are the glob patterns of environments that
+	// production only integrations report on.
+	ProductionEnvironments []string
+
+	Grafana   Grafana
+	PagerDuty PagerDuty
+	Opsgenie  Opsgenie
+	Jira      Jira
+
+	// Audit only records the intended change in the history store, without
+	// calling any mutating API.
+	Audit   bool
+	History historyStore
+
+	// AllowKnownBad deploys versions the history marks as bad for the
+	// environment.
+	AllowKnownBad bool
+
+	// ReportFormat selects how the final per-environment report is printed,
+	// either table or json.
+	ReportFormat string
+
+	// Trailer prints a last json or key=value line summing up the run.
+	Trailer string
+
+	// StatusFile receives the outcome of the run as JSON, for workflow
+	// engines running the plugin as a job.
+	StatusFile string
+
+	// SummaryFile receives a JSON summary of the deploy for the following
+	// steps, which is also added to DRONE_OUTPUT when set.
+	SummaryFile string
+
+	// Polling paces the polls of the environments.
+	Polling Polling
+
+	// Deadline is when the job running the plugin is killed, the timeout
+	// is shortened to end the deploy before.
+	Deadline time.Time
+
+	sess *session.Session
+
+	// endpoint overrides the endpoint of every AWS service, the tests point
+	// it to a fake.
+	endpoint string
+
+	// clients are the sessions of every region and role deployed to.
+	clients *clientCache
+
+	identity *callerIdentity
+
+	// failedCalls collects the request IDs of failed AWS calls.
+	failedCalls *requestLog
+
+	// updating tracks the updates in flight, aborted on cancellation.
+	updating *updateTracker
+
+	// bundleChecksum is the SHA256 of the uploaded bundle, reusedVersion
+	// is set when the version of an identical bundle is deployed instead.
+	bundleChecksum string
+	reusedVersion  bool
+
+	// versionCreated is when the version was created, the application
+	// events of its processing are followed from there.
+	versionCreated time.Time
+
+	// attestation is the provenance recorded with the uploaded bundle.
+	attestation *provenance
+
+	// results are the outcomes of the deploy, answered by the server and
+	// written to the status file.
+	results []*envResult
+
+	// started is when Exec started, for the status of a cancelled run.
+	started time.Time
 }
 
-// Exec runs the plugin
+// Exec runs the plugin, failures carry the request IDs of the AWS calls
+// that failed.
 func (p *Plugin) Exec() error {
+	p.failedCalls = &requestLog{}
+	started := time.Now()
+	p.started = started
+
+	err := p.exec()
+
+	if err != nil {
+		err = p.failedCalls.annotate(err)
+	}
+
+	p.printTrailer(started, err)
+
+	code := 0
+
+	if err != nil {
+		code = exitCode(err)
+	}
+
+	p.writeStatus(started, err, code)
+	p.writeSummary(started, err)
+
+	return err
+}
+
+func (p *Plugin) exec() error {
+	if err := p.applyDeadline(); err != nil {
+		return err
+	}
+
 	// create the client
 
 	conf := &aws.Config{
@@ -48,10 +375,66 @@ func (p *Plugin) Exec() error {
 		MaxRetries: aws.Int(20),
 	}
 
+	if p.endpoint != "" {
+		conf.Endpoint = aws.String(p.endpoint)
+		conf.S3ForcePathStyle = aws.Bool(true)
+	}
+
+	log.WithField("region", p.Region).Info("Authenticating")
+
+	if p.Key != "" && p.Secret != "" {
+		conf.Credentials = credentials.NewStaticCredentials(p.Key, p.Secret, "")
+	} else if p.WebIdentity.enabled() {
+		log.WithField("role", p.WebIdentity.RoleARN).Info("Using web identity token")
+
+		base := session.New(conf.Copy().WithCredentials(credentials.AnonymousCredentials))
+		p.APITimeouts.install(&base.Handlers)
+		p.failedCalls.install(&base.Handlers)
+
+		conf.Credentials = p.WebIdentity.credentials(base)
+	} else {
+		log.Warn("AWS Key and/or Secret not provided (falling back to ec2 instance profile)")
+	}
+
+	p.clients = newClientCache(conf, p.AssumeRole, func(handlers *request.Handlers) {
+		p.APITimeouts.install(handlers)
+		p.failedCalls.install(handlers)
+		p.Chaos.install(handlers)
+	})
+
+	if p.Chaos.enabled() {
+		log.WithField("chaos", p.Chaos).Warn("Simulating failures")
+	}
+
+	clients := p.clients.get(p.Region, p.AssumeRole.RoleARN)
+	p.sess = clients.sess
+	p.identity = clients.identity
+	p.updating = newUpdateTracker()
+	client := clients.beanstalk
+
+	// history stores in S3 go through the session of the plugin settings
+	if h, ok := p.History.(*s3History); ok {
+		h.sess = p.sess
+	}
+
+	// the stack outputs may name what the labels refer to
+	if err := p.discoverOutputs(); err != nil {
+		return err
+	}
+
+	if err := p.buildLabels(); err != nil {
+		log.WithError(err).Error("invalid version label configuration")
+		return err
+	}
+
+	if p.hasArtifact() {
+		p.artifactNames()
+	}
+
 	log.WithFields(log.Fields{
 		"region":       p.Region,
 		"application":  p.Application,
-		"environment":  p.EnvironmentName,
+		"environment":  p.environments(),
 		"bucket":       p.Bucket,
 		"bucket-key":   p.BucketKey,
 		"versionlabel": p.VersionLabel,
@@ -59,17 +442,123 @@ func (p *Plugin) Exec() error {
 		"env-update":   p.EnvironmentUpdate,
 		"auto-create":  p.AutoCreate,
 		"timeout":      p.Timeout,
-	}).Info("Authenticating")
+	}).Info("Deploy settings")
 
-	if p.Key != "" && p.Secret != "" {
-		conf.Credentials = credentials.NewStaticCredentials(p.Key, p.Secret, "")
-	} else {
-		log.Warn("AWS Key and/or Secret not provided (falling back to ec2 instance profile)")
+	if p.AbortOnCancel {
+		defer p.trapCancel(client)()
+	}
+
+	if p.Audit {
+		return p.audit(client)
+	}
+
+	if p.Action == actionResume {
+		return p.resume(client)
+	}
+
+	if p.Action == actionServe {
+		return p.serve(client)
+	}
+
+	if p.Action == actionConfigure {
+		return p.configure(client)
+	}
+
+	if p.Action == actionReport {
+		return p.reportFleet(client)
+	}
+
+	if p.Action == actionVerify {
+		return p.verifyProvenance(client)
+	}
+
+	if p.Action == actionMarkBad || p.Action == actionMarkGood {
+		return p.markVersion(client)
+	}
+
+	if p.ReviewApp.Enabled {
+		if p.reviewCleanup() {
+			return p.terminateReviewApp(client)
+		}
+
+		p.prepareReviewApp()
+	}
+
+	if err := p.checkDeployWindow(); err != nil {
+		return err
+	}
+
+	if p.Fleet.enabled() {
+		if err := p.planFleet(client); err != nil {
+			return err
+		}
+	}
+
+	if len(p.Deployments) > 0 {
+		return p.deployAll()
+	}
+
+	results, err := p.deploy(client)
+	p.results = results
+
+	if err != nil {
+		return err
+	}
+
+	if results == nil {
+		return nil
+	}
+
+	printReport(p.ReportFormat, results)
+
+	err = resultsError(results)
+
+	if err == nil && p.ReviewApp.Enabled {
+		p.announceReviewApp(client)
 	}
 
-	client := elasticbeanstalk.New(session.New(), conf)
+	if err == nil && p.Pruning.KeepVersions > 0 {
+		p.pruneVersions(client)
+	}
+
+	return err
+}
+
+// deploy uploads the artifact, registers the application version and
+// updates the environment, returning the results of the update when the
+// environment is updated at all.
+func (p *Plugin) deploy(client *elasticbeanstalk.ElasticBeanstalk) ([]*envResult, error) {
+	if results := p.upToDate(client); results != nil {
+		return results, nil
+	}
+
+	if err := p.register(client); err != nil {
+		return nil, err
+	}
+
+	if !p.EnvironmentUpdate {
+		return nil, nil
+	}
 
-	if p.Bucket != "" && p.BucketKey != "" {
+	return p.update(client)
+}
+
+// register uploads the artifact and registers the application version.
+func (p *Plugin) register(client *elasticbeanstalk.ElasticBeanstalk) error {
+	if err := p.runHooks(hookPreUpload, "", nil); err != nil {
+		p.runFailureHooks("", err)
+		return err
+	}
+
+	if p.hasArtifact() {
+		if err := p.uploadArtifact(client); err != nil {
+			log.WithError(err).Error("Problem uploading artifact")
+			p.runFailureHooks("", err)
+			return err
+		}
+	}
+
+	if p.Bucket != "" && p.BucketKey != "" && !p.reusedVersion {
 
 		log.WithFields(log.Fields{
 			"application":  p.Application,
@@ -80,195 +569,567 @@ func (p *Plugin) Exec() error {
 			"auto-create":  p.AutoCreate,
 		}).Info("Creating application version")
 
-		_, err := client.CreateApplicationVersion(
-			&elasticbeanstalk.CreateApplicationVersionInput{
-				VersionLabel:          aws.String(p.VersionLabel),
-				ApplicationName:       aws.String(p.Application),
-				Description:           aws.String(p.Description),
-				AutoCreateApplication: aws.Bool(p.AutoCreate),
-				Process:               aws.Bool(p.Process),
-				SourceBundle: &elasticbeanstalk.S3Location{
-					S3Bucket: aws.String(p.Bucket),
-					S3Key:    aws.String(p.BucketKey),
-				},
-			},
-		)
+		err := p.createApplicationVersion(client)
 
 		if err != nil {
 			log.WithError(err).Error("Problem creating application version")
 
-			if p.EnvironmentUpdate == false {
+			if p.EnvironmentUpdate == false || err == errVersionExists || err == errVersionProcessing {
+				p.runFailureHooks("", err)
 				return err
 			}
 
 			log.Warning("Ignoring error and attempting to update")
+		} else {
+			if p.ReuseBundles && p.bundleChecksum != "" {
+				if err := p.rememberBundle(); err != nil {
+					log.WithError(err).Warning("Problem recording the bundle checksum")
+				}
+			}
+
+			if p.attestation != nil {
+				if err := p.tagVersion(client, p.attestation.tags()); err != nil {
+					log.WithError(err).Warning("Problem tagging the version with its provenance")
+				}
+			}
 		}
 	}
 
-	if p.EnvironmentUpdate {
+	if p.Lifecycle.enabled() {
+		if err := p.applyLifecycle(client); err != nil {
+			log.WithError(err).Warning("Problem updating the application version lifecycle")
+		}
+	}
 
-		err := waitEnvironmentToBeReady(
-			client,
-			p.Application,
-			p.EnvironmentName,
-			p.Timeout,
-		)
+	if p.hasArtifact() && p.PresignExpiry > 0 {
+		p.logBundleURL(client)
+	}
 
-		if err != nil {
+	return nil
+}
+
+// logBundleURL logs a presigned download URL of the bundle of the version,
+// which is the bundle of the cached version when one was reused instead of
+// uploading.
+func (p *Plugin) logBundleURL(client *elasticbeanstalk.ElasticBeanstalk) {
+	bucket, key := p.Bucket, p.BucketKey
+
+	if p.reusedVersion {
+		version, err := describeApplicationVersion(client, p.Application, p.VersionLabel)
+
+		if err != nil || version == nil || version.SourceBundle == nil {
+			log.WithError(err).Warning("Problem finding the bundle of the reused version")
+			return
+		}
+
+		bucket = aws.StringValue(version.SourceBundle.S3Bucket)
+		key = aws.StringValue(version.SourceBundle.S3Key)
+	}
+
+	url, err := presignObject(p.sess, bucket, key, p.PresignExpiry)
+
+	if err != nil {
+		log.WithError(err).Warning("Problem presigning the bundle URL")
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"url":     url,
+		"expires": time.Now().Add(p.PresignExpiry).UTC().Format(time.RFC3339),
+	}).Info("Bundle download URL")
+}
+
+// update runs the migration and rolls the version label out to the
+// environments.
+func (p *Plugin) update(client *elasticbeanstalk.ElasticBeanstalk) ([]*envResult, error) {
+	if p.Template.File != "" {
+		if err := p.saveTemplate(client); err != nil {
+			p.runFailureHooks("", err)
+			return nil, err
+		}
+	}
+
+	if p.Signing.Verify {
+		if err := p.verifySignature(client); err != nil {
+			p.runFailureHooks("", err)
+			return nil, err
+		}
+	}
+
+	if err := p.migrate(); err != nil {
+		p.runFailureHooks("", err)
+		return nil, err
+	}
+
+	return p.rollOut(client), nil
+}
+
+// rollOut updates the environments to the version label and reports the
+// results to the integrations and the history store.
+func (p *Plugin) rollOut(client *elasticbeanstalk.ElasticBeanstalk) []*envResult {
+	results := p.updateEnvironments(client)
+
+	p.notify(attempted(results))
+
+	if err := p.recordDeploys(attempted(results)); err != nil {
+		log.WithError(err).Error("Problem recording deploy history")
+	}
+
+	return results
+}
+
+// updateEnvironment deploys the version label to a single environment and
+// records the outcome. Every log line is written through an entry scoped to
+// the environment so interleaved output stays readable.
+func (p *Plugin) updateEnvironment(client *elasticbeanstalk.ElasticBeanstalk, environment string) *envResult {
+	envLog := log.WithField("environment", environment)
+	result := newEnvResult(p.Application, environment, p.VersionLabel)
+
+	var err error
+
+	if p.Strategy == strategyBlueGreen {
+		err = p.deployBlueGreen(client, envLog, environment, result)
+	} else {
+		err = p.deployEnvironment(client, envLog, environment, result)
+
+		if err == nil {
+			err = p.verifyEnvironment(client, envLog, environment, result)
+		}
+
+		p.reportDegraded(client, envLog, environment)
+
+		if err == nil {
+			p.describeEndpoint(client, envLog, environment, result)
+		}
+	}
+
+	if err == nil && len(p.Tags) > 0 {
+		p.tagEnvironment(client, envLog, environment)
+	}
+
+	if err == nil && len(p.Hooks.PostUpdate) > 0 {
+		result.begin(hookPostUpdate)
+		err = p.runHooks(hookPostUpdate, environment, nil)
+	}
+
+	if p.Strategy != strategyBlueGreen && !p.configuring() && p.shouldRollback(err) {
+		p.rollback(client, envLog, environment, result)
+	}
+
+	if err != nil {
+		p.runFailureHooks(environment, err)
+	}
+
+	return result.finish(err)
+}
+
+// shouldRollback reports whether the deploy failure calls for a rollback.
+// Tripping the metrics guard always does, the other failures only with
+// AutoRollback.
+func (p *Plugin) shouldRollback(err error) bool {
+	switch err {
+	case errUnhealthyMetrics:
+		return true
+	case errStalled, errEventFailure, errAlarm:
+		return p.AutoRollback
+	}
+
+	return false
+}
+
+// deployEnvironment waits for the environment to be ready, updates it to the
+// version label and waits for the update to finish.
+func (p *Plugin) deployEnvironment(client *elasticbeanstalk.ElasticBeanstalk, envLog *log.Entry, environment string, result *envResult) error {
+	if err := p.checkFreeze(client, envLog, environment); err != nil {
+		return err
+	}
+
+	if p.Approval.gates(environment) {
+		result.begin("approval")
+
+		if err := p.Approval.await(p.sess); err != nil {
 			return err
 		}
+	}
 
-		appFields := log.WithFields(log.Fields{
-			"application":  p.Application,
-			"environment":  p.EnvironmentName,
-			"versionlabel": p.VersionLabel,
-			"timeout":      p.Timeout,
-		})
+	if p.AutoCreateEnvironment {
+		created, err := p.createEnvironment(client, envLog, environment, result)
+
+		if err != nil || created {
+			return err
+		}
+	}
+
+	result.begin("wait")
+
+	if p.Chaos.Timeout {
+		err := errTimedOut
+		envLog.WithError(err).Error("Environment never got into ready state (simulated)")
+		return err
+	}
+
+	// waiting for the environment and for the update share the timeout
+	budget := newWaitBudget(p.Timeout, p.Polling)
+	result.budget = budget
+
+	// deploys of other builds are looked for first, the environment is only
+	// ready again once they are over
+	if err := p.checkConcurrent(client, envLog, environment, budget); err != nil {
+		return err
+	}
+
+	current, err := waitEnvironmentToBeReady(
+		client,
+		envLog,
+		p.Application,
+		environment,
+		budget,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	result.Console = consoleURL(p.Region, aws.StringValue(current.EnvironmentId))
+	result.CNAME = aws.StringValue(current.CNAME)
+
+	// configuring keeps the version the environment runs
+	label := p.VersionLabel
+
+	if p.configuring() {
+		label = aws.StringValue(current.VersionLabel)
+		result.Version = label
+	}
+
+	if err := p.checkPreconditions(client, envLog, current); err != nil {
+		return err
+	}
+
+	if !p.configuring() {
+		if err := p.checkStale(envLog, current); err != nil {
+			return err
+		}
+
+		if err := p.checkKnownBad(envLog, environment); err != nil {
+			return err
+		}
+	}
+
+	result.PreviousVersion = p.rollbackTarget(envLog, environment, lastGoodVersion(client, envLog, p.Application, current))
+
+	if p.Metrics.Baseline {
+		result.begin("baseline")
+		result.Baseline = captureBaseline(client, envLog, environment)
+	}
+
+	if len(p.Hooks.PreUpdate) > 0 {
+		result.begin(hookPreUpdate)
+
+		if err := p.runHooks(hookPreUpdate, environment, nil); err != nil {
+			return err
+		}
+	}
+
+	result.begin("update")
+
+	appFields := envLog.WithFields(log.Fields{
+		"application":  p.Application,
+		"versionlabel": label,
+		"timeout":      p.Timeout,
+	})
 
-		tick := time.Tick(time.Second * 10)
-		tout := time.After(p.Timeout)
+	var (
+		settings []*elasticbeanstalk.ConfigurationOptionSetting
+		removed  []string
+		template *string
+	)
 
-		description, err := client.UpdateEnvironment(
-			&elasticbeanstalk.UpdateEnvironmentInput{
-				VersionLabel:    aws.String(p.VersionLabel),
-				ApplicationName: aws.String(p.Application),
-				Description:     aws.String(p.Description),
-				EnvironmentName: aws.String(p.EnvironmentName),
+	if p.mayConfigure(client, envLog, environment) {
+		settings, removed = p.OptionSettings, p.RemoveEnvVars
+		template = p.Template.templateName()
+	}
+
+	if p.ValidateSettings {
+		if err := p.validateOptionSettings(client, envLog, environment, settings); err != nil {
+			return err
+		}
+	}
+
+	p.reportEnvVars(client, envLog, environment, settings, removed)
+
+	started := time.Now()
+
+	input := &elasticbeanstalk.UpdateEnvironmentInput{
+		VersionLabel:    aws.String(p.VersionLabel),
+		ApplicationName: aws.String(p.Application),
+		Description:     aws.String(p.Description),
+		EnvironmentName: aws.String(environment),
+		TemplateName:    template,
+		OptionSettings:  settings,
+		OptionsToRemove: removedEnvVars(removed),
+	}
+
+	if p.configuring() {
+		input.VersionLabel = nil
+
+		switch {
+		case p.Creation.PlatformARN != "":
+			input.PlatformArn = aws.String(p.Creation.PlatformARN)
+		case p.Creation.SolutionStack != "":
+			input.SolutionStackName = aws.String(p.Creation.SolutionStack)
+		}
+	}
+
+	description, err := client.UpdateEnvironment(input)
+
+	appFields.Infoln(description)
+
+	if err != nil {
+		appFields.WithError(err).Error("Problem updating beanstalk")
+		return err
+	}
+
+	p.updating.add(environment)
+	defer p.updating.remove(environment)
+
+	appFields.Info("Waiting for environment to finish updating")
+
+	cursor := newEventCursor(p.Application, environment, started)
+	lastProgress := time.Now()
+
+	// a bundle failing validation only shows up in application events
+	var versionCursor *eventCursor
+
+	if p.Process && !p.versionCreated.IsZero() {
+		versionCursor = newVersionEventCursor(p.Application, p.VersionLabel, p.versionCreated)
+	}
+	aborting := false
+
+	for {
+		if !budget.wait() {
+			err := errTimedOut
+			appFields.WithError(err).Error("Environment failed to update")
+			return err
+		}
+
+		envs, err := client.DescribeEnvironments(
+			&elasticbeanstalk.DescribeEnvironmentsInput{
+				ApplicationName:  aws.String(p.Application),
+				EnvironmentNames: aws.StringSlice([]string{environment}),
+				IncludeDeleted:   aws.Bool(false),
 			},
 		)
 
-		appFields.Infoln(description)
+		if err != nil {
+			appFields.WithError(err).Error("Problem retrieving environment information")
+			return err
+		}
+
+		if len(envs.Environments) == 0 {
+			err := missingEnvironment(client, p.Application, environment)
+			appFields.WithError(err).Error("Environment disappeared during the update")
+			return err
+		}
+
+		// get every event since the last poll
+		events, err := cursor.next(client)
 
 		if err != nil {
-			appFields.WithError(err).Error("Problem updating beanstalk")
+			appFields.WithError(err).Error("Problem retrieving environment events")
 			return err
 		}
 
-		appFields.Info("Waiting for environment to finish updating")
+		env := envs.Environments[0]
 
-		for {
-			select {
+		if versionCursor != nil {
+			versionEvents, err := versionCursor.next(client)
 
-			case <-tick:
+			if err != nil {
+				appFields.WithError(err).Error("Problem retrieving application version events")
+				return err
+			}
 
-				envs, err := client.DescribeEnvironments(
-					&elasticbeanstalk.DescribeEnvironmentsInput{
-						ApplicationName:  aws.String(p.Application),
-						EnvironmentNames: aws.StringSlice([]string{p.EnvironmentName}),
-					},
-				)
+			for _, e := range versionEvents {
+				logEvent(envLog.WithField("versionlabel", p.VersionLabel), e)
+			}
 
-				if err != nil {
-					appFields.WithError(err).Error("Problem retrieving environment information")
-					return err
-				}
+			if failed := firstError(versionEvents); failed != nil {
+				err := errVersionFailure
+				appFields.WithError(err).WithFields(log.Fields{
+					"severity": aws.StringValue(failed.Severity),
+					"failure":  aws.StringValue(failed.Message),
+				}).Error("Update failed")
+				return err
+			}
+		}
 
-				// get the latest event
-				events, err := client.DescribeEvents(&elasticbeanstalk.DescribeEventsInput{
-					ApplicationName: aws.String(p.Application),
-					EnvironmentName: aws.String(p.EnvironmentName),
-					MaxRecords:      aws.Int64(1),
-				})
+		if len(events) > 0 {
+			budget.progress()
+		}
 
-				if err != nil {
-					appFields.WithError(err).Error("Problem retrieving environment events")
-					return err
-				}
+		for _, e := range events {
+			logEvent(envLog, e)
+
+			result.LastEvent = aws.StringValue(e.Message)
+			lastProgress = time.Now()
+		}
 
-				env := envs.Environments[0]
+		result.Events += len(events)
+		result.Health = aws.StringValue(env.Health)
 
-				event := aws.StringValue(events.Events[0].Message)
-				status := aws.StringValue(env.Status)
-				health := aws.StringValue(env.Health)
-				version := aws.StringValue(env.VersionLabel)
+		event := result.LastEvent
 
-				envFields := log.WithFields(log.Fields{
-					"event":   event,
-					"version": version,
-					"status":  status,
-					"health":  health,
-				})
+		status := aws.StringValue(env.Status)
+		health := aws.StringValue(env.Health)
+		version := aws.StringValue(env.VersionLabel)
 
-				envFields.Info("Updating")
+		envFields := envLog.WithFields(log.Fields{
+			"event":   event,
+			"version": version,
+			"status":  status,
+			"health":  health,
+		})
 
-				if status == elasticbeanstalk.EnvironmentStatusReady {
+		envFields.Info("Updating")
 
-					if p.VersionLabel != version {
-						err := errors.New("update did not finish")
-						appFields.WithError(err).Error("Update failed, please check EB environment logs")
-						return err
-					}
+		if failed := firstError(events); failed != nil {
+			err := errEventFailure
+			envFields.WithError(err).WithFields(log.Fields{
+				"severity": aws.StringValue(failed.Severity),
+				"failure":  aws.StringValue(failed.Message),
+			}).Error("Update failed")
+			return err
+		}
 
-					appFields.WithFields(log.Fields{
-						"application":  p.Application,
-						"environment":  p.EnvironmentName,
-						"versionlabel": p.VersionLabel,
-					}).Info("Update finished successfully")
+		if status == elasticbeanstalk.EnvironmentStatusReady {
 
-					return nil
-				}
+			if label != version && aborting {
+				err := errAborted
+				appFields.WithError(err).WithField("running", version).Error("Update failed")
+				return err
+			}
 
-				if status != elasticbeanstalk.EnvironmentStatusUpdating {
-					err := errors.New("environment is not updating")
-					appFields.WithError(err).Error("Update failed")
-					return err
-				}
+			if label != version {
+				err := errNotFinished
+				appFields.WithError(err).Error("Update failed, please check EB environment logs")
+				return err
+			}
 
-			case <-tout:
-				err := errors.New("timed out")
+			if p.Canary.enabled() {
+				appFields.Info("Canary promoted")
+			}
 
-				if err != nil {
-					appFields.WithError(err).Error("Environment failed to update")
-					return err
-				}
+			appFields.Info("Update finished successfully")
+
+			return nil
+		}
+
+		if terminating(status) {
+			err := errTerminating
+			appFields.WithError(err).Error("Update failed")
+			return err
+		}
+
+		if !inProgress(status) {
+			err := errNotUpdating
+			appFields.WithError(err).Error("Update failed")
+			return err
+		}
+
+		if status == elasticbeanstalk.EnvironmentStatusAborting && !aborting {
+			aborting = true
+			appFields.Warn("Update is being aborted, waiting for the rollback")
+		}
 
+		if p.Canary.enabled() && status == elasticbeanstalk.EnvironmentStatusUpdating {
+			if err := p.checkCanary(client, appFields, environment, result.Baseline); err != nil {
+				return err
 			}
 		}
+
+		if p.StallWindow > 0 && time.Since(lastProgress) > p.StallWindow {
+			err := errStalled
+			appFields.WithError(err).WithField("stall-window", p.StallWindow).Error("No new events, deployment looks stuck")
+
+			if p.AbortOnStall && !p.AutoRollback {
+				abortEnvironmentUpdate(client, appFields, environment)
+			}
+
+			return err
+		}
 	}
+}
 
-	return nil
+// abortEnvironmentUpdate cancels the in-progress update of the environment.
+// Failures are only logged since the deploy already failed at this point.
+func abortEnvironmentUpdate(client *elasticbeanstalk.ElasticBeanstalk, appFields *log.Entry, environment string) {
+	appFields.Warn("Aborting environment update")
+
+	_, err := client.AbortEnvironmentUpdate(
+		&elasticbeanstalk.AbortEnvironmentUpdateInput{
+			EnvironmentName: aws.String(environment),
+		},
+	)
+
+	if err != nil {
+		appFields.WithError(err).Error("Problem aborting environment update")
+	}
 }
 
-func waitEnvironmentToBeReady(client *elasticbeanstalk.ElasticBeanstalk, application string, environment string, timeout time.Duration) error {
+// waitEnvironmentToBeReady polls the environment until it is ready, within
+// the budget.
+func waitEnvironmentToBeReady(client *elasticbeanstalk.ElasticBeanstalk, envLog *log.Entry, application string, environment string, budget *waitBudget) (*elasticbeanstalk.EnvironmentDescription, error) {
 
-	appFields := log.WithFields(log.Fields{
+	appFields := envLog.WithFields(log.Fields{
 		"application": application,
-		"environment": environment,
-		"timeout":     timeout,
+		"timeout":     budget.remaining().Round(time.Second),
 	})
 
-	tick := time.Tick(time.Second * 10)
-	tout := time.After(timeout)
+	status := ""
 
 	for {
-		select {
+		envs, err := client.DescribeEnvironments(
+			&elasticbeanstalk.DescribeEnvironmentsInput{
+				ApplicationName:  aws.String(application),
+				EnvironmentNames: aws.StringSlice([]string{environment}),
+				IncludeDeleted:   aws.Bool(false),
+			},
+		)
 
-		case <-tick:
+		if err != nil {
+			appFields.WithError(err).Error("Problem retrieving environment information")
+			return nil, err
+		}
 
-			envs, err := client.DescribeEnvironments(
-				&elasticbeanstalk.DescribeEnvironmentsInput{
-					ApplicationName:  aws.String(application),
-					EnvironmentNames: aws.StringSlice([]string{environment}),
-				},
-			)
+		if len(envs.Environments) == 0 {
+			err := missingEnvironment(client, application, environment)
+			appFields.WithError(err).Error("Environment does not exist")
+			return nil, err
+		}
 
-			if err != nil {
-				appFields.WithError(err).Error("Problem retrieving environment information")
-				return err
-			}
+		env := envs.Environments[0]
 
-			env := envs.Environments[0]
+		if aws.StringValue(env.Status) == elasticbeanstalk.EnvironmentStatusReady {
+			return env, nil
+		}
 
-			if aws.StringValue(env.Status) == elasticbeanstalk.EnvironmentStatusReady {
-				return nil
-			}
+		if terminating(aws.StringValue(env.Status)) {
+			err := errTerminating
+			appFields.WithError(err).Error("Environment will never get into ready state")
+			return nil, err
+		}
 
-			appFields.WithField("status", aws.StringValue(env.Status)).Info("Waiting for environment to be ready")
+		if aws.StringValue(env.Status) != status {
+			status = aws.StringValue(env.Status)
+			budget.progress()
+		}
 
-		case <-tout:
-			err := errors.New("timed out")
+		appFields.WithField("status", status).Info("Waiting for environment to be ready")
+
+		if !budget.wait() {
+			err := errTimedOut
 			appFields.WithError(err).Error("Environment never got into ready state")
-			return err
+			return nil, err
 		}
 	}
 }
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/elasticbeanstalk"
+)
+
+var errPrecondition = errors.New("environment is not fit for a deploy")
+
+// healthRank orders the environment health colors, Grey is unknown.
+var healthRank = map[string]int{
+	elasticbeanstalk.EnvironmentHealthRed:    1,
+	elasticbeanstalk.EnvironmentHealthYellow: 2,
+	elasticbeanstalk.EnvironmentHealthGreen:  3,
+}
+
+// Preconditions refuse to deploy onto an environment that is already broken
+// or busy, unless forced.
+type Preconditions struct {
+	MinHealth           string
+	MinHealthyInstances int
+	NoManagedActions    bool
+	NoAlarms            bool
+}
+
+// checkPreconditions verifies the environment before the update starts.
+func (p *Plugin) checkPreconditions(client *elasticbeanstalk.ElasticBeanstalk, envLog *log.Entry, env *elasticbeanstalk.EnvironmentDescription) error {
+	problems := p.preconditionProblems(client, env)
+
+	if len(problems) == 0 {
+		return nil
+	}
+
+	for _, problem := range problems {
+		envLog.WithField("precondition", problem).Warning("Deploy precondition not met")
+	}
+
+	if p.Force {
+		envLog.Warning("Deploying anyway, force is set")
+		return nil
+	}
+
+	envLog.WithError(errPrecondition).Error("Refusing to deploy, use force to override")
+
+	return errPrecondition
+}
+
+// preconditionProblems lists every precondition the environment fails.
+func (p *Plugin) preconditionProblems(client *elasticbeanstalk.ElasticBeanstalk, env *elasticbeanstalk.EnvironmentDescription) []string {
+	c := p.Preconditions
+	environment := aws.StringValue(env.EnvironmentName)
+
+	var problems []string
+
+	if c.MinHealth != "" {
+		health := aws.StringValue(env.Health)
+
+		if healthRank[health] < healthRank[c.MinHealth] {
+			problems = append(problems, fmt.Sprintf("health is %s, at least %s is required", health, c.MinHealth))
+		}
+	}
+
+	if c.MinHealthyInstances > 0 {
+		out, err := client.DescribeEnvironmentHealth(&elasticbeanstalk.DescribeEnvironmentHealthInput{
+			EnvironmentName: aws.String(environment),
+			AttributeNames:  aws.StringSlice([]string{"InstancesHealth"}),
+		})
+
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("instance health is unknown: %s", err))
+		} else if summary := out.InstancesHealth; summary == nil {
+			problems = append(problems, "instance health is unknown, is enhanced health enabled?")
+		} else if healthy := aws.Int64Value(summary.Ok) + aws.Int64Value(summary.Info); healthy < int64(c.MinHealthyInstances) {
+			problems = append(problems, fmt.Sprintf("%d healthy instances, at least %d are required", healthy, c.MinHealthyInstances))
+		}
+	}
+
+	if c.NoManagedActions {
+		out, err := client.DescribeEnvironmentManagedActions(&elasticbeanstalk.DescribeEnvironmentManagedActionsInput{
+			EnvironmentName: aws.String(environment),
+		})
+
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("managed actions are unknown: %s", err))
+		}
+
+		for _, action := range out.ManagedActions {
+			switch status := aws.StringValue(action.Status); status {
+			case "Pending", "Running":
+				problems = append(problems, fmt.Sprintf("managed action %s is %s", aws.StringValue(action.ActionDescription), status))
+			}
+		}
+	}
+
+	if c.NoAlarms && len(p.Alarms.Names) > 0 {
+		firing, err := p.Alarms.firing(cloudwatch.New(p.sess))
+
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("alarm states are unknown: %s", err))
+		}
+
+		for _, alarm := range firing {
+			problems = append(problems, fmt.Sprintf("alarm %s is in ALARM", aws.StringValue(alarm.AlarmName)))
+		}
+	}
+
+	return problems
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elasticbeanstalk"
+)
+
+// successfulDeployMessages are the event messages Beanstalk emits once a
+// version is fully deployed to an environment.
+var successfulDeployMessages = []string{
+	"Environment update completed successfully",
+	"New application version was deployed to running EC2 instances",
+}
+
+// lastGoodVersion inspects the recent events of the environment to find the
+// last version label that was deployed successfully. The running version is
+// used unless a failure happened after the last successful deploy, in which
+// case the label of that successful deploy event wins when it is known.
+func lastGoodVersion(client *elasticbeanstalk.ElasticBeanstalk, envLog *log.Entry, application string, env *elasticbeanstalk.EnvironmentDescription) string {
+	current := aws.StringValue(env.VersionLabel)
+
+	events, err := client.DescribeEvents(&elasticbeanstalk.DescribeEventsInput{
+		ApplicationName: aws.String(application),
+		EnvironmentName: env.EnvironmentName,
+		MaxRecords:      aws.Int64(100),
+	})
+
+	if err != nil {
+		envLog.WithError(err).Warn("Problem retrieving deployment history, assuming the running version is good")
+		return current
+	}
+
+	failedSince := false
+
+	// events are returned newest first
+	for _, event := range events.Events {
+		if isErrorSeverity(aws.StringValue(event.Severity)) {
+			failedSince = true
+			continue
+		}
+
+		if !isSuccessfulDeploy(aws.StringValue(event.Message)) {
+			continue
+		}
+
+		label := aws.StringValue(event.VersionLabel)
+
+		if !failedSince || label == "" {
+			return current
+		}
+
+		envLog.WithFields(log.Fields{
+			"running":  current,
+			"previous": label,
+		}).Warn("Running version failed to deploy, using the last successful version as previous version")
+
+		return label
+	}
+
+	return current
+}
+
+func isSuccessfulDeploy(message string) bool {
+	for _, m := range successfulDeployMessages {
+		if strings.Contains(message, m) {
+			return true
+		}
+	}
+
+	return false
+}
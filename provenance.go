@@ -0,0 +1,276 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elasticbeanstalk"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+const actionVerify = "verify"
+
+// provenanceTagPrefix prefixes the application version tags of the
+// attestation, the object metadata uses the bare names.
+const provenanceTagPrefix = "provenance:"
+
+var errProvenance = errors.New("environment runs a bundle that does not match its recorded digest")
+
+// provenance attests where a bundle comes from, it is stored as metadata of
+// the bundle object and as tags of the application version.
+type provenance struct {
+	Digest   string
+	Commit   string
+	Builder  string
+	Pipeline string
+}
+
+// fields returns the non empty attestation fields by name.
+func (pr provenance) fields() map[string]string {
+	fields := map[string]string{}
+
+	for name, value := range map[string]string{
+		"sha256":   pr.Digest,
+		"commit":   pr.Commit,
+		"builder":  pr.Builder,
+		"pipeline": pr.Pipeline,
+	} {
+		if value != "" {
+			fields[name] = value
+		}
+	}
+
+	return fields
+}
+
+// metadata returns the attestation as S3 object metadata.
+func (pr provenance) metadata() map[string]*string {
+	metadata := map[string]*string{}
+
+	for name, value := range pr.fields() {
+		metadata[name] = aws.String(value)
+	}
+
+	return metadata
+}
+
+// tags returns the attestation as application version tags.
+func (pr provenance) tags() []*elasticbeanstalk.Tag {
+	var tags []*elasticbeanstalk.Tag
+
+	for name, value := range pr.fields() {
+		tags = append(tags, &elasticbeanstalk.Tag{
+			Key:   aws.String(provenanceTagPrefix + name),
+			Value: aws.String(value),
+		})
+	}
+
+	return tags
+}
+
+// attest builds the provenance of the bundle about to be uploaded, the
+// builder is the identity of the credentials in use.
+func (p *Plugin) attest(bundle string) (*provenance, error) {
+	digest, err := p.bundleDigest(bundle)
+
+	if err != nil {
+		return nil, err
+	}
+
+	builder, err := p.callerARN()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &provenance{
+		Digest:   digest,
+		Commit:   p.Commit.SHA,
+		Builder:  builder,
+		Pipeline: p.Build.Link,
+	}, nil
+}
+
+// applicationVersionARN builds the ARN of an application version.
+func applicationVersionARN(region, account, application, label string) string {
+	return fmt.Sprintf(
+		"arn:%s:elasticbeanstalk:%s:%s:applicationversion/%s/%s",
+		partition(region),
+		region,
+		account,
+		application,
+		label,
+	)
+}
+
+// tagVersion adds the tags to the version being deployed.
+func (p *Plugin) tagVersion(client *elasticbeanstalk.ElasticBeanstalk, tags []*elasticbeanstalk.Tag) error {
+	account, err := p.account()
+
+	if err != nil {
+		return err
+	}
+
+	_, err = client.UpdateTagsForResource(&elasticbeanstalk.UpdateTagsForResourceInput{
+		ResourceArn: aws.String(applicationVersionARN(p.Region, account, p.Application, p.VersionLabel)),
+		TagsToAdd:   tags,
+	})
+
+	return err
+}
+
+// recordedDigest returns the digest attested for a version, from its tags
+// or else from the metadata of its bundle.
+func (p *Plugin) recordedDigest(client *elasticbeanstalk.ElasticBeanstalk, label string, bundle *elasticbeanstalk.S3Location) (string, error) {
+	account, err := p.account()
+
+	if err != nil {
+		return "", err
+	}
+
+	out, err := client.ListTagsForResource(&elasticbeanstalk.ListTagsForResourceInput{
+		ResourceArn: aws.String(applicationVersionARN(p.Region, account, p.Application, label)),
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	for _, tag := range out.ResourceTags {
+		if aws.StringValue(tag.Key) == provenanceTagPrefix+"sha256" {
+			return aws.StringValue(tag.Value), nil
+		}
+	}
+
+	head, err := s3.New(p.sess).HeadObject(&s3.HeadObjectInput{
+		Bucket: bundle.S3Bucket,
+		Key:    bundle.S3Key,
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	for name, value := range head.Metadata {
+		if strings.EqualFold(name, "sha256") {
+			return aws.StringValue(value), nil
+		}
+	}
+
+	return "", nil
+}
+
+// objectDigest downloads a bundle and returns its hex encoded SHA256.
+func (p *Plugin) objectDigest(bundle *elasticbeanstalk.S3Location) (string, error) {
+	out, err := s3.New(p.sess).GetObject(&s3.GetObjectInput{
+		Bucket: bundle.S3Bucket,
+		Key:    bundle.S3Key,
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	defer out.Body.Close()
+
+	h := sha256.New()
+
+	if _, err := io.Copy(h, out.Body); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// verifyProvenance checks that the bundle of the version running in each
+// environment still hashes to the digest recorded when it was uploaded.
+func (p *Plugin) verifyProvenance(client *elasticbeanstalk.ElasticBeanstalk) error {
+	failed := false
+
+	for _, environment := range p.environments() {
+		envLog := log.WithFields(log.Fields{
+			"application": p.Application,
+			"environment": environment,
+		})
+
+		envs, err := client.DescribeEnvironments(
+			&elasticbeanstalk.DescribeEnvironmentsInput{
+				ApplicationName:  aws.String(p.Application),
+				EnvironmentNames: aws.StringSlice([]string{environment}),
+				IncludeDeleted:   aws.Bool(false),
+			},
+		)
+
+		if err != nil {
+			envLog.WithError(err).Error("Problem retrieving environment")
+			return err
+		}
+
+		if len(envs.Environments) == 0 {
+			envLog.WithError(missingEnvironment(client, p.Application, environment)).Error("Environment does not exist")
+			failed = true
+			continue
+		}
+
+		label := aws.StringValue(envs.Environments[0].VersionLabel)
+		envLog = envLog.WithField("versionlabel", label)
+
+		version, err := describeApplicationVersion(client, p.Application, label)
+
+		if err != nil {
+			envLog.WithError(err).Error("Problem retrieving application version")
+			return err
+		}
+
+		if version == nil || version.SourceBundle == nil {
+			envLog.Error("Running version has no source bundle")
+			failed = true
+			continue
+		}
+
+		recorded, err := p.recordedDigest(client, label, version.SourceBundle)
+
+		if err != nil {
+			envLog.WithError(err).Error("Problem retrieving the recorded digest")
+			return err
+		}
+
+		if recorded == "" {
+			envLog.Error("Running version has no recorded provenance")
+			failed = true
+			continue
+		}
+
+		actual, err := p.objectDigest(version.SourceBundle)
+
+		if err != nil {
+			envLog.WithError(err).Error("Problem downloading the source bundle")
+			return err
+		}
+
+		envLog = envLog.WithFields(log.Fields{
+			"recorded": recorded,
+			"actual":   actual,
+		})
+
+		if actual != recorded {
+			envLog.Error("Source bundle does not match the recorded digest")
+			failed = true
+			continue
+		}
+
+		envLog.Info("Source bundle matches the recorded digest")
+	}
+
+	if failed {
+		return errProvenance
+	}
+
+	return nil
+}
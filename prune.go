@@ -0,0 +1,107 @@
+package main
+
+import (
+	"sort"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elasticbeanstalk"
+)
+
+// Pruning deletes the oldest application versions after a successful
+// deploy, so the application stays below the version quota of Beanstalk.
+type Pruning struct {
+	// KeepVersions is the number of most recent versions kept, zero
+	// disables pruning.
+	KeepVersions int
+
+	// DeleteBundles also deletes the source bundles of pruned versions.
+	DeleteBundles bool
+}
+
+// prunable returns the versions beyond the newest keep ones, leaving out
+// the labels still deployed somewhere.
+func prunable(versions []*elasticbeanstalk.ApplicationVersionDescription, keep int, inUse map[string]bool) []*elasticbeanstalk.ApplicationVersionDescription {
+	sorted := append([]*elasticbeanstalk.ApplicationVersionDescription(nil), versions...)
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return aws.TimeValue(sorted[i].DateCreated).After(aws.TimeValue(sorted[j].DateCreated))
+	})
+
+	var out []*elasticbeanstalk.ApplicationVersionDescription
+
+	for i, version := range sorted {
+		if i < keep || inUse[aws.StringValue(version.VersionLabel)] {
+			continue
+		}
+
+		out = append(out, version)
+	}
+
+	return out
+}
+
+// pruneVersions deletes the versions of the application beyond
+// KeepVersions. Problems are only logged, the deploy already succeeded.
+func (p *Plugin) pruneVersions(client *elasticbeanstalk.ElasticBeanstalk) {
+	pruneLog := log.WithFields(log.Fields{
+		"application": p.Application,
+		"keep":        p.Pruning.KeepVersions,
+	})
+
+	versions, err := client.DescribeApplicationVersions(
+		&elasticbeanstalk.DescribeApplicationVersionsInput{
+			ApplicationName: aws.String(p.Application),
+		},
+	)
+
+	if err != nil {
+		pruneLog.WithError(err).Warn("Problem listing application versions, nothing pruned")
+		return
+	}
+
+	envs, err := client.DescribeEnvironments(
+		&elasticbeanstalk.DescribeEnvironmentsInput{
+			ApplicationName: aws.String(p.Application),
+			IncludeDeleted:  aws.Bool(false),
+		},
+	)
+
+	if err != nil {
+		pruneLog.WithError(err).Warn("Problem listing environments, nothing pruned")
+		return
+	}
+
+	inUse := map[string]bool{p.VersionLabel: true}
+
+	for _, env := range envs.Environments {
+		inUse[aws.StringValue(env.VersionLabel)] = true
+	}
+
+	deleted := 0
+
+	for _, version := range prunable(versions.ApplicationVersions, p.Pruning.KeepVersions, inUse) {
+		label := aws.StringValue(version.VersionLabel)
+
+		_, err := client.DeleteApplicationVersion(
+			&elasticbeanstalk.DeleteApplicationVersionInput{
+				ApplicationName:    aws.String(p.Application),
+				VersionLabel:       aws.String(label),
+				DeleteSourceBundle: aws.Bool(p.Pruning.DeleteBundles),
+			},
+		)
+
+		if err != nil {
+			pruneLog.WithError(err).WithField("versionlabel", label).Warn("Problem deleting application version")
+			continue
+		}
+
+		deleted++
+		pruneLog.WithField("versionlabel", label).Debug("Deleted application version")
+	}
+
+	pruneLog.WithFields(log.Fields{
+		"versions": len(versions.ApplicationVersions),
+		"deleted":  deleted,
+	}).Info("Pruned application versions")
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elasticbeanstalk"
+)
+
+func TestPrunable(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// versions v1 to v5, v5 being the newest, listed out of order
+	var versions []*elasticbeanstalk.ApplicationVersionDescription
+
+	for _, n := range []int{3, 1, 5, 2, 4} {
+		versions = append(versions, &elasticbeanstalk.ApplicationVersionDescription{
+			VersionLabel: aws.String("v" + string(rune('0'+n))),
+			DateCreated:  aws.Time(start.Add(time.Duration(n) * time.Hour)),
+		})
+	}
+
+	tests := []struct {
+		name  string
+		keep  int
+		inUse map[string]bool
+		want  []string
+	}{
+		{name: "keep all", keep: 5},
+		{name: "keep more than there are", keep: 10},
+		{name: "oldest first out", keep: 3, want: []string{"v2", "v1"}},
+		{name: "deployed versions stay", keep: 2, inUse: map[string]bool{"v2": true}, want: []string{"v3", "v1"}},
+		{name: "keep none", keep: 0, inUse: map[string]bool{"v5": true}, want: []string{"v4", "v3", "v2", "v1"}},
+	}
+
+	for _, test := range tests {
+		var got []string
+
+		for _, version := range prunable(versions, test.keep, test.inUse) {
+			got = append(got, aws.StringValue(version.VersionLabel))
+		}
+
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
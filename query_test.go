@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// testSession returns a session sending every call to the server.
+func testSession(t *testing.T, handler http.Handler) *session.Session {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	return session.New(&aws.Config{
+		Region:           aws.String("us-east-1"),
+		Endpoint:         aws.String(server.URL),
+		S3ForcePathStyle: aws.Bool(true),
+		MaxRetries:       aws.Int(0),
+		Credentials:      credentials.NewStaticCredentials("key", "secret", ""),
+	})
+}
+
+// querySession returns a session answering query protocol calls with the
+// result the handler returns for the action, or a validation error when it
+// fails.
+func querySession(t *testing.T, handle func(action string, form url.Values) (string, error)) *session.Session {
+	return testSession(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		form, _ := url.ParseQuery(string(body))
+		action := form.Get("Action")
+
+		result, err := handle(action, form)
+
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "<ErrorResponse><Error><Code>ValidationError</Code><Message>%s</Message></Error><RequestId>req</RequestId></ErrorResponse>", err)
+			return
+		}
+
+		fmt.Fprintf(w, "<%[1]sResponse><%[1]sResult>%[2]s</%[1]sResult><ResponseMetadata><RequestId>req</RequestId></ResponseMetadata></%[1]sResponse>", action, result)
+	}))
+}
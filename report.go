@@ -0,0 +1,224 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	outcomeSuccess = "success"
+	outcomeFailed  = "failed"
+	outcomeSkipped = "skipped"
+)
+
+// phase records how long a single step of an environment deploy took.
+type phase struct {
+	Name     string        `json:"name"`
+	Duration time.Duration `json:"-"`
+	Seconds  float64       `json:"seconds"`
+}
+
+// envResult records the outcome of deploying to a single environment.
+type envResult struct {
+	Application     string  `json:"application"`
+	Environment     string  `json:"environment"`
+	Outcome         string  `json:"outcome"`
+	PreviousVersion string  `json:"previous_version"`
+	Version         string  `json:"version"`
+	Phases          []phase `json:"phases"`
+	LastEvent       string  `json:"last_event"`
+	Error           string  `json:"error,omitempty"`
+	FailureClass    string  `json:"failure_class,omitempty"`
+	RolledBackTo    string  `json:"rolled_back_to,omitempty"`
+	Console         string  `json:"console,omitempty"`
+	EnvironmentID   string  `json:"environment_id,omitempty"`
+	CNAME           string  `json:"cname,omitempty"`
+	EndpointURL     string  `json:"endpoint_url,omitempty"`
+	Health          string  `json:"health,omitempty"`
+	Events          int     `json:"events"`
+
+	Baseline *healthMetrics `json:"baseline,omitempty"`
+
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+
+	err   error
+	phase string
+	start time.Time
+
+	// budget is what is left of the deploy timeout, a rollback waits
+	// within it.
+	budget *waitBudget
+}
+
+func newEnvResult(application, environment, version string) *envResult {
+	return &envResult{
+		Application: application,
+		Environment: environment,
+		Version:     version,
+		Started:     time.Now(),
+	}
+}
+
+// begin closes the running phase, if any, and starts timing a new one.
+func (r *envResult) begin(name string) {
+	r.end()
+
+	r.phase = name
+	r.start = time.Now()
+}
+
+// end records the duration of the running phase.
+func (r *envResult) end() {
+	if r.phase == "" {
+		return
+	}
+
+	elapsed := time.Since(r.start)
+
+	r.Phases = append(r.Phases, phase{
+		Name:     r.phase,
+		Duration: elapsed,
+		Seconds:  elapsed.Seconds(),
+	})
+	r.phase = ""
+}
+
+// finish stores the final error of the deploy and derives the outcome.
+func (r *envResult) finish(err error) *envResult {
+	r.end()
+	r.err = err
+	r.Finished = time.Now()
+	r.Outcome = outcomeSuccess
+
+	if err != nil {
+		r.Outcome = outcomeFailed
+		r.Error = err.Error()
+		r.FailureClass = string(classifyError(err))
+	}
+
+	return r
+}
+
+// skip marks an environment the deploy never reached.
+func (r *envResult) skip() *envResult {
+	r.Finished = r.Started
+	r.Outcome = outcomeSkipped
+
+	return r
+}
+
+// attempted leaves out the environments that were skipped.
+func attempted(results []*envResult) []*envResult {
+	var out []*envResult
+
+	for _, r := range results {
+		if r.Outcome != outcomeSkipped {
+			out = append(out, r)
+		}
+	}
+
+	return out
+}
+
+// writeReport prints the results as a table or, with format json, as a JSON
+// document.
+func writeReport(w io.Writer, format string, results []*envResult) error {
+	if format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(results)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "APPLICATION\tENVIRONMENT\tOUTCOME\tVERSION\tPHASES\tLAST EVENT")
+
+	for _, r := range results {
+		outcome := r.Outcome
+
+		if r.FailureClass != "" {
+			outcome = fmt.Sprintf("%s (%s)", r.Outcome, r.FailureClass)
+		}
+
+		if r.RolledBackTo != "" {
+			outcome = fmt.Sprintf("%s, rolled back to %s", outcome, r.RolledBackTo)
+		}
+
+		phases := make([]string, 0, len(r.Phases))
+
+		for _, ph := range r.Phases {
+			phases = append(phases, fmt.Sprintf("%s=%s", ph.Name, ph.Duration.Round(time.Second)))
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s -> %s\t%s\t%s\n",
+			r.Application,
+			r.Environment,
+			outcome,
+			orDash(r.PreviousVersion),
+			r.Version,
+			strings.Join(phases, " "),
+			orDash(r.LastEvent),
+		)
+	}
+
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	for _, r := range results {
+		if r.Outcome == outcomeSuccess && r.CNAME != "" {
+			fmt.Fprintf(w, "\n%s is live at %s (endpoint %s, id %s)\n", r.Environment, r.url(), orDash(r.EndpointURL), orDash(r.EnvironmentID))
+		}
+	}
+
+	return nil
+}
+
+// resultsError combines the errors of every failed environment. The combined
+// failure is only transient when every single failure is.
+func resultsError(results []*envResult) error {
+	var failed []string
+	class := failureTransient
+
+	for _, r := range results {
+		if r.err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %s", r.Environment, r.err))
+
+			if classifyError(r.err) == failurePermanent {
+				class = failurePermanent
+			}
+		}
+	}
+
+	if len(failed) == 0 {
+		return nil
+	}
+
+	if len(results) == 1 {
+		return results[0].err
+	}
+
+	return &failure{
+		err:   fmt.Errorf("%d of %d environments failed (%s)", len(failed), len(results), strings.Join(failed, "; ")),
+		class: class,
+	}
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+
+	return s
+}
+
+func printReport(format string, results []*envResult) {
+	if err := writeReport(os.Stdout, format, results); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/ssm"
+)
+
+// failedCall is an AWS API call that failed for good.
+type failedCall struct {
+	Operation string
+	RequestID string
+}
+
+// requestLog collects the request IDs of failed AWS calls, which AWS
+// support asks for.
+type requestLog struct {
+	mu    sync.Mutex
+	calls []failedCall
+}
+
+// install records every call failing after its last retry, leaving out the
+// expected failures.
+func (l *requestLog) install(handlers *request.Handlers) {
+	handlers.AfterRetry.PushBack(func(r *request.Request) {
+		if r.Error == nil || expectedFailure(r) {
+			return
+		}
+
+		id := r.RequestID
+
+		if id == "" && r.HTTPResponse != nil {
+			id = r.HTTPResponse.Header.Get("X-Amz-Request-Id")
+		}
+
+		log.WithFields(log.Fields{
+			"service":    r.ClientInfo.ServiceName,
+			"operation":  r.Operation.Name,
+			"request-id": id,
+		}).Warning("AWS call failed")
+
+		if id == "" {
+			return
+		}
+
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		l.calls = append(l.calls, failedCall{Operation: r.Operation.Name, RequestID: id})
+	})
+}
+
+// expectedFailure reports whether the call failed with an answer its caller
+// expects, such as a missing object or parameter looked up to see whether it
+// exists, or a conditional write to S3 losing to another deploy.
+func expectedFailure(r *request.Request) bool {
+	if r.HTTPResponse != nil {
+		switch r.HTTPResponse.StatusCode {
+		case http.StatusNotFound:
+			return true
+		case http.StatusConflict, http.StatusPreconditionFailed:
+			return r.ClientInfo.ServiceName == s3.ServiceName
+		}
+	}
+
+	aerr, ok := r.Error.(awserr.Error)
+
+	return ok && aerr.Code() == ssm.ErrCodeParameterNotFound
+}
+
+// annotate adds the request IDs of the failed calls to the error, keeping
+// its failure class.
+func (l *requestLog) annotate(err error) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.calls) == 0 {
+		return err
+	}
+
+	ids := make([]string, 0, len(l.calls))
+
+	for _, call := range l.calls {
+		ids = append(ids, call.Operation+"="+call.RequestID)
+	}
+
+	return &failure{
+		err:   fmt.Errorf("%s (AWS request ids: %s)", err, strings.Join(ids, ", ")),
+		class: classifyError(err),
+	}
+}
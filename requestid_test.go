@@ -0,0 +1,42 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elasticbeanstalk"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+func TestRequestLogSkipsExpectedFailures(t *testing.T) {
+	bucket := &fakeBucket{objects: map[string][]byte{}}
+
+	s3Sess := testSession(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Amz-Request-Id", "s3-req")
+		bucket.ServeHTTP(w, r)
+	}))
+
+	ebSess := testSession(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Amzn-Requestid", "eb-req")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("<ErrorResponse><Error><Code>ValidationError</Code><Message>invalid environment</Message></Error></ErrorResponse>"))
+	}))
+
+	l := &requestLog{}
+	l.install(&s3Sess.Handlers)
+	l.install(&ebSess.Handlers)
+
+	// looking up a missing object is how existence is checked
+	if _, err := s3.New(s3Sess).HeadObject(&s3.HeadObjectInput{Bucket: aws.String("bucket"), Key: aws.String("missing")}); err == nil {
+		t.Fatal("missing object found")
+	}
+
+	if _, err := elasticbeanstalk.New(ebSess).DescribeEnvironments(&elasticbeanstalk.DescribeEnvironmentsInput{}); err == nil {
+		t.Fatal("failing call succeeded")
+	}
+
+	if len(l.calls) != 1 || l.calls[0] != (failedCall{Operation: "DescribeEnvironments", RequestID: "eb-req"}) {
+		t.Errorf("got calls %+v, want the DescribeEnvironments failure only", l.calls)
+	}
+}
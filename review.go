@@ -0,0 +1,196 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elasticbeanstalk"
+)
+
+const scheduledActionNamespace = "aws:autoscaling:scheduledaction"
+
+const (
+	reviewActionDeploy  = "deploy"
+	reviewActionCleanup = "cleanup"
+
+	// maxEnvironmentName is the longest environment name Beanstalk accepts.
+	maxEnvironmentName = 40
+
+	githubURL = "https://api.github.com"
+)
+
+var invalidEnvironmentChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// ReviewApp deploys pull requests to throwaway environments named after the
+// pull request, or the branch outside of pull requests, and terminates them
+// again with the cleanup action or once the pull request is closed.
+type ReviewApp struct {
+	Enabled bool
+	Prefix  string
+	Action  string
+
+	// Schedule scales the review environments down outside working hours.
+	Schedule ScaleSchedule
+
+	// GitHubToken posts the URL of the review app on the pull request.
+	GitHubToken string
+	GitHubURL   string
+}
+
+// ScaleSchedule scales environments to zero instances on the ScaleDown cron
+// expression and back to Capacity instances on the ScaleUp one, both in UTC.
+type ScaleSchedule struct {
+	ScaleDown string
+	ScaleUp   string
+	Capacity  int
+}
+
+// optionSettings translates the schedule to scheduled action settings.
+func (s *ScaleSchedule) optionSettings() []*elasticbeanstalk.ConfigurationOptionSetting {
+	if s.ScaleDown == "" {
+		return nil
+	}
+
+	settings := scheduledAction("ScaleDownReviewApp", s.ScaleDown, 0)
+
+	if s.ScaleUp != "" {
+		settings = append(settings, scheduledAction("ScaleUpReviewApp", s.ScaleUp, s.Capacity)...)
+	}
+
+	return settings
+}
+
+// scheduledAction sets the capacity of the environment on the recurrence.
+func scheduledAction(name, recurrence string, capacity int) []*elasticbeanstalk.ConfigurationOptionSetting {
+	values := [][2]string{
+		{"Recurrence", recurrence},
+		{"MinSize", fmt.Sprint(capacity)},
+		{"MaxSize", fmt.Sprint(capacity)},
+		{"DesiredCapacity", fmt.Sprint(capacity)},
+	}
+
+	settings := make([]*elasticbeanstalk.ConfigurationOptionSetting, 0, len(values))
+
+	for _, v := range values {
+		setting := optionSetting(scheduledActionNamespace, v[0], v[1])
+		setting.ResourceName = aws.String(name)
+		settings = append(settings, setting)
+	}
+
+	return settings
+}
+
+// reviewEnvironmentName derives a valid environment name for the review app.
+func (p *Plugin) reviewEnvironmentName() string {
+	prefix := p.ReviewApp.Prefix
+
+	if prefix == "" {
+		prefix = p.Application
+	}
+
+	suffix := p.Commit.Branch
+
+	if p.Build.PullRequest != 0 {
+		suffix = fmt.Sprintf("pr%d", p.Build.PullRequest)
+	}
+
+	name := invalidEnvironmentChars.ReplaceAllString(strings.ToLower(prefix+"-"+suffix), "-")
+	name = strings.Trim(name, "-")
+
+	if len(name) > maxEnvironmentName {
+		name = strings.TrimRight(name[:maxEnvironmentName], "-")
+	}
+
+	return name
+}
+
+// reviewCleanup reports whether the review app is to be terminated, either
+// explicitly or because the pull request was closed.
+func (p *Plugin) reviewCleanup() bool {
+	return p.ReviewApp.Action == reviewActionCleanup || p.Build.Action == "closed"
+}
+
+// prepareReviewApp points the deploy at the review environment, creating it
+// when it does not exist yet.
+func (p *Plugin) prepareReviewApp() {
+	p.EnvironmentName = p.reviewEnvironmentName()
+	p.Environments = nil
+	p.EnvironmentUpdate = true
+	p.AutoCreateEnvironment = true
+	p.Creation.Schedule = p.ReviewApp.Schedule
+
+	log.WithField("environment", p.EnvironmentName).Info("Deploying review app")
+}
+
+// terminateReviewApp terminates the review environment, a missing one is
+// not an error since it might have been cleaned up already.
+func (p *Plugin) terminateReviewApp(client *elasticbeanstalk.ElasticBeanstalk) error {
+	environment := p.reviewEnvironmentName()
+	envLog := log.WithField("environment", environment)
+
+	existing, err := findEnvironment(client, p.Application, environment)
+
+	if err != nil {
+		envLog.WithError(err).Error("Problem retrieving environment information")
+		return err
+	}
+
+	if existing == nil {
+		envLog.WithField("reason", missingEnvironment(client, p.Application, environment).Error()).Info("Review app does not exist, nothing to clean up")
+		return nil
+	}
+
+	if aws.StringValue(existing.Status) == elasticbeanstalk.EnvironmentStatusTerminating {
+		envLog.Info("Review app is already terminating, nothing to clean up")
+		return nil
+	}
+
+	_, err = client.TerminateEnvironment(&elasticbeanstalk.TerminateEnvironmentInput{
+		EnvironmentName: aws.String(environment),
+	})
+
+	if err != nil {
+		envLog.WithError(err).Error("Problem terminating review app")
+		return err
+	}
+
+	envLog.Info("Review app is terminating")
+
+	return nil
+}
+
+// announceReviewApp logs the URL of the review app and posts it on the pull
+// request. Problems are only logged.
+func (p *Plugin) announceReviewApp(client *elasticbeanstalk.ElasticBeanstalk) {
+	envLog := log.WithField("environment", p.EnvironmentName)
+
+	env, err := findEnvironment(client, p.Application, p.EnvironmentName)
+
+	if err != nil || env == nil || aws.StringValue(env.CNAME) == "" {
+		envLog.WithError(err).Warning("Problem retrieving the review app URL")
+		return
+	}
+
+	url := "http://" + aws.StringValue(env.CNAME)
+
+	envLog.WithField("url", url).Info("Review app is available")
+
+	if p.ReviewApp.GitHubToken == "" || p.Build.PullRequest == 0 {
+		return
+	}
+
+	err = postJSON(
+		fmt.Sprintf("%s/repos/%s/issues/%d/comments", p.ReviewApp.GitHubURL, p.Repo.FullName, p.Build.PullRequest),
+		map[string]string{"Authorization": "token " + p.ReviewApp.GitHubToken},
+		map[string]string{
+			"body": fmt.Sprintf("Review app for %s is available at %s", shortSHA(p.Commit.SHA), url),
+		},
+	)
+
+	if err != nil {
+		envLog.WithError(err).Warning("Problem posting the review app URL")
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elasticbeanstalk"
+)
+
+// isErrorSeverity reports whether an event severity means the deploy failed.
+func isErrorSeverity(severity string) bool {
+	return severity == elasticbeanstalk.EventSeverityError ||
+		severity == elasticbeanstalk.EventSeverityFatal
+}
+
+// firstError returns the first error or fatal event of the events.
+func firstError(events []*elasticbeanstalk.EventDescription) *elasticbeanstalk.EventDescription {
+	for _, event := range events {
+		if isErrorSeverity(aws.StringValue(event.Severity)) {
+			return event
+		}
+	}
+
+	return nil
+}
+
+// rollback aborts the running update and brings the environment back to the
+// version it was running before the deploy, within what is left of the
+// deploy timeout. The original failure is kept as the result of the deploy,
+// rollback problems are only logged.
+func (p *Plugin) rollback(client *elasticbeanstalk.ElasticBeanstalk, envLog *log.Entry, environment string, result *envResult) {
+	previous := result.PreviousVersion
+
+	appFields := envLog.WithFields(log.Fields{
+		"application":  p.Application,
+		"versionlabel": previous,
+	})
+
+	if previous == "" {
+		appFields.Warn("No previous version known, skipping rollback")
+		return
+	}
+
+	result.begin("rollback")
+
+	budget := result.budget
+
+	if budget == nil {
+		budget = newWaitBudget(p.Timeout, p.Polling)
+	}
+
+	current, err := findEnvironment(client, p.Application, environment)
+
+	if err != nil {
+		appFields.WithError(err).Error("Rollback failed")
+		return
+	}
+
+	if current != nil && aws.StringValue(current.Status) == elasticbeanstalk.EnvironmentStatusUpdating {
+		abortEnvironmentUpdate(client, appFields, environment)
+	}
+
+	env, err := waitEnvironmentToBeReady(client, envLog, p.Application, environment, budget)
+
+	if err != nil {
+		appFields.WithError(err).Error("Rollback failed")
+		return
+	}
+
+	if aws.StringValue(env.VersionLabel) != previous {
+		appFields.Info("Rolling back")
+
+		_, err = client.UpdateEnvironment(
+			&elasticbeanstalk.UpdateEnvironmentInput{
+				VersionLabel:    aws.String(previous),
+				ApplicationName: aws.String(p.Application),
+				EnvironmentName: aws.String(environment),
+			},
+		)
+
+		if err != nil {
+			appFields.WithError(err).Error("Problem rolling back")
+			return
+		}
+
+		env, err = waitEnvironmentToBeReady(client, envLog, p.Application, environment, budget)
+
+		if err != nil {
+			appFields.WithError(err).Error("Rollback failed")
+			return
+		}
+	}
+
+	if aws.StringValue(env.VersionLabel) != previous {
+		appFields.WithError(errNotFinished).Error("Rollback failed, please check EB environment logs")
+		return
+	}
+
+	result.RolledBackTo = previous
+	appFields.Info("Rollback finished successfully")
+}
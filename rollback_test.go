@@ -0,0 +1,24 @@
+package main
+
+import "testing"
+
+func TestRollbackLeavesReadyEnvironments(t *testing.T) {
+	f := newFakeAWS(t, "app-web")
+	f.failing["app-web"] = true
+
+	p := f.plugin()
+	p.EnvironmentName = "app-web"
+	p.AutoRollback = true
+
+	if err := p.Exec(); err == nil {
+		t.Fatal("deploy succeeded with a failing environment")
+	}
+
+	if n := f.count("AbortEnvironmentUpdate"); n != 0 {
+		t.Errorf("aborted a ready environment %d times", n)
+	}
+
+	if len(p.results) != 1 || p.results[0].RolledBackTo != "v1" {
+		t.Errorf("results %+v", p.results)
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/service/elasticbeanstalk"
+)
+
+// Stage is a step of a rollout plan. Its environments are updated one after
+// the other, or all at once when parallel, and the next stage only starts
+// once every environment of the stage is verified and the bake time passed.
+type Stage struct {
+	Name         string   `json:"name"`
+	Environments []string `json:"environments"`
+	Parallel     bool     `json:"parallel"`
+	Bake         string   `json:"bake"`
+
+	bake time.Duration
+}
+
+// parseRollout reads the rollout setting, Drone hands YAML lists over as
+// JSON.
+func parseRollout(setting string) ([]Stage, error) {
+	if setting == "" {
+		return nil, nil
+	}
+
+	var stages []Stage
+
+	if err := json.Unmarshal([]byte(setting), &stages); err != nil {
+		return nil, err
+	}
+
+	for i := range stages {
+		stage := &stages[i]
+
+		if stage.Name == "" {
+			stage.Name = fmt.Sprintf("stage %d", i+1)
+		}
+
+		if len(stage.Environments) == 0 {
+			return nil, fmt.Errorf("%s has no environments", stage.Name)
+		}
+
+		if stage.Bake != "" {
+			d, err := time.ParseDuration(stage.Bake)
+
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid bake time: %s", stage.Name, err)
+			}
+
+			stage.bake = d
+		}
+	}
+
+	return stages, nil
+}
+
+// environments returns every environment the version is deployed to.
+func (p *Plugin) environments() []string {
+	if len(p.Rollout) > 0 {
+		var environments []string
+
+		for _, stage := range p.Rollout {
+			environments = append(environments, stage.Environments...)
+		}
+
+		return environments
+	}
+
+	if len(p.Environments) > 0 {
+		return p.Environments
+	}
+
+	return []string{p.EnvironmentName}
+}
+
+// updateEnvironments updates the environments of the rollout plan, or the
+// configured environments one after the other, or all at once when
+// Parallel, without one.
+func (p *Plugin) updateEnvironments(client *elasticbeanstalk.ElasticBeanstalk) []*envResult {
+	if len(p.Rollout) > 0 {
+		return p.runRollout(client, p.Rollout)
+	}
+
+	return p.runRollout(client, []Stage{
+		{Name: "environments", Environments: p.environments(), Parallel: p.Parallel},
+	})
+}
+
+// runRollout runs the stages in order and pauses the rollout at the first
+// stage failing more environments than MaxStageFailures allows, the
+// environments left are reported as skipped. With a StateFile the progress
+// is stored all along, so the rollout can be resumed.
+func (p *Plugin) runRollout(client *elasticbeanstalk.ElasticBeanstalk, stages []Stage) []*envResult {
+	var results []*envResult
+	var progress *rolloutProgress
+
+	if p.StateFile != "" {
+		var completed []string
+
+		progress, stages, completed = p.newProgress(stages)
+		results = append(results, p.skipEnvironments(completed)...)
+	}
+
+	paused := false
+
+	for i, stage := range stages {
+		stageLog := log.WithField("stage", stage.Name)
+
+		if paused {
+			results = append(results, p.skipEnvironments(stage.Environments)...)
+			continue
+		}
+
+		stageLog.WithField("environments", stage.Environments).Infof("Starting stage %d of %d", i+1, len(stages))
+
+		stageResults := p.runStage(client, stage, progress)
+		results = append(results, stageResults...)
+
+		if p.stageFailed(stageResults, len(stage.Environments)) {
+			stageLog.Error("Stage failed, pausing the rollout")
+			paused = true
+			continue
+		}
+
+		if stage.bake > 0 && i < len(stages)-1 {
+			stageLog.WithField("bake", stage.bake).Info("Stage succeeded, baking before the next stage")
+			time.Sleep(stage.bake)
+		}
+	}
+
+	switch {
+	case progress == nil:
+	case paused:
+		log.WithField("state-file", p.StateFile).Info("Rollout paused, run the resume action to continue")
+	case resultsError(results) == nil:
+		progress.finish()
+	}
+
+	return results
+}
+
+// stageFailed reports whether more environments of the stage failed than
+// MaxStageFailures percent of it.
+func (p *Plugin) stageFailed(results []*envResult, total int) bool {
+	failed := 0
+
+	for _, r := range results {
+		if r.err != nil {
+			failed++
+		}
+	}
+
+	return failed > 0 && float64(failed)*100/float64(total) > p.MaxStageFailures
+}
+
+// runStage updates the environments of a single stage. Sequential stages
+// stop as soon as the stage failed.
+func (p *Plugin) runStage(client *elasticbeanstalk.ElasticBeanstalk, stage Stage, progress *rolloutProgress) []*envResult {
+	results := make([]*envResult, len(stage.Environments))
+
+	if !stage.Parallel {
+		for i, environment := range stage.Environments {
+			results[i] = p.trackedUpdate(client, environment, progress)
+
+			if p.stageFailed(results[:i+1], len(stage.Environments)) {
+				return append(results[:i+1], p.skipEnvironments(stage.Environments[i+1:])...)
+			}
+		}
+
+		return results
+	}
+
+	var wg sync.WaitGroup
+
+	for i, environment := range stage.Environments {
+		wg.Add(1)
+
+		go func(i int, environment string) {
+			defer wg.Done()
+			results[i] = p.trackedUpdate(client, environment, progress)
+		}(i, environment)
+	}
+
+	wg.Wait()
+
+	return results
+}
+
+// trackedUpdate updates the environment and records it in the progress.
+func (p *Plugin) trackedUpdate(client *elasticbeanstalk.ElasticBeanstalk, environment string, progress *rolloutProgress) *envResult {
+	if progress == nil {
+		return p.updateEnvironment(client, environment)
+	}
+
+	progress.start(environment)
+	result := p.updateEnvironment(client, environment)
+	progress.done(environment, result.err == nil)
+
+	return result
+}
+
+// skipEnvironments reports environments the rollout never reached.
+func (p *Plugin) skipEnvironments(environments []string) []*envResult {
+	results := make([]*envResult, 0, len(environments))
+
+	for _, environment := range environments {
+		results = append(results, newEnvResult(p.Application, environment, p.VersionLabel).skip())
+	}
+
+	return results
+}
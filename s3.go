@@ -0,0 +1,36 @@
+package main
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// uploadPartSize is the size of the parts bundles are uploaded in, larger
+// bundles are uploaded in parts retried one by one instead of a single PUT
+// limited to 5 GB.
+const uploadPartSize = 64 * 1024 * 1024
+
+// uploadObject uploads the object, in parts when it is larger than a part.
+func uploadObject(p client.ConfigProvider, input *s3manager.UploadInput) error {
+	uploader := s3manager.NewUploader(p, func(u *s3manager.Uploader) {
+		u.PartSize = uploadPartSize
+	})
+
+	_, err := uploader.Upload(input)
+	return err
+}
+
+// presignObject returns a URL downloading the object without credentials
+// until it expires.
+func presignObject(p client.ConfigProvider, bucket, key string, expiry time.Duration) (string, error) {
+	req, _ := s3.New(p).GetObjectRequest(&s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+
+	return req.Presign(expiry)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+func TestUploadObjectInParts(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		parts int
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		switch {
+		case r.Method == "POST" && query.Get("uploadId") == "":
+			w.Write([]byte(`<InitiateMultipartUploadResult><UploadId>upload</UploadId></InitiateMultipartUploadResult>`))
+		case r.Method == "POST":
+			w.Write([]byte(`<CompleteMultipartUploadResult/>`))
+		case r.Method == "PUT" && query.Get("partNumber") != "":
+			mu.Lock()
+			parts++
+			mu.Unlock()
+
+			w.Header().Set("ETag", `"part"`)
+		default:
+			t.Errorf("unexpected %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	sess := session.New(&aws.Config{
+		Region:           aws.String("us-east-1"),
+		Endpoint:         aws.String(server.URL),
+		S3ForcePathStyle: aws.Bool(true),
+		Credentials:      credentials.NewStaticCredentials("key", "secret", ""),
+	})
+
+	err := uploadObject(sess, &s3manager.UploadInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("app/v2.zip"),
+		Body:   bytes.NewReader(make([]byte, uploadPartSize+1)),
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if parts != 2 {
+		t.Errorf("got %d parts, want 2", parts)
+	}
+}
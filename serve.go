@@ -0,0 +1,360 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elasticbeanstalk"
+)
+
+const actionServe = "serve"
+
+var errServeToken = errors.New("serve needs a token to authenticate requests")
+
+// Serve exposes deploys, rollbacks and the environment status over HTTP,
+// every deploy runs through Exec like the plugin does in a pipeline.
+type Serve struct {
+	Addr  string
+	Token string
+}
+
+// serveRequest names the version to deploy, empty fields fall back to the
+// plugin settings. Bundles are registered from S3, a request never uploads.
+type serveRequest struct {
+	Application  string `json:"application"`
+	Environment  string `json:"environment"`
+	VersionLabel string `json:"version_label"`
+	Bucket       string `json:"bucket"`
+	BucketKey    string `json:"bucket_key"`
+	Description  string `json:"description"`
+}
+
+type serveResponse struct {
+	Outcome      string       `json:"outcome"`
+	Error        string       `json:"error,omitempty"`
+	FailureClass string       `json:"failure_class,omitempty"`
+	Results      []*envResult `json:"results,omitempty"`
+}
+
+type environmentStatus struct {
+	Environment string `json:"environment"`
+	Status      string `json:"status"`
+	Health      string `json:"health"`
+	Version     string `json:"version"`
+	CNAME       string `json:"cname"`
+	Console     string `json:"console,omitempty"`
+}
+
+// server handles the requests, a single deploy runs at a time.
+type server struct {
+	plugin *Plugin
+	client *elasticbeanstalk.ElasticBeanstalk
+	busy   chan struct{}
+}
+
+// serve listens until the server fails.
+func (p *Plugin) serve(client *elasticbeanstalk.ElasticBeanstalk) error {
+	if p.Serve.Token == "" {
+		return errServeToken
+	}
+
+	s := &server{
+		plugin: p,
+		client: client,
+		busy:   make(chan struct{}, 1),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/deploy", s.authenticated(s.deploy))
+	mux.HandleFunc("/rollback", s.authenticated(s.rollback))
+	mux.HandleFunc("/status", s.authenticated(s.status))
+
+	log.WithField("addr", p.Serve.Addr).Info("Serving deploys")
+
+	return http.ListenAndServe(p.Serve.Addr, mux)
+}
+
+// authenticated refuses requests without the bearer token.
+func (s *server) authenticated(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := []byte("Bearer " + s.plugin.Serve.Token)
+
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), token) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// clone copies the plugin for a single request, the slices and maps a
+// deploy may change are copied so requests never share them.
+func (p *Plugin) clone() *Plugin {
+	q := *p
+
+	q.Environments = append([]string(nil), p.Environments...)
+	q.Checks = append([]HTTPCheck(nil), p.Checks...)
+	q.WARs = append([]string(nil), p.WARs...)
+	q.Rollout = append([]Stage(nil), p.Rollout...)
+	q.NginxConfigs = append([]string(nil), p.NginxConfigs...)
+	q.RemoveEnvVars = append([]string(nil), p.RemoveEnvVars...)
+	q.VisibleEnvVars = append([]string(nil), p.VisibleEnvVars...)
+	q.ProductionEnvironments = append([]string(nil), p.ProductionEnvironments...)
+
+	q.OptionSettings = nil
+
+	for _, setting := range p.OptionSettings {
+		s := *setting
+		q.OptionSettings = append(q.OptionSettings, &s)
+	}
+
+	q.Tags = map[string]string{}
+
+	for key, value := range p.Tags {
+		q.Tags[key] = value
+	}
+
+	q.OutputNames = map[string][]string{}
+
+	for setting, names := range p.OutputNames {
+		q.OutputNames[setting] = append([]string(nil), names...)
+	}
+
+	// each request waits for its own approval
+	if p.Approval != nil {
+		q.Approval = &Approval{
+			Environments: append([]string(nil), p.Approval.Environments...),
+			File:         p.Approval.File,
+			URL:          p.Approval.URL,
+			Parameter:    p.Approval.Parameter,
+			Value:        p.Approval.Value,
+			Timeout:      p.Approval.Timeout,
+		}
+	}
+
+	return &q
+}
+
+// forRequest returns a copy of the plugin deploying the requested version.
+func (p *Plugin) forRequest(req serveRequest) *Plugin {
+	q := p.clone()
+	q.Action = actionDeploy
+	q.AbortOnCancel = false
+	q.Deployments = nil
+	q.results = nil
+	q.bundleChecksum = ""
+	q.reusedVersion = false
+	q.attestation = nil
+
+	// nothing local to upload in a server
+	q.Artifact = ""
+	q.Source = ""
+	q.WARs = nil
+	q.DotNet.Sites = nil
+	q.Binary = ""
+
+	if req.Application != "" {
+		q.Application = req.Application
+	}
+
+	q.EnvironmentName = req.Environment
+	q.Environments = nil
+	q.VersionLabel = req.VersionLabel
+	q.Bucket = req.Bucket
+	q.BucketKey = req.BucketKey
+
+	if req.Description != "" {
+		q.Description = req.Description
+	}
+
+	return q
+}
+
+// run deploys the request and writes the outcome.
+func (s *server) run(w http.ResponseWriter, req serveRequest) {
+	select {
+	case s.busy <- struct{}{}:
+		defer func() { <-s.busy }()
+	default:
+		http.Error(w, "a deploy is already running", http.StatusConflict)
+		return
+	}
+
+	q := s.plugin.forRequest(req)
+	err := q.Exec()
+
+	resp := serveResponse{Outcome: outcomeSuccess, Results: q.results}
+	status := http.StatusOK
+
+	if err != nil {
+		resp.Outcome = outcomeFailed
+		resp.Error = err.Error()
+		resp.FailureClass = string(classifyError(err))
+		status = http.StatusBadGateway
+	}
+
+	writeJSON(w, status, resp)
+}
+
+// decode reads the request body, answering the bad ones itself.
+func decode(w http.ResponseWriter, r *http.Request) (serveRequest, bool) {
+	req := serveRequest{}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return req, false
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return req, false
+	}
+
+	if req.Environment == "" {
+		http.Error(w, "environment is required", http.StatusBadRequest)
+		return req, false
+	}
+
+	return req, true
+}
+
+// deploy registers the version, when a bundle is given, and deploys it.
+func (s *server) deploy(w http.ResponseWriter, r *http.Request) {
+	req, ok := decode(w, r)
+
+	if !ok {
+		return
+	}
+
+	if req.VersionLabel == "" {
+		http.Error(w, "version_label is required", http.StatusBadRequest)
+		return
+	}
+
+	s.run(w, req)
+}
+
+// rollback deploys the given version or else the last version the history
+// records as deployed successfully before the running one.
+func (s *server) rollback(w http.ResponseWriter, r *http.Request) {
+	req, ok := decode(w, r)
+
+	if !ok {
+		return
+	}
+
+	req.Bucket, req.BucketKey = "", ""
+
+	if req.VersionLabel == "" {
+		label, err := s.plugin.forRequest(req).previousGoodVersion(s.client)
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+
+		req.VersionLabel = label
+	}
+
+	s.run(w, req)
+}
+
+// previousGoodVersion finds the version to roll the environment back to.
+func (p *Plugin) previousGoodVersion(client *elasticbeanstalk.ElasticBeanstalk) (string, error) {
+	if p.History == nil {
+		return "", errors.New("a history store or a version_label is needed to roll back")
+	}
+
+	envs, err := client.DescribeEnvironments(
+		&elasticbeanstalk.DescribeEnvironmentsInput{
+			ApplicationName:  aws.String(p.Application),
+			EnvironmentNames: aws.StringSlice([]string{p.EnvironmentName}),
+			IncludeDeleted:   aws.Bool(false),
+		},
+	)
+
+	if err != nil {
+		return "", err
+	}
+
+	if len(envs.Environments) == 0 {
+		return "", missingEnvironment(client, p.Application, p.EnvironmentName)
+	}
+
+	running := aws.StringValue(envs.Environments[0].VersionLabel)
+
+	records, err := p.History.Records(p.Application, p.EnvironmentName)
+
+	if err != nil {
+		return "", err
+	}
+
+	for i := len(records) - 1; i >= 0; i-- {
+		record := records[i]
+
+		if record.Action != "deploy" || record.Outcome != outcomeSuccess || record.Version == running {
+			continue
+		}
+
+		if _, bad := knownBad(records, record.Version); !bad {
+			return record.Version, nil
+		}
+	}
+
+	return "", errors.New("no good version to roll back to is known")
+}
+
+// status lists the environments of the application.
+func (s *server) status(w http.ResponseWriter, r *http.Request) {
+	p := s.plugin
+	application := r.URL.Query().Get("application")
+
+	if application == "" {
+		application = p.Application
+	}
+
+	in := &elasticbeanstalk.DescribeEnvironmentsInput{
+		ApplicationName: aws.String(application),
+		IncludeDeleted:  aws.Bool(false),
+	}
+
+	if environment := r.URL.Query().Get("environment"); environment != "" {
+		in.EnvironmentNames = aws.StringSlice([]string{environment})
+	}
+
+	envs, err := s.client.DescribeEnvironments(in)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	statuses := []environmentStatus{}
+
+	for _, env := range envs.Environments {
+		statuses = append(statuses, environmentStatus{
+			Environment: aws.StringValue(env.EnvironmentName),
+			Status:      aws.StringValue(env.Status),
+			Health:      aws.StringValue(env.Health),
+			Version:     aws.StringValue(env.VersionLabel),
+			CNAME:       aws.StringValue(env.CNAME),
+			Console:     consoleURL(p.Region, aws.StringValue(env.EnvironmentId)),
+		})
+	}
+
+	writeJSON(w, http.StatusOK, statuses)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.WithError(err).Warn("Problem writing the response")
+	}
+}
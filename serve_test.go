@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elasticbeanstalk"
+)
+
+// freeAddr returns a local address nothing listens on.
+func freeAddr(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer l.Close()
+
+	return l.Addr().String()
+}
+
+func TestServeDeploy(t *testing.T) {
+	f := newFakeAWS(t, "app-web")
+	p := f.plugin()
+	p.Action = actionServe
+	p.Serve = Serve{Addr: freeAddr(t), Token: "secret"}
+
+	go p.Exec()
+
+	body := `{"environment": "app-web", "version_label": "v3"}`
+	var resp *http.Response
+
+	// the server starts listening once exec created the clients
+	for i := 0; i < 100; i++ {
+		req, _ := http.NewRequest(http.MethodPost, "http://"+p.Serve.Addr+"/deploy", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer secret")
+
+		var err error
+
+		if resp, err = http.DefaultClient.Do(req); err == nil {
+			break
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if resp == nil {
+		t.Fatal("server never answered")
+	}
+
+	defer resp.Body.Close()
+
+	out := serveResponse{}
+
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != http.StatusOK || out.Outcome != outcomeSuccess {
+		t.Fatalf("got %d %s: %s", resp.StatusCode, out.Outcome, out.Error)
+	}
+
+	if version := f.environment("app-web").version; version != "v3" {
+		t.Errorf("environment runs %s, want v3", version)
+	}
+}
+
+func TestForRequestCopies(t *testing.T) {
+	p := &Plugin{
+		Tags:           map[string]string{"team": "web"},
+		OptionSettings: []*elasticbeanstalk.ConfigurationOptionSetting{{Value: aws.String("a")}},
+		Approval:       &Approval{Environments: []string{"app-prod"}},
+	}
+
+	q := p.forRequest(serveRequest{Environment: "app-web", VersionLabel: "v3"})
+	q.Tags["team"] = "api"
+	q.OptionSettings[0].Value = aws.String("b")
+	q.Approval.Environments[0] = "app-dev"
+
+	if p.Tags["team"] != "web" || aws.StringValue(p.OptionSettings[0].Value) != "a" || p.Approval.Environments[0] != "app-prod" {
+		t.Error("request changed the settings of the server")
+	}
+}
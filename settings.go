@@ -0,0 +1,374 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elasticbeanstalk"
+)
+
+// settingChange describes how a single option setting would change.
+type settingChange struct {
+	Namespace  string `json:"namespace"`
+	OptionName string `json:"option_name"`
+	From       string `json:"from"`
+	To         string `json:"to"`
+}
+
+// currentOptionSettings returns the option settings the environment runs with.
+func currentOptionSettings(client *elasticbeanstalk.ElasticBeanstalk, application, environment string) ([]*elasticbeanstalk.ConfigurationOptionSetting, error) {
+	out, err := client.DescribeConfigurationSettings(
+		&elasticbeanstalk.DescribeConfigurationSettingsInput{
+			ApplicationName: aws.String(application),
+			EnvironmentName: aws.String(environment),
+		},
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(out.ConfigurationSettings) == 0 {
+		return nil, nil
+	}
+
+	return out.ConfigurationSettings[0].OptionSettings, nil
+}
+
+// settingsDiff lists the desired settings whose value differs from the
+// current one.
+func settingsDiff(current, desired []*elasticbeanstalk.ConfigurationOptionSetting) []settingChange {
+	values := map[string]string{}
+
+	for _, s := range current {
+		values[settingKey(s)] = aws.StringValue(s.Value)
+	}
+
+	var changes []settingChange
+
+	for _, s := range desired {
+		from := values[settingKey(s)]
+		to := aws.StringValue(s.Value)
+
+		if from == to {
+			continue
+		}
+
+		changes = append(changes, settingChange{
+			Namespace:  aws.StringValue(s.Namespace),
+			OptionName: aws.StringValue(s.OptionName),
+			From:       from,
+			To:         to,
+		})
+	}
+
+	return changes
+}
+
+func settingKey(s *elasticbeanstalk.ConfigurationOptionSetting) string {
+	key := aws.StringValue(s.Namespace) + ":" + aws.StringValue(s.OptionName)
+
+	if s.ResourceName != nil {
+		key = aws.StringValue(s.ResourceName) + "." + key
+	}
+
+	return key
+}
+
+func optionSetting(namespace, name, value string) *elasticbeanstalk.ConfigurationOptionSetting {
+	return &elasticbeanstalk.ConfigurationOptionSetting{
+		Namespace:  aws.String(namespace),
+		OptionName: aws.String(name),
+		Value:      aws.String(value),
+	}
+}
+
+const launchConfigurationNamespace = "aws:autoscaling:launchconfiguration"
+
+// LaunchConfiguration holds the launch configuration options that can be
+// changed along with the version.
+type LaunchConfiguration struct {
+	InstanceType       string
+	IamInstanceProfile string
+	RootVolumeType     string
+	RootVolumeSize     int
+	SecurityGroups     []string
+}
+
+func (l LaunchConfiguration) optionSettings() []*elasticbeanstalk.ConfigurationOptionSetting {
+	var settings []*elasticbeanstalk.ConfigurationOptionSetting
+
+	if l.InstanceType != "" {
+		settings = append(settings, optionSetting(launchConfigurationNamespace, "InstanceType", l.InstanceType))
+	}
+
+	if l.IamInstanceProfile != "" {
+		settings = append(settings, optionSetting(launchConfigurationNamespace, "IamInstanceProfile", l.IamInstanceProfile))
+	}
+
+	if l.RootVolumeType != "" {
+		settings = append(settings, optionSetting(launchConfigurationNamespace, "RootVolumeType", l.RootVolumeType))
+	}
+
+	if l.RootVolumeSize > 0 {
+		settings = append(settings, optionSetting(launchConfigurationNamespace, "RootVolumeSize", strconv.Itoa(l.RootVolumeSize)))
+	}
+
+	if len(l.SecurityGroups) > 0 {
+		settings = append(settings, optionSetting(launchConfigurationNamespace, "SecurityGroups", strings.Join(l.SecurityGroups, ",")))
+	}
+
+	return settings
+}
+
+// Observability toggles the X-Ray daemon and CloudWatch log streaming, nil
+// values leave the current setting untouched.
+type Observability struct {
+	XRay             *bool
+	StreamLogs       *bool
+	LogRetentionDays int
+}
+
+func (o Observability) optionSettings() []*elasticbeanstalk.ConfigurationOptionSetting {
+	var settings []*elasticbeanstalk.ConfigurationOptionSetting
+
+	if o.XRay != nil {
+		settings = append(settings, optionSetting("aws:elasticbeanstalk:xray", "XRayEnabled", strconv.FormatBool(*o.XRay)))
+	}
+
+	if o.StreamLogs != nil {
+		settings = append(settings, optionSetting("aws:elasticbeanstalk:cloudwatch:logs", "StreamLogs", strconv.FormatBool(*o.StreamLogs)))
+	}
+
+	if o.LogRetentionDays > 0 {
+		settings = append(settings, optionSetting("aws:elasticbeanstalk:cloudwatch:logs", "RetentionInDays", strconv.Itoa(o.LogRetentionDays)))
+	}
+
+	return settings
+}
+
+const rollingUpdateNamespace = "aws:autoscaling:updatepolicy:rollingupdate"
+
+// RollingUpdate controls how instances are replaced when a configuration
+// change requires it.
+type RollingUpdate struct {
+	Enabled               *bool
+	Type                  string
+	MaxBatchSize          int
+	MinInstancesInService int
+	PauseTime             time.Duration
+}
+
+func (r RollingUpdate) optionSettings() []*elasticbeanstalk.ConfigurationOptionSetting {
+	var settings []*elasticbeanstalk.ConfigurationOptionSetting
+
+	if r.Enabled != nil {
+		settings = append(settings, optionSetting(rollingUpdateNamespace, "RollingUpdateEnabled", strconv.FormatBool(*r.Enabled)))
+	}
+
+	if r.Type != "" {
+		settings = append(settings, optionSetting(rollingUpdateNamespace, "RollingUpdateType", r.Type))
+	}
+
+	if r.MaxBatchSize > 0 {
+		settings = append(settings, optionSetting(rollingUpdateNamespace, "MaxBatchSize", strconv.Itoa(r.MaxBatchSize)))
+	}
+
+	if r.MinInstancesInService > 0 {
+		settings = append(settings, optionSetting(rollingUpdateNamespace, "MinInstancesInService", strconv.Itoa(r.MinInstancesInService)))
+	}
+
+	if r.PauseTime > 0 {
+		settings = append(settings, optionSetting(rollingUpdateNamespace, "PauseTime", isoDuration(r.PauseTime)))
+	}
+
+	return settings
+}
+
+// isoDuration formats a duration the ISO 8601 way Beanstalk expects, such as
+// PT1H30M.
+func isoDuration(d time.Duration) string {
+	d = d.Round(time.Second)
+
+	h := d / time.Hour
+	m := (d % time.Hour) / time.Minute
+	s := (d % time.Minute) / time.Second
+
+	out := "PT"
+
+	if h > 0 {
+		out += fmt.Sprintf("%dH", h)
+	}
+
+	if m > 0 {
+		out += fmt.Sprintf("%dM", m)
+	}
+
+	if s > 0 || out == "PT" {
+		out += fmt.Sprintf("%dS", s)
+	}
+
+	return out
+}
+
+const commandNamespace = "aws:elasticbeanstalk:command"
+
+// deploymentPolicies are the policies Beanstalk deploys application
+// versions with.
+var deploymentPolicies = map[string]bool{
+	"AllAtOnce":                  true,
+	"Rolling":                    true,
+	"RollingWithAdditionalBatch": true,
+	"Immutable":                  true,
+	"TrafficSplitting":           true,
+}
+
+// DeploymentPolicy selects how the version is rolled out to the instances of
+// the environment.
+type DeploymentPolicy struct {
+	Policy        string
+	BatchSize     int
+	BatchSizeType string
+}
+
+// parseDeploymentPolicy validates the policy and the batch size type.
+func parseDeploymentPolicy(policy string, batchSize int, batchSizeType string) (DeploymentPolicy, error) {
+	d := DeploymentPolicy{
+		Policy:        policy,
+		BatchSize:     batchSize,
+		BatchSizeType: batchSizeType,
+	}
+
+	if policy != "" && !deploymentPolicies[policy] {
+		return d, fmt.Errorf("unknown deployment policy %s", policy)
+	}
+
+	if batchSizeType != "" && batchSizeType != "Percentage" && batchSizeType != "Fixed" {
+		return d, fmt.Errorf("unknown batch size type %s", batchSizeType)
+	}
+
+	if batchSizeType == "Percentage" && batchSize > 100 {
+		return d, fmt.Errorf("batch size %d is over 100 percent", batchSize)
+	}
+
+	return d, nil
+}
+
+func (d DeploymentPolicy) optionSettings() []*elasticbeanstalk.ConfigurationOptionSetting {
+	var settings []*elasticbeanstalk.ConfigurationOptionSetting
+
+	if d.Policy != "" {
+		settings = append(settings, optionSetting(commandNamespace, "DeploymentPolicy", d.Policy))
+	}
+
+	if d.BatchSizeType != "" {
+		settings = append(settings, optionSetting(commandNamespace, "BatchSizeType", d.BatchSizeType))
+	}
+
+	if d.BatchSize > 0 {
+		settings = append(settings, optionSetting(commandNamespace, "BatchSize", strconv.Itoa(d.BatchSize)))
+	}
+
+	return settings
+}
+
+const healthReportingNamespace = "aws:elasticbeanstalk:healthreporting:system"
+
+// healthIgnoreRules maps the ignore settings to the rule of the enhanced
+// health config document they disable.
+var healthIgnoreRules = map[string][2]string{
+	"application-4xx":   {"Application", "ApplicationRequests4xx"},
+	"load-balancer-4xx": {"ELB", "ELBRequests4xx"},
+}
+
+// HealthReporting configures enhanced health reporting, so the health the
+// deploy gates on matches how the team judges it.
+type HealthReporting struct {
+	SystemType       string
+	SuccessThreshold string
+
+	// ConfigDocument is the enhanced health config document, Ignore
+	// disables its rules by name.
+	ConfigDocument map[string]interface{}
+	Ignore         []string
+}
+
+// parseHealthReporting parses the config document and validates the ignore
+// rules.
+func parseHealthReporting(systemType, threshold, document string, ignore []string) (HealthReporting, error) {
+	h := HealthReporting{
+		SystemType:       systemType,
+		SuccessThreshold: threshold,
+		Ignore:           ignore,
+	}
+
+	if document != "" {
+		if err := json.Unmarshal([]byte(document), &h.ConfigDocument); err != nil {
+			return h, fmt.Errorf("invalid health config document: %s", err)
+		}
+	}
+
+	for _, name := range ignore {
+		if _, ok := healthIgnoreRules[name]; !ok {
+			return h, fmt.Errorf("unknown health rule %s", name)
+		}
+	}
+
+	return h, nil
+}
+
+// configDocument returns the config document with the ignored rules
+// disabled.
+func (h HealthReporting) configDocument() map[string]interface{} {
+	doc := h.ConfigDocument
+
+	if len(h.Ignore) == 0 {
+		return doc
+	}
+
+	if doc == nil {
+		doc = map[string]interface{}{"Version": 1}
+	}
+
+	for _, name := range h.Ignore {
+		rule := healthIgnoreRules[name]
+		child(child(child(doc, "Rules"), "Environment"), rule[0])[rule[1]] = map[string]interface{}{"Enabled": false}
+	}
+
+	return doc
+}
+
+// child returns the nested object, creating it when missing.
+func child(m map[string]interface{}, key string) map[string]interface{} {
+	if c, ok := m[key].(map[string]interface{}); ok {
+		return c
+	}
+
+	c := map[string]interface{}{}
+	m[key] = c
+
+	return c
+}
+
+func (h HealthReporting) optionSettings() []*elasticbeanstalk.ConfigurationOptionSetting {
+	var settings []*elasticbeanstalk.ConfigurationOptionSetting
+
+	if h.SystemType != "" {
+		settings = append(settings, optionSetting(healthReportingNamespace, "SystemType", h.SystemType))
+	}
+
+	if h.SuccessThreshold != "" {
+		settings = append(settings, optionSetting(healthReportingNamespace, "HealthCheckSuccessThreshold", h.SuccessThreshold))
+	}
+
+	if doc := h.configDocument(); doc != nil {
+		data, _ := json.Marshal(doc)
+		settings = append(settings, optionSetting(healthReportingNamespace, "ConfigDocument", string(data)))
+	}
+
+	return settings
+}
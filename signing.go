@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/elasticbeanstalk"
+	"github.com/aws/aws-sdk-go/service/kms"
+)
+
+// signatureSuffix is appended to the bundle key of its signature.
+const signatureSuffix = ".sig"
+
+var errSignature = errors.New("source bundle signature is missing or invalid")
+
+// Signing signs uploaded bundles with a KMS key and verifies the signature
+// of the deployed version before any environment is updated.
+type Signing struct {
+	KeyID     string
+	Algorithm string
+	Verify    bool
+}
+
+// bundleSignature is stored next to the bundle.
+type bundleSignature struct {
+	KeyID     string `json:"key_id"`
+	Algorithm string `json:"algorithm"`
+	SHA256    string `json:"sha256"`
+	Signature []byte `json:"signature"`
+}
+
+// signatureLocation is the s3:// location of the signature of a bundle.
+func signatureLocation(bundle *elasticbeanstalk.S3Location) string {
+	return "s3://" + aws.StringValue(bundle.S3Bucket) + "/" + aws.StringValue(bundle.S3Key) + signatureSuffix
+}
+
+// sign signs the digest of the uploaded bundle and stores the signature
+// next to it.
+func (p *Plugin) sign(digest string) error {
+	message, err := hex.DecodeString(digest)
+
+	if err != nil {
+		return err
+	}
+
+	out, err := kms.New(p.sess).Sign(&kms.SignInput{
+		KeyId:            aws.String(p.Signing.KeyID),
+		Message:          message,
+		MessageType:      aws.String(kms.MessageTypeDigest),
+		SigningAlgorithm: aws.String(p.Signing.Algorithm),
+	})
+
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(bundleSignature{
+		KeyID:     aws.StringValue(out.KeyId),
+		Algorithm: p.Signing.Algorithm,
+		SHA256:    digest,
+		Signature: out.Signature,
+	}, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	location := signatureLocation(&elasticbeanstalk.S3Location{
+		S3Bucket: aws.String(p.Bucket),
+		S3Key:    aws.String(p.BucketKey),
+	})
+
+	log.WithField("signature", location).Info("Signed source bundle")
+
+	return writeStateData(p.sess, location, data)
+}
+
+// verifySignature checks the signature of the bundle of the version about
+// to be deployed against the digest of the bundle as it is stored now.
+func (p *Plugin) verifySignature(client *elasticbeanstalk.ElasticBeanstalk) error {
+	if p.Signing.KeyID == "" {
+		return fmt.Errorf("a signing key is required to verify the bundle signature")
+	}
+
+	verifyLog := log.WithFields(log.Fields{
+		"application":  p.Application,
+		"versionlabel": p.VersionLabel,
+	})
+
+	version, err := describeApplicationVersion(client, p.Application, p.VersionLabel)
+
+	if err != nil {
+		verifyLog.WithError(err).Error("Problem retrieving application version")
+		return err
+	}
+
+	if version == nil || version.SourceBundle == nil {
+		verifyLog.Error("Version has no source bundle to verify")
+		return errSignature
+	}
+
+	location := signatureLocation(version.SourceBundle)
+	verifyLog = verifyLog.WithField("signature", location)
+
+	data, err := readStateData(p.sess, location)
+
+	if err != nil {
+		verifyLog.WithError(err).Error("Problem reading the bundle signature")
+		return err
+	}
+
+	if data == nil {
+		verifyLog.Error("Source bundle is not signed")
+		return errSignature
+	}
+
+	sig := bundleSignature{}
+
+	if err := json.Unmarshal(data, &sig); err != nil {
+		verifyLog.WithError(err).Error("Problem decoding the bundle signature")
+		return errSignature
+	}
+
+	digest, err := p.objectDigest(version.SourceBundle)
+
+	if err != nil {
+		verifyLog.WithError(err).Error("Problem downloading the source bundle")
+		return err
+	}
+
+	message, _ := hex.DecodeString(digest)
+
+	// the configured key verifies, not the one named by the signature, so
+	// a bundle signed with any other key is refused
+	out, err := kms.New(p.sess).Verify(&kms.VerifyInput{
+		KeyId:            aws.String(p.Signing.KeyID),
+		Message:          message,
+		MessageType:      aws.String(kms.MessageTypeDigest),
+		Signature:        sig.Signature,
+		SigningAlgorithm: aws.String(p.Signing.Algorithm),
+	})
+
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == kms.ErrCodeKMSInvalidSignatureException {
+		err = fmt.Errorf("signature does not match the bundle")
+	}
+
+	if err != nil || !aws.BoolValue(out.SignatureValid) {
+		verifyLog.WithError(err).WithField("sha256", digest).Error("Source bundle signature is invalid")
+		return errSignature
+	}
+
+	verifyLog.WithField("sha256", digest).Info("Source bundle signature verified")
+	return nil
+}
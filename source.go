@@ -0,0 +1,249 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ebIgnoreFile lists paths the EB CLI leaves out of the bundle, using
+// .gitignore syntax.
+const ebIgnoreFile = ".ebignore"
+
+// ignorePattern is a single .gitignore style pattern.
+type ignorePattern struct {
+	glob    string
+	negate  bool
+	dirOnly bool
+	rooted  bool
+}
+
+// parseIgnorePattern parses a pattern line, leading ! negates it, a trailing
+// slash only matches directories and a slash anywhere else anchors it at
+// the root.
+func parseIgnorePattern(line string) ignorePattern {
+	var pattern ignorePattern
+
+	if strings.HasPrefix(line, "!") {
+		pattern.negate = true
+		line = line[1:]
+	}
+
+	if strings.HasSuffix(line, "/") {
+		pattern.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+
+	if strings.Contains(line, "/") {
+		pattern.rooted = true
+		line = strings.TrimPrefix(line, "/")
+	}
+
+	pattern.glob = line
+	return pattern
+}
+
+// matches reports whether the slash separated relative path matches.
+// Unanchored patterns match the name at any depth, ** matches any number
+// of directories.
+func (i ignorePattern) matches(rel string, dir bool) bool {
+	if i.dirOnly && !dir {
+		return false
+	}
+
+	if !i.rooted {
+		ok, _ := path.Match(i.glob, path.Base(rel))
+		return ok
+	}
+
+	return globMatch(strings.Split(i.glob, "/"), strings.Split(rel, "/"))
+}
+
+// globMatch matches path segments, ** consumes zero or more of them.
+func globMatch(glob, segments []string) bool {
+	for len(glob) > 0 {
+		if glob[0] == "**" {
+			for n := 0; n <= len(segments); n++ {
+				if globMatch(glob[1:], segments[n:]) {
+					return true
+				}
+			}
+
+			return false
+		}
+
+		if len(segments) == 0 {
+			return false
+		}
+
+		if ok, _ := path.Match(glob[0], segments[0]); !ok {
+			return false
+		}
+
+		glob, segments = glob[1:], segments[1:]
+	}
+
+	return len(segments) == 0
+}
+
+// SourceFilter selects the files of the source directory packaged into the
+// bundle. Exclude patterns are applied after the .ebignore file, Include
+// restricts the bundle to matching files.
+type SourceFilter struct {
+	Include []string
+	Exclude []string
+}
+
+// sourceRules holds the parsed filter of a source directory.
+type sourceRules struct {
+	ignore  []ignorePattern
+	include []ignorePattern
+}
+
+// rules reads the .ebignore file of the directory and appends the exclude
+// patterns.
+func (f SourceFilter) rules(dir string) (*sourceRules, error) {
+	r := &sourceRules{}
+
+	file, err := os.Open(filepath.Join(dir, ebIgnoreFile))
+
+	switch {
+	case err == nil:
+		defer file.Close()
+
+		scanner := bufio.NewScanner(file)
+
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+
+			r.ignore = append(r.ignore, parseIgnorePattern(line))
+		}
+
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	case !os.IsNotExist(err):
+		return nil, err
+	}
+
+	for _, pattern := range f.Exclude {
+		r.ignore = append(r.ignore, parseIgnorePattern(pattern))
+	}
+
+	for _, pattern := range f.Include {
+		r.include = append(r.include, parseIgnorePattern(pattern))
+	}
+
+	return r, nil
+}
+
+// ignored applies the patterns in order, the last match wins.
+func (r *sourceRules) ignored(rel string, dir bool) bool {
+	ignored := false
+
+	for _, pattern := range r.ignore {
+		if pattern.matches(rel, dir) {
+			ignored = !pattern.negate
+		}
+	}
+
+	return ignored
+}
+
+// included reports whether the file or one of its directories matches an
+// include pattern, everything is included without any.
+func (r *sourceRules) included(rel string) bool {
+	if len(r.include) == 0 {
+		return true
+	}
+
+	for dir := false; rel != "."; rel, dir = path.Dir(rel), true {
+		for _, pattern := range r.include {
+			if pattern.matches(rel, dir) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// addDirectory packages the files below the directory into the bundle,
+// named relative to it, unless the filter leaves them out. Symlinks are
+// kept as links.
+func addDirectory(b *zipBundle, dir string, filter SourceFilter) error {
+	rules, err := filter.rules(dir)
+
+	if err != nil {
+		return err
+	}
+
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, path)
+
+		if err != nil || rel == "." {
+			return err
+		}
+
+		rel = filepath.ToSlash(rel)
+
+		if rules.ignored(rel, info.IsDir()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		if info.IsDir() || !rules.included(rel) {
+			return nil
+		}
+
+		if info.Mode()&os.ModeSymlink != 0 {
+			return b.addSymlink(rel, path, info)
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		return b.addFile(rel, path)
+	})
+}
+
+// addSymlink stores the link target as the content of a symlink entry.
+func (b *zipBundle) addSymlink(name, path string, info os.FileInfo) error {
+	target, err := os.Readlink(path)
+
+	if err != nil {
+		return err
+	}
+
+	fh, err := zip.FileInfoHeader(info)
+
+	if err != nil {
+		return err
+	}
+
+	fh.Name = filepath.ToSlash(name)
+
+	w, err := b.zw.CreateHeader(fh)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write([]byte(target))
+	return err
+}
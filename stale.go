@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elasticbeanstalk"
+)
+
+var errStaleBuild = errors.New("version is older than the one deployed")
+
+// defaultBuildPattern extracts the build number from generated version
+// labels, such as 42-1a2b3c4d, and from labels ending in it, such as
+// app-42-1a2b3c4d or app-42. Matching starts at the leftmost number, so a
+// short sha made of digits only is never taken for the build number.
+const defaultBuildPattern = `(?:^|-)(\d+)(?:-[0-9a-f]{8})?$`
+
+// buildNumber extracts the build number of a version label with the first
+// capture group of the pattern.
+func buildNumber(pattern *regexp.Regexp, label string) (int, bool) {
+	m := pattern.FindStringSubmatch(label)
+
+	if len(m) < 2 {
+		return 0, false
+	}
+
+	n, err := strconv.Atoi(m[1])
+
+	return n, err == nil
+}
+
+// checkStale refuses to deploy a build older than the one running in the
+// environment, protecting against old pipelines being re-run.
+func (p *Plugin) checkStale(envLog *log.Entry, current *elasticbeanstalk.EnvironmentDescription) error {
+	if p.BuildPattern == nil || p.Force {
+		return nil
+	}
+
+	live := aws.StringValue(current.VersionLabel)
+	fields := envLog.WithFields(log.Fields{
+		"versionlabel": p.VersionLabel,
+		"deployed":     live,
+	})
+
+	next, ok := buildNumber(p.BuildPattern, p.VersionLabel)
+
+	if !ok {
+		fields.Warning("No build number in the version label, skipping the stale build check")
+		return nil
+	}
+
+	deployed, ok := buildNumber(p.BuildPattern, live)
+
+	if !ok {
+		return nil
+	}
+
+	if next < deployed {
+		fields.WithError(errStaleBuild).Error("Refusing to deploy an older build, use force to override")
+		return errStaleBuild
+	}
+
+	return nil
+}
+
+// upToDate returns skipped results when every environment is ready and
+// already runs the version label, so a retried or promoted build neither
+// registers the version again nor updates anything. It returns nil when
+// there is something to deploy, or when forced.
+func (p *Plugin) upToDate(client *elasticbeanstalk.ElasticBeanstalk) []*envResult {
+	if !p.EnvironmentUpdate || p.Force {
+		return nil
+	}
+
+	var results []*envResult
+
+	for _, environment := range p.environments() {
+		env, err := findEnvironment(client, p.Application, environment)
+
+		if err != nil || env == nil {
+			return nil
+		}
+
+		if aws.StringValue(env.VersionLabel) != p.VersionLabel || aws.StringValue(env.Status) != elasticbeanstalk.EnvironmentStatusReady {
+			return nil
+		}
+
+		results = append(results, newEnvResult(p.Application, environment, p.VersionLabel).skip())
+	}
+
+	log.WithFields(log.Fields{
+		"application":  p.Application,
+		"environment":  p.environments(),
+		"versionlabel": p.VersionLabel,
+	}).Info("Environments already run the version, nothing to deploy, use force to deploy anyway")
+
+	return results
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestBuildNumberOfGeneratedLabels(t *testing.T) {
+	pattern := regexp.MustCompile(defaultBuildPattern)
+
+	for _, sha := range []string{"1a2b3c4d5e6f", "12345678abcd"} {
+		p := &Plugin{
+			Build:  Build{Number: 42},
+			Commit: Commit{SHA: sha},
+		}
+
+		if err := p.buildLabels(); err != nil {
+			t.Fatal(err)
+		}
+
+		if n, ok := buildNumber(pattern, p.VersionLabel); !ok || n != 42 {
+			t.Errorf("%s: got build %d, %v", p.VersionLabel, n, ok)
+		}
+	}
+
+	for label, want := range map[string]int{
+		"42":              42,
+		"app-42":          42,
+		"app-42-1a2b3c4d": 42,
+		"app-42-12345678": 42,
+	} {
+		if n, ok := buildNumber(pattern, label); !ok || n != want {
+			t.Errorf("%s: got build %d, %v", label, n, ok)
+		}
+	}
+
+	if _, ok := buildNumber(pattern, "release"); ok {
+		t.Error("a label without a number has a build number")
+	}
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/elasticbeanstalk"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+const (
+	actionDeploy = "deploy"
+	actionResume = "resume"
+)
+
+// rolloutState is the progress of a rollout, kept up to date while it runs
+// so a rollout interrupted by a crash or paused at a failing stage can be
+// resumed instead of restarted.
+type rolloutState struct {
+	Application  string    `json:"application"`
+	VersionLabel string    `json:"version_label"`
+	Completed    []string  `json:"completed"`
+	InFlight     []string  `json:"in_flight"`
+	Stages       []Stage   `json:"stages"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// stateLocation splits an s3://bucket/key location, the bucket is empty for
+// local files.
+func stateLocation(location string) (string, string) {
+	if !strings.HasPrefix(location, "s3://") {
+		return "", location
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(location, "s3://"), "/", 2)
+
+	if len(parts) == 1 {
+		return parts[0], ""
+	}
+
+	return parts[0], parts[1]
+}
+
+// readStateData returns the stored state, nil when there is none.
+func readStateData(sess *session.Session, location string) ([]byte, error) {
+	bucket, key := stateLocation(location)
+
+	if bucket == "" {
+		data, err := ioutil.ReadFile(key)
+
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return data, err
+	}
+
+	out, err := s3.New(sess).GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+
+	if aerr, ok := err.(awserr.RequestFailure); ok && aerr.StatusCode() == 404 {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer out.Body.Close()
+
+	return ioutil.ReadAll(out.Body)
+}
+
+// writeStateData stores the state.
+func writeStateData(sess *session.Session, location string, data []byte) error {
+	bucket, key := stateLocation(location)
+
+	if bucket == "" {
+		return ioutil.WriteFile(key, data, 0644)
+	}
+
+	_, err := s3.New(sess).PutObject(&s3.PutObjectInput{
+		Bucket:      aws.String(bucket),
+		Key:         aws.String(key),
+		Body:        strings.NewReader(string(data)),
+		ContentType: aws.String("application/json"),
+	})
+
+	return err
+}
+
+// removeStateData deletes the state once the rollout completed.
+func removeStateData(sess *session.Session, location string) error {
+	bucket, key := stateLocation(location)
+
+	if bucket == "" {
+		if err := os.Remove(key); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		return nil
+	}
+
+	_, err := s3.New(sess).DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+
+	return err
+}
+
+// readState loads the stored state, nil when there is none.
+func (p *Plugin) readState() (*rolloutState, error) {
+	data, err := readStateData(p.sess, p.StateFile)
+
+	if err != nil || data == nil {
+		return nil, err
+	}
+
+	state := &rolloutState{}
+
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, err
+	}
+
+	for i := range state.Stages {
+		if state.Stages[i].Bake != "" {
+			if state.Stages[i].bake, err = time.ParseDuration(state.Stages[i].Bake); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return state, nil
+}
+
+// rolloutProgress tracks the environments of a running rollout and stores
+// the state after every change.
+type rolloutProgress struct {
+	mu    sync.Mutex
+	p     *Plugin
+	state rolloutState
+}
+
+// newProgress starts tracking the rollout of the stages. A state stored for
+// the same version by an earlier run is picked up, the environments it
+// completed are left out of the stages and returned.
+func (p *Plugin) newProgress(stages []Stage) (*rolloutProgress, []Stage, []string) {
+	progress := &rolloutProgress{
+		p: p,
+		state: rolloutState{
+			Application:  p.Application,
+			VersionLabel: p.VersionLabel,
+			Stages:       append([]Stage(nil), stages...),
+		},
+	}
+
+	previous, err := p.readState()
+
+	if err != nil {
+		log.WithError(err).Warning("Problem reading the rollout state, starting over")
+	}
+
+	if previous == nil || previous.Application != p.Application || previous.VersionLabel != p.VersionLabel {
+		progress.save()
+		return progress, stages, nil
+	}
+
+	completed := map[string]bool{}
+
+	for _, environment := range previous.Completed {
+		completed[environment] = true
+	}
+
+	var left []Stage
+
+	for _, stage := range stages {
+		pending := stage
+		pending.Environments = nil
+
+		for _, environment := range stage.Environments {
+			if !completed[environment] {
+				pending.Environments = append(pending.Environments, environment)
+			}
+		}
+
+		if len(pending.Environments) > 0 {
+			left = append(left, pending)
+		}
+	}
+
+	log.WithFields(log.Fields{
+		"versionlabel": p.VersionLabel,
+		"completed":    len(previous.Completed),
+	}).Info("Resuming rollout from the stored state")
+
+	progress.state.Completed = previous.Completed
+	progress.state.Stages = append([]Stage(nil), left...)
+	progress.save()
+
+	return progress, left, previous.Completed
+}
+
+// start records an environment being updated.
+func (r *rolloutProgress) start(environment string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.state.InFlight = append(r.state.InFlight, environment)
+	r.save()
+}
+
+// done records the outcome of an environment, successful ones leave the
+// stages for good.
+func (r *rolloutProgress) done(environment string, ok bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.state.InFlight = without(r.state.InFlight, environment)
+
+	if ok {
+		r.state.Completed = append(r.state.Completed, environment)
+
+		for i := range r.state.Stages {
+			r.state.Stages[i].Environments = without(r.state.Stages[i].Environments, environment)
+		}
+	}
+
+	r.save()
+}
+
+// save stores the state, problems are only logged.
+func (r *rolloutProgress) save() {
+	r.state.UpdatedAt = time.Now().UTC()
+
+	data, err := json.MarshalIndent(r.state, "", "  ")
+
+	if err == nil {
+		err = writeStateData(r.p.sess, r.p.StateFile, data)
+	}
+
+	if err != nil {
+		log.WithError(err).Error("Problem writing the rollout state")
+	}
+}
+
+// finish removes the state of a completed rollout.
+func (r *rolloutProgress) finish() {
+	if err := removeStateData(r.p.sess, r.p.StateFile); err != nil {
+		log.WithError(err).Warning("Problem removing the rollout state")
+	}
+}
+
+func without(list []string, item string) []string {
+	out := make([]string, 0, len(list))
+
+	for _, v := range list {
+		if v != item {
+			out = append(out, v)
+		}
+	}
+
+	return out
+}
+
+// resume continues a paused or interrupted rollout with the version and
+// stages stored in the state.
+func (p *Plugin) resume(client *elasticbeanstalk.ElasticBeanstalk) error {
+	state, err := p.readState()
+
+	if err == nil && state == nil {
+		err = os.ErrNotExist
+	}
+
+	if err != nil {
+		log.WithError(err).WithField("state-file", p.StateFile).Error("Problem reading the rollout state")
+		return err
+	}
+
+	p.Application = state.Application
+	p.VersionLabel = state.VersionLabel
+	p.Rollout = state.Stages
+
+	results := p.rollOut(client)
+
+	printReport(p.ReportFormat, results)
+
+	return resultsError(results)
+}
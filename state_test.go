@@ -0,0 +1,62 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResumeAfterPause(t *testing.T) {
+	f := newFakeAWS(t, "app-one", "app-two")
+	f.failing["app-two"] = true
+
+	stateFile := filepath.Join(t.TempDir(), "rollout.json")
+
+	p := f.plugin()
+	p.StateFile = stateFile
+	p.Rollout = []Stage{
+		{Name: "canary", Environments: []string{"app-one"}},
+		{Name: "rest", Environments: []string{"app-two"}},
+	}
+
+	if err := p.Exec(); err == nil {
+		t.Fatal("rollout succeeded with a failing environment")
+	}
+
+	saved, err := (&Plugin{StateFile: stateFile}).readState()
+
+	if err != nil || saved == nil {
+		t.Fatalf("no state saved: %v", err)
+	}
+
+	if len(saved.Completed) != 1 || saved.Completed[0] != "app-one" || saved.VersionLabel != "v2" {
+		t.Fatalf("saved state %+v", saved)
+	}
+
+	f.mu.Lock()
+	f.failing = map[string]bool{}
+	f.events = nil
+	f.mu.Unlock()
+
+	// resuming takes the version and stages from the state alone
+	q := f.plugin()
+	q.Action = actionResume
+	q.VersionLabel = ""
+	q.StateFile = stateFile
+
+	if err := q.Exec(); err != nil {
+		t.Fatal(err)
+	}
+
+	if f.count("UpdateEnvironment") != 3 {
+		t.Errorf("%d updates, want app-one once and app-two twice", f.count("UpdateEnvironment"))
+	}
+
+	if version := f.environment("app-two").version; version != "v2" {
+		t.Errorf("app-two runs %s, want v2", version)
+	}
+
+	if _, err := os.Stat(stateFile); !os.IsNotExist(err) {
+		t.Error("state of the completed rollout was not removed")
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/aws/aws-sdk-go/service/elasticbeanstalk"
+)
+
+var (
+	errAborted     = errors.New("update was aborted and the environment rolled back")
+	errTerminating = errors.New("environment is being terminated")
+)
+
+// inProgress tells whether the environment is busy with an operation that
+// ends with it being ready again, so waiting is the right thing to do.
+func inProgress(status string) bool {
+	switch status {
+	case elasticbeanstalk.EnvironmentStatusLaunching,
+		elasticbeanstalk.EnvironmentStatusUpdating,
+		elasticbeanstalk.EnvironmentStatusLinkingFrom,
+		elasticbeanstalk.EnvironmentStatusLinkingTo,
+		elasticbeanstalk.EnvironmentStatusAborting:
+		return true
+	}
+
+	return false
+}
+
+// terminating tells whether the environment is going away for good.
+func terminating(status string) bool {
+	return status == elasticbeanstalk.EnvironmentStatusTerminating ||
+		status == elasticbeanstalk.EnvironmentStatusTerminated
+}
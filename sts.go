@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+// stsExpiryWindow refreshes assumed credentials this long before they
+// expire, so long deploys never sign a request with expired credentials.
+const stsExpiryWindow = time.Minute
+
+// AssumeRole names the role deploys run as, such as a deploy role in the
+// account of the application.
+type AssumeRole struct {
+	RoleARN     string
+	ExternalID  string
+	SessionName string
+}
+
+// credentials returns credentials of the role, assumed with the
+// credentials of the base session and refreshed before they expire.
+func (r AssumeRole) credentials(base client.ConfigProvider) *credentials.Credentials {
+	return stscreds.NewCredentials(base, r.RoleARN, func(p *stscreds.AssumeRoleProvider) {
+		p.RoleSessionName = r.SessionName
+		p.ExpiryWindow = stsExpiryWindow
+
+		if r.ExternalID != "" {
+			p.ExternalID = aws.String(r.ExternalID)
+		}
+	})
+}
+
+// WebIdentity exchanges the OIDC token of the runner, such as a Kubernetes
+// service account token, for credentials of a role.
+type WebIdentity struct {
+	RoleARN     string
+	TokenFile   string
+	SessionName string
+}
+
+// enabled reports whether a role and token file are configured.
+func (w WebIdentity) enabled() bool {
+	return w.RoleARN != "" && w.TokenFile != ""
+}
+
+// credentials returns credentials of the role that refresh automatically,
+// the base session signs nothing as the token is the proof of identity.
+func (w WebIdentity) credentials(base client.ConfigProvider) *credentials.Credentials {
+	return credentials.NewCredentials(stscreds.NewWebIdentityRoleProviderWithOptions(
+		sts.New(base),
+		w.RoleARN,
+		w.SessionName,
+		tokenFile(w.TokenFile),
+		func(p *stscreds.WebIdentityRoleProvider) {
+			p.ExpiryWindow = stsExpiryWindow
+		},
+	))
+}
+
+// tokenFile reads the web identity token again on every refresh as the
+// runner rotates it, trimming the newline editors leave behind.
+type tokenFile string
+
+// FetchToken reads the token.
+func (f tokenFile) FetchToken(credentials.Context) ([]byte, error) {
+	token, err := ioutil.ReadFile(string(f))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return bytes.TrimSpace(token), nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// envSummary is the outcome of a single environment in the summary.
+type envSummary struct {
+	Environment     string  `json:"environment"`
+	EnvironmentID   string  `json:"environment_id,omitempty"`
+	CNAME           string  `json:"cname,omitempty"`
+	URL             string  `json:"url,omitempty"`
+	EndpointURL     string  `json:"endpoint_url,omitempty"`
+	Outcome         string  `json:"outcome"`
+	Version         string  `json:"version"`
+	PreviousVersion string  `json:"previous_version,omitempty"`
+	Seconds         float64 `json:"seconds"`
+	Health          string  `json:"health,omitempty"`
+	Events          int     `json:"events"`
+}
+
+// deploySummary sums up the deploy for the steps following it, such as
+// notifications and smoke tests.
+type deploySummary struct {
+	Application  string       `json:"application"`
+	Version      string       `json:"version"`
+	Success      bool         `json:"success"`
+	Seconds      float64      `json:"seconds"`
+	Environments []envSummary `json:"environments"`
+}
+
+func (p *Plugin) newSummary(started time.Time, err error) deploySummary {
+	summary := deploySummary{
+		Application:  p.Application,
+		Version:      p.VersionLabel,
+		Success:      err == nil,
+		Seconds:      time.Since(started).Seconds(),
+		Environments: []envSummary{},
+	}
+
+	for _, r := range attempted(p.results) {
+		env := envSummary{
+			Environment:     r.Environment,
+			EnvironmentID:   r.EnvironmentID,
+			CNAME:           r.CNAME,
+			URL:             r.url(),
+			EndpointURL:     r.EndpointURL,
+			Outcome:         r.Outcome,
+			Version:         r.Version,
+			PreviousVersion: r.PreviousVersion,
+			Seconds:         r.Finished.Sub(r.Started).Seconds(),
+			Health:          r.Health,
+			Events:          r.Events,
+		}
+
+		summary.Environments = append(summary.Environments, env)
+	}
+
+	return summary
+}
+
+// writeSummary writes the summary to the summary file and, on Drone, to
+// the step outputs as key=value lines.
+func (p *Plugin) writeSummary(started time.Time, err error) {
+	output := os.Getenv("DRONE_OUTPUT")
+
+	if p.SummaryFile == "" && output == "" {
+		return
+	}
+
+	summary := p.newSummary(started, err)
+
+	if p.SummaryFile != "" {
+		data, merr := json.MarshalIndent(summary, "", "  ")
+
+		if merr == nil {
+			merr = ioutil.WriteFile(p.SummaryFile, append(data, '\n'), 0644)
+		}
+
+		if merr != nil {
+			log.WithError(merr).WithField("file", p.SummaryFile).Error("Problem writing the deploy summary")
+		}
+	}
+
+	if output != "" {
+		if merr := appendOutputs(output, summary); merr != nil {
+			log.WithError(merr).WithField("file", output).Error("Problem writing the step outputs")
+		}
+	}
+}
+
+// appendOutputs adds the summary to the Drone step outputs, the endpoint
+// of the first environment is also set on its own.
+func appendOutputs(path string, summary deploySummary) error {
+	data, err := json.Marshal(summary)
+
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(f, "deploy_summary=%s\n", data)
+	fmt.Fprintf(f, "deploy_version=%s\n", summary.Version)
+
+	if len(summary.Environments) > 0 {
+		env := summary.Environments[0]
+
+		fmt.Fprintf(f, "deploy_url=%s\n", env.URL)
+		fmt.Fprintf(f, "deploy_cname=%s\n", env.CNAME)
+		fmt.Fprintf(f, "deploy_endpoint_url=%s\n", env.EndpointURL)
+		fmt.Fprintf(f, "deploy_environment_id=%s\n", env.EnvironmentID)
+	}
+
+	return f.Close()
+}
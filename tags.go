@@ -0,0 +1,189 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elasticbeanstalk"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+// callerIdentity caches the account and ARN of the credentials, it is
+// shared by every deployment using the same session.
+type callerIdentity struct {
+	once    sync.Once
+	account string
+	arn     string
+	err     error
+}
+
+// account returns the AWS account id of the credentials in use.
+func (p *Plugin) account() (string, error) {
+	id := p.lookupIdentity()
+	return id.account, id.err
+}
+
+// callerARN returns the ARN of the credentials in use.
+func (p *Plugin) callerARN() (string, error) {
+	id := p.lookupIdentity()
+	return id.arn, id.err
+}
+
+// lookupIdentity calls GetCallerIdentity the first time it is needed.
+func (p *Plugin) lookupIdentity() *callerIdentity {
+	id := p.identity
+
+	id.once.Do(func() {
+		out, err := sts.New(p.sess).GetCallerIdentity(&sts.GetCallerIdentityInput{})
+		id.err = err
+
+		id.account = aws.StringValue(out.Account)
+		id.arn = aws.StringValue(out.Arn)
+	})
+
+	return id
+}
+
+// buildTagPrefix prefixes the tags naming the build that deployed.
+const buildTagPrefix = "drone:"
+
+// buildTags names the repository, commit and build being deployed.
+func (p *Plugin) buildTags() map[string]string {
+	tags := map[string]string{}
+
+	for name, value := range map[string]string{
+		"repo":   p.Repo.FullName,
+		"commit": p.Commit.SHA,
+		"branch": p.Commit.Branch,
+		"build":  strconv.Itoa(p.Build.Number),
+	} {
+		if value != "" && value != "0" {
+			tags[buildTagPrefix+name] = value
+		}
+	}
+
+	return tags
+}
+
+// resourceTags turns tags into Beanstalk tags sorted by key.
+func resourceTags(tags ...map[string]string) []*elasticbeanstalk.Tag {
+	merged := map[string]string{}
+
+	for _, m := range tags {
+		for key, value := range m {
+			merged[key] = value
+		}
+	}
+
+	keys := make([]string, 0, len(merged))
+
+	for key := range merged {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	var out []*elasticbeanstalk.Tag
+
+	for _, key := range keys {
+		out = append(out, &elasticbeanstalk.Tag{
+			Key:   aws.String(key),
+			Value: aws.String(merged[key]),
+		})
+	}
+
+	return out
+}
+
+// deployTags are the tags of new versions and environments, the configured
+// tags win over the ones naming the build.
+func (p *Plugin) deployTags() []*elasticbeanstalk.Tag {
+	return resourceTags(p.buildTags(), p.Tags)
+}
+
+// tagEnvironment adds the configured tags the environment lacks. The tags
+// naming the build are left out, as tagging an environment updates it and
+// they would change on every deploy.
+func (p *Plugin) tagEnvironment(client *elasticbeanstalk.ElasticBeanstalk, envLog *log.Entry, environment string) {
+	current, err := p.environmentTags(client, environment)
+
+	if err != nil {
+		envLog.WithError(err).Warning("Problem retrieving environment tags")
+		return
+	}
+
+	missing := map[string]string{}
+
+	for key, value := range p.Tags {
+		if current[key] != value {
+			missing[key] = value
+		}
+	}
+
+	if len(missing) == 0 {
+		return
+	}
+
+	account, err := p.account()
+
+	if err != nil {
+		envLog.WithError(err).Warning("Problem tagging environment")
+		return
+	}
+
+	envLog.WithField("tags", len(missing)).Info("Tagging environment")
+
+	_, err = client.UpdateTagsForResource(&elasticbeanstalk.UpdateTagsForResourceInput{
+		ResourceArn: aws.String(environmentARN(p.Region, account, p.Application, environment)),
+		TagsToAdd:   resourceTags(missing),
+	})
+
+	if err != nil {
+		envLog.WithError(err).Warning("Problem tagging environment")
+	}
+}
+
+// environmentTags returns the tags of the environment.
+func (p *Plugin) environmentTags(client *elasticbeanstalk.ElasticBeanstalk, environment string) (map[string]string, error) {
+	account, err := p.account()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return listTags(client, environmentARN(p.Region, account, p.Application, environment))
+}
+
+// versionTags returns the tags of the application version.
+func (p *Plugin) versionTags(client *elasticbeanstalk.ElasticBeanstalk, label string) (map[string]string, error) {
+	account, err := p.account()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return listTags(client, applicationVersionARN(p.Region, account, p.Application, label))
+}
+
+// listTags returns the tags of the resource.
+func listTags(client *elasticbeanstalk.ElasticBeanstalk, arn string) (map[string]string, error) {
+	out, err := client.ListTagsForResource(&elasticbeanstalk.ListTagsForResourceInput{
+		ResourceArn: aws.String(arn),
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	tags := map[string]string{}
+
+	for _, tag := range out.ResourceTags {
+		tags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+	}
+
+	return tags, nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elasticbeanstalk"
+)
+
+// ConfigTemplate names the saved configuration environments are created and
+// updated with. With a file, the template is created or updated with its
+// option settings before the deploy, reconciling the environments against
+// the configuration kept in the repository.
+type ConfigTemplate struct {
+	Name string
+	File string
+}
+
+// templateName is the template passed to the environment calls, if any.
+func (t ConfigTemplate) templateName() *string {
+	if t.Name == "" {
+		return nil
+	}
+
+	return aws.String(t.Name)
+}
+
+// templateExists reports whether the application has a saved configuration
+// with the name.
+func templateExists(client *elasticbeanstalk.ElasticBeanstalk, application, name string) (bool, error) {
+	out, err := client.DescribeApplications(&elasticbeanstalk.DescribeApplicationsInput{
+		ApplicationNames: aws.StringSlice([]string{application}),
+	})
+
+	if err != nil {
+		return false, err
+	}
+
+	for _, app := range out.Applications {
+		for _, template := range app.ConfigurationTemplates {
+			if aws.StringValue(template) == name {
+				return true, nil
+			}
+		}
+	}
+
+	return false, nil
+}
+
+// saveTemplate creates the configuration template from the file, or updates
+// the option settings of the existing one.
+func (p *Plugin) saveTemplate(client *elasticbeanstalk.ElasticBeanstalk) error {
+	templateLog := log.WithFields(log.Fields{
+		"application": p.Application,
+		"template":    p.Template.Name,
+		"file":        p.Template.File,
+	})
+
+	if p.Template.Name == "" {
+		return fmt.Errorf("a template name is required to save the template file")
+	}
+
+	settings, err := readOptionSettingsFile(p.Template.File)
+
+	if err != nil {
+		templateLog.WithError(err).Error("Problem reading the template file")
+		return err
+	}
+
+	exists, err := templateExists(client, p.Application, p.Template.Name)
+
+	if err != nil {
+		templateLog.WithError(err).Error("Problem retrieving the configuration templates")
+		return err
+	}
+
+	if exists {
+		templateLog.Info("Updating configuration template")
+
+		_, err = client.UpdateConfigurationTemplate(&elasticbeanstalk.UpdateConfigurationTemplateInput{
+			ApplicationName: aws.String(p.Application),
+			TemplateName:    aws.String(p.Template.Name),
+			OptionSettings:  settings,
+		})
+	} else {
+		if p.Creation.SolutionStack == "" {
+			return fmt.Errorf("a solution stack is required to create the configuration template")
+		}
+
+		templateLog.WithField("solution-stack", p.Creation.SolutionStack).Info("Creating configuration template")
+
+		_, err = client.CreateConfigurationTemplate(&elasticbeanstalk.CreateConfigurationTemplateInput{
+			ApplicationName:   aws.String(p.Application),
+			TemplateName:      aws.String(p.Template.Name),
+			SolutionStackName: aws.String(p.Creation.SolutionStack),
+			OptionSettings:    settings,
+			Description:       aws.String("Saved by the deploy of " + p.VersionLabel),
+		})
+	}
+
+	if err != nil {
+		templateLog.WithError(err).Error("Problem saving the configuration template")
+	}
+
+	return err
+}
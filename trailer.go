@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// trailer is the single line summing up the run, printed last so scripts
+// scraping the build log find it at a known place.
+type trailer struct {
+	Outcome      string  `json:"outcome"`
+	Action       string  `json:"action"`
+	Application  string  `json:"application"`
+	Version      string  `json:"version"`
+	Environments string  `json:"environments"`
+	Duration     float64 `json:"duration_seconds"`
+	Error        string  `json:"error,omitempty"`
+	FailureClass string  `json:"failure_class,omitempty"`
+}
+
+// newTrailer sums up the run of the plugin.
+func (p *Plugin) newTrailer(started time.Time, err error) trailer {
+	t := trailer{
+		Outcome:      outcomeSuccess,
+		Action:       p.Action,
+		Application:  p.Application,
+		Version:      p.VersionLabel,
+		Environments: strings.Join(p.environments(), ","),
+		Duration:     time.Since(started).Round(time.Second).Seconds(),
+	}
+
+	if err != nil {
+		t.Outcome = outcomeFailed
+		t.Error = err.Error()
+		t.FailureClass = string(classifyError(err))
+	}
+
+	return t
+}
+
+// writeTrailer writes the trailer as JSON or as logfmt key=value pairs.
+func writeTrailer(w io.Writer, format string, t trailer) error {
+	switch format {
+	case "json":
+		return json.NewEncoder(w).Encode(t)
+	case "text":
+	default:
+		return fmt.Errorf("unknown trailer format %s", format)
+	}
+
+	pairs := []string{
+		"outcome=" + t.Outcome,
+		"action=" + logfmtValue(t.Action),
+		"application=" + logfmtValue(t.Application),
+		"version=" + logfmtValue(t.Version),
+		"environments=" + logfmtValue(t.Environments),
+		"duration_seconds=" + strconv.FormatFloat(t.Duration, 'f', -1, 64),
+	}
+
+	if t.Error != "" {
+		pairs = append(pairs, "error="+logfmtValue(t.Error), "failure_class="+t.FailureClass)
+	}
+
+	_, err := fmt.Fprintln(w, strings.Join(pairs, " "))
+	return err
+}
+
+// logfmtValue quotes values that would otherwise break the line apart.
+func logfmtValue(v string) string {
+	if v == "" || strings.ContainsAny(v, " =\"\n") {
+		return strconv.Quote(v)
+	}
+
+	return v
+}
+
+// printTrailer prints the trailer when a format is configured.
+func (p *Plugin) printTrailer(started time.Time, err error) {
+	if p.Trailer == "" {
+		return
+	}
+
+	if werr := writeTrailer(os.Stdout, p.Trailer, p.newTrailer(started, err)); werr != nil {
+		fmt.Fprintln(os.Stderr, werr)
+	}
+}
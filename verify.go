@@ -0,0 +1,131 @@
+package main
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elasticbeanstalk"
+)
+
+// verifyEnvironment runs the post-deploy steps against an environment that
+// finished updating to the version label.
+func (p *Plugin) verifyEnvironment(client *elasticbeanstalk.ElasticBeanstalk, envLog *log.Entry, environment string, result *envResult) error {
+	if p.awaitsHealth() {
+		result.begin("health")
+
+		if err := p.awaitHealth(client, envLog, environment); err != nil {
+			return err
+		}
+	}
+
+	if err := p.verifyEndpoints(client, envLog, environment, result); err != nil {
+		return err
+	}
+
+	return p.verifyTraffic(client, envLog, environment, result)
+}
+
+// verifyTraffic checks DNS, alarms and metrics of the environment once it
+// serves the traffic.
+func (p *Plugin) verifyTraffic(client *elasticbeanstalk.ElasticBeanstalk, envLog *log.Entry, environment string, result *envResult) error {
+	if err := p.verifyDNS(client, envLog, environment, result); err != nil {
+		return err
+	}
+
+	if len(p.Alarms.Names) > 0 {
+		result.begin("alarms")
+
+		if err := p.Alarms.watch(p.sess, envLog); err != nil {
+			return err
+		}
+	}
+
+	if p.Metrics.Window > 0 {
+		result.begin("metrics")
+
+		if err := p.Metrics.watch(client, envLog, environment, result.Baseline); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// verifyEndpoints warms up and checks the endpoints of the environment,
+// which blue/green deploys do before it receives the traffic.
+func (p *Plugin) verifyEndpoints(client *elasticbeanstalk.ElasticBeanstalk, envLog *log.Entry, environment string, result *envResult) error {
+	if p.WarmUp.Requests == 0 && len(p.Checks) == 0 && !p.SmokeTest.Enabled && p.VersionCheck.Path == "" {
+		return nil
+	}
+
+	env, err := findEnvironment(client, p.Application, environment)
+
+	if err != nil {
+		envLog.WithError(err).Error("Problem retrieving environment information")
+		return err
+	}
+
+	if env == nil || aws.StringValue(env.CNAME) == "" {
+		envLog.Warning("Environment has no CNAME, skipping the verification")
+		return nil
+	}
+
+	if p.WarmUp.Requests > 0 {
+		result.begin("warmup")
+		p.WarmUp.run(envLog, "http://"+aws.StringValue(env.CNAME))
+	}
+
+	if len(p.Checks) > 0 {
+		result.begin("checks")
+
+		if err := runChecks(envLog, p.Checks, "http://"+aws.StringValue(env.CNAME), p.VersionLabel, p.CheckTimeout); err != nil {
+			return err
+		}
+	}
+
+	if p.SmokeTest.Enabled {
+		result.begin("smoke")
+
+		if err := p.SmokeTest.run(envLog, "http://"+aws.StringValue(env.CNAME), p.VersionLabel); err != nil {
+			return err
+		}
+	}
+
+	if p.VersionCheck.Path != "" {
+		result.begin("consistency")
+
+		if err := p.VersionCheck.wait(envLog, "http://"+aws.StringValue(env.CNAME), p.VersionLabel); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// verifyDNS waits for the DNS name to resolve to the environment.
+func (p *Plugin) verifyDNS(client *elasticbeanstalk.ElasticBeanstalk, envLog *log.Entry, environment string, result *envResult) error {
+	if !p.DNSCheck.Enabled {
+		return nil
+	}
+
+	env, err := findEnvironment(client, p.Application, environment)
+
+	if err != nil {
+		envLog.WithError(err).Error("Problem retrieving environment information")
+		return err
+	}
+
+	if env == nil || aws.StringValue(env.CNAME) == "" {
+		envLog.Warning("Environment has no CNAME, skipping the DNS check")
+		return nil
+	}
+
+	name := p.DNSCheck.Name
+
+	if name == "" {
+		name = aws.StringValue(env.CNAME)
+	}
+
+	result.begin("dns")
+
+	return p.DNSCheck.wait(envLog, name, aws.StringValue(env.EndpointURL))
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/elasticbeanstalk"
+)
+
+// maxVersionSuffix bounds the number of labels tried with AutoSuffix.
+const maxVersionSuffix = 20
+
+// What to do when the version label already exists, unless AutoSuffix
+// picks another label.
+const (
+	existingReuse    = "reuse"
+	existingFail     = "fail"
+	existingRecreate = "recreate"
+)
+
+var (
+	errVersionExists     = errors.New("application version already exists")
+	errVersionProcessing = errors.New("application version failed processing")
+)
+
+// createApplicationVersion registers the source bundle as a new application
+// version. With AutoSuffix a conflicting label gets an incremented suffix and
+// the final label is stored back into VersionLabel for the update.
+func (p *Plugin) createApplicationVersion(client *elasticbeanstalk.ElasticBeanstalk) error {
+	label := p.VersionLabel
+	started := time.Now()
+
+	if !p.AutoSuffix {
+		existing, err := describeApplicationVersion(client, p.Application, label)
+
+		if err != nil {
+			return err
+		}
+
+		if existing != nil {
+			if done, err := p.handleExistingVersion(client, existing); done || err != nil {
+				return err
+			}
+		}
+	}
+
+	for attempt := 1; ; attempt++ {
+		_, err := client.CreateApplicationVersion(&elasticbeanstalk.CreateApplicationVersionInput{
+			VersionLabel:          aws.String(label),
+			ApplicationName:       aws.String(p.Application),
+			Description:           aws.String(p.Description),
+			AutoCreateApplication: aws.Bool(p.AutoCreate),
+			Process:               aws.Bool(p.Process),
+			SourceBundle: &elasticbeanstalk.S3Location{
+				S3Bucket: aws.String(p.Bucket),
+				S3Key:    aws.String(p.BucketKey),
+			},
+			Tags: p.deployTags(),
+		})
+
+		if err == nil {
+			p.useVersionLabel(label)
+			p.versionCreated = started
+
+			if p.Process {
+				return p.waitVersionProcessed(client)
+			}
+
+			return nil
+		}
+
+		if !p.AutoSuffix || !isVersionExists(err) || attempt >= maxVersionSuffix {
+			return err
+		}
+
+		existing, derr := describeApplicationVersion(client, p.Application, label)
+
+		if derr != nil {
+			return err
+		}
+
+		if existing != nil && p.sameBundle(existing.SourceBundle) {
+			log.WithField("versionlabel", label).Info("Version already exists for this bundle, reusing it")
+			p.useVersionLabel(label)
+			return nil
+		}
+
+		label = fmt.Sprintf("%s-%d", p.VersionLabel, attempt+1)
+
+		log.WithField("versionlabel", label).Warn("Version label already exists for a different bundle, retrying with a suffix")
+	}
+}
+
+// waitVersionProcessed waits for Beanstalk to validate the bundle of the
+// version, environments refuse to update to a version still processing.
+// The events of the version tell why processing failed.
+func (p *Plugin) waitVersionProcessed(client *elasticbeanstalk.ElasticBeanstalk) error {
+	versionLog := log.WithFields(log.Fields{
+		"application":  p.Application,
+		"versionlabel": p.VersionLabel,
+		"timeout":      p.ProcessTimeout,
+	})
+
+	cursor := newVersionEventCursor(p.Application, p.VersionLabel, p.versionCreated)
+	budget := newWaitBudget(p.ProcessTimeout, p.Polling)
+	reason := ""
+
+	for {
+		version, err := describeApplicationVersion(client, p.Application, p.VersionLabel)
+
+		if err != nil {
+			versionLog.WithError(err).Error("Problem retrieving application version")
+			return err
+		}
+
+		events, err := cursor.next(client)
+
+		if err != nil {
+			versionLog.WithError(err).Error("Problem retrieving application version events")
+			return err
+		}
+
+		for _, e := range events {
+			logEvent(versionLog, e)
+		}
+
+		if failed := firstError(events); failed != nil {
+			reason = aws.StringValue(failed.Message)
+		}
+
+		status := ""
+
+		if version != nil {
+			status = aws.StringValue(version.Status)
+		}
+
+		switch status {
+		case elasticbeanstalk.ApplicationVersionStatusProcessed:
+			versionLog.Info("Application version processed")
+
+			// the update only follows the events that come after
+			p.versionCreated = cursor.since.Add(time.Nanosecond)
+			return nil
+		case elasticbeanstalk.ApplicationVersionStatusFailed:
+			err := errVersionProcessing
+			versionLog.WithError(err).WithField("failure", reason).Error("Application version is invalid")
+			return err
+		}
+
+		versionLog.WithField("status", status).Info("Waiting for application version to be processed")
+
+		if !budget.wait() {
+			err := errTimedOut
+			versionLog.WithError(err).Error("Application version was never processed")
+			return err
+		}
+	}
+}
+
+// handleExistingVersion applies OnExistingVersion to a version with the same
+// label, done tells that no version has to be created anymore.
+func (p *Plugin) handleExistingVersion(client *elasticbeanstalk.ElasticBeanstalk, existing *elasticbeanstalk.ApplicationVersionDescription) (bool, error) {
+	versionLog := log.WithFields(log.Fields{
+		"application":  p.Application,
+		"versionlabel": p.VersionLabel,
+	})
+
+	switch p.OnExistingVersion {
+	case "":
+		// without a policy only the same bundle is reused, a different one
+		// would ship under the label silently
+		if !p.sameBundle(existing.SourceBundle) {
+			versionLog.WithError(errVersionExists).Error("Version label is already taken by a different bundle")
+			return true, errVersionExists
+		}
+
+		versionLog.Info("Version already exists, reusing it")
+		return true, nil
+	case existingReuse:
+		if !p.sameBundle(existing.SourceBundle) {
+			versionLog.Warn("Version already exists for a different bundle, reusing it")
+		} else {
+			versionLog.Info("Version already exists, reusing it")
+		}
+
+		return true, nil
+	case existingFail:
+		versionLog.WithError(errVersionExists).Error("Version label is already taken")
+		return true, errVersionExists
+	case existingRecreate:
+		versionLog.Warn("Version already exists, deleting it to create it again")
+
+		// the bundle stays, it may well be the one just uploaded
+		_, err := client.DeleteApplicationVersion(
+			&elasticbeanstalk.DeleteApplicationVersionInput{
+				ApplicationName:    aws.String(p.Application),
+				VersionLabel:       aws.String(p.VersionLabel),
+				DeleteSourceBundle: aws.Bool(false),
+			},
+		)
+
+		return false, err
+	}
+
+	return true, fmt.Errorf("unknown existing version policy %s", p.OnExistingVersion)
+}
+
+// useVersionLabel carries the label that was actually registered through to
+// the environment update.
+func (p *Plugin) useVersionLabel(label string) {
+	if label != p.VersionLabel {
+		log.WithFields(log.Fields{
+			"requested":    p.VersionLabel,
+			"versionlabel": label,
+		}).Info("Using suffixed version label")
+	}
+
+	p.VersionLabel = label
+}
+
+// sameBundle reports whether an existing source bundle is the one configured.
+func (p *Plugin) sameBundle(bundle *elasticbeanstalk.S3Location) bool {
+	return bundle != nil &&
+		aws.StringValue(bundle.S3Bucket) == p.Bucket &&
+		aws.StringValue(bundle.S3Key) == p.BucketKey
+}
+
+// describeApplicationVersion returns the version with the label, or nil when
+// it does not exist.
+func describeApplicationVersion(client *elasticbeanstalk.ElasticBeanstalk, application, label string) (*elasticbeanstalk.ApplicationVersionDescription, error) {
+	out, err := client.DescribeApplicationVersions(
+		&elasticbeanstalk.DescribeApplicationVersionsInput{
+			ApplicationName: aws.String(application),
+			VersionLabels:   aws.StringSlice([]string{label}),
+		},
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(out.ApplicationVersions) == 0 {
+		return nil, nil
+	}
+
+	return out.ApplicationVersions[0], nil
+}
+
+// isVersionExists matches the error returned for a duplicate version label.
+func isVersionExists(err error) bool {
+	if e, ok := err.(awserr.Error); ok {
+		return e.Code() == "InvalidParameterValue" &&
+			strings.Contains(e.Message(), "already exists")
+	}
+
+	return false
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"math/rand"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/service/elasticbeanstalk"
+)
+
+const (
+	// minPollInterval is the first, and after progress the next, interval
+	// between two polls of the environment.
+	minPollInterval = 5 * time.Second
+
+	// maxPollInterval caps the interval while nothing happens.
+	maxPollInterval = 30 * time.Second
+)
+
+// Polling overrides how often the environments are polled. The interval
+// replaces the first interval of the wait budget, which still backs off
+// to the same multiple of it, and the fixed intervals of the health
+// checks. Up to Jitter is added to every sleep.
+type Polling struct {
+	Interval time.Duration
+	Jitter   time.Duration
+}
+
+// interval returns the configured interval, or else the default.
+func (pl Polling) interval(def time.Duration) time.Duration {
+	if pl.Interval > 0 {
+		return pl.Interval
+	}
+
+	return def
+}
+
+// jitter returns a random delay up to the configured jitter.
+func (pl Polling) jitter() time.Duration {
+	if pl.Jitter <= 0 {
+		return 0
+	}
+
+	return time.Duration(rand.Int63n(int64(pl.Jitter)))
+}
+
+// next returns how long to sleep before the next fixed interval poll.
+func (pl Polling) next(def time.Duration) <-chan time.Time {
+	return time.After(pl.interval(def) + pl.jitter())
+}
+
+// waitBudget paces the polls of an environment within an overall deadline,
+// shared by every phase waiting on the environment so together they never
+// take longer than the timeout. The interval doubles while nothing happens
+// and starts over once something does.
+type waitBudget struct {
+	deadline time.Time
+	interval time.Duration
+
+	polling Polling
+	min     time.Duration
+	max     time.Duration
+}
+
+// newWaitBudget starts a budget of the timeout, paced by the polling.
+func newWaitBudget(timeout time.Duration, polling Polling) *waitBudget {
+	min := polling.interval(minPollInterval)
+
+	return &waitBudget{
+		deadline: time.Now().Add(timeout),
+		interval: min,
+		polling:  polling,
+		min:      min,
+		max:      min * (maxPollInterval / minPollInterval),
+	}
+}
+
+// remaining is what is left of the budget.
+func (b *waitBudget) remaining() time.Duration {
+	return time.Until(b.deadline)
+}
+
+// wait sleeps until the next poll, reporting false without sleeping once
+// the budget is spent. The last sleep is cut short at the deadline.
+func (b *waitBudget) wait() bool {
+	left := b.remaining()
+
+	if left <= 0 {
+		return false
+	}
+
+	d := b.interval + b.polling.jitter()
+
+	if d > left {
+		d = left
+	}
+
+	// a timer that fired needs no stopping, unlike the tickers of time.Tick
+	// which are never released
+	<-time.NewTimer(d).C
+
+	if b.interval *= 2; b.interval > b.max {
+		b.interval = b.max
+	}
+
+	return true
+}
+
+// progress polls sooner again after something changed.
+func (b *waitBudget) progress() {
+	b.interval = b.min
+}
+
+// awaitsHealth reports whether updated environments are waited on until
+// they are healthy, for real or as a simulated red health.
+func (p *Plugin) awaitsHealth() bool {
+	return p.Chaos.RedHealth || p.HealthWait.Enabled
+}
+
+// awaitHealth waits for an updated environment to be healthy enough for the
+// deploy to carry on.
+func (p *Plugin) awaitHealth(client *elasticbeanstalk.ElasticBeanstalk, envLog *log.Entry, environment string) error {
+	if p.Chaos.RedHealth {
+		return redHealth(envLog)
+	}
+
+	return p.HealthWait.Wait(client, envLog, environment)
+}
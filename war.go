@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// addWARs packages WAR files following the Elastic Beanstalk Tomcat
+// conventions. Entries are context=path pairs, the root context becomes
+// ROOT.war and every other context is deployed from <context>.war. A plain
+// path is deployed to the root context.
+func addWARs(b *zipBundle, wars []string) error {
+	seen := map[string]bool{}
+
+	for _, entry := range wars {
+		context, path := "/", entry
+
+		if i := strings.Index(entry, "="); i >= 0 {
+			context, path = entry[:i], entry[i+1:]
+		}
+
+		name := warName(context)
+
+		if seen[name] {
+			return fmt.Errorf("more than one WAR for the %s context", context)
+		}
+
+		seen[name] = true
+
+		if err := b.addFile(name, path); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// warName returns the file name Tomcat deploys to the context path.
+func warName(context string) string {
+	context = strings.Trim(context, "/")
+
+	if context == "" {
+		return "ROOT.war"
+	}
+
+	return strings.Replace(context, "/", "#", -1) + ".war"
+}
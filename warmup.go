@@ -0,0 +1,85 @@
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// WarmUp sends requests to a freshly deployed environment so caches and JIT
+// compilers are primed before users reach it.
+type WarmUp struct {
+	Paths       []string
+	Requests    int
+	Concurrency int
+}
+
+// run sends the requests to the paths in turn and logs how many failed.
+// Failing warm-up requests never fail the deploy.
+func (w *WarmUp) run(envLog *log.Entry, baseURL string) {
+	paths := w.Paths
+
+	if len(paths) == 0 {
+		paths = []string{"/"}
+	}
+
+	concurrency := w.Concurrency
+
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	jobs := make(chan string)
+	var failed int64
+	var wg sync.WaitGroup
+
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for url := range jobs {
+				resp, err := httpClient.Get(url)
+
+				if err != nil {
+					atomic.AddInt64(&failed, 1)
+					continue
+				}
+
+				io.Copy(ioutil.Discard, resp.Body)
+				resp.Body.Close()
+
+				if resp.StatusCode >= 500 {
+					atomic.AddInt64(&failed, 1)
+				}
+			}
+		}()
+	}
+
+	envLog.WithFields(log.Fields{
+		"url":         baseURL,
+		"requests":    w.Requests,
+		"concurrency": concurrency,
+	}).Info("Warming up environment")
+
+	for i := 0; i < w.Requests; i++ {
+		jobs <- strings.TrimRight(baseURL, "/") + "/" + strings.TrimLeft(paths[i%len(paths)], "/")
+	}
+
+	close(jobs)
+	wg.Wait()
+
+	fields := envLog.WithField("failed", failed)
+
+	if failed > 0 {
+		fields.Warning("Some warm-up requests failed")
+		return
+	}
+
+	fields.Info("Environment warmed up")
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/service/elasticbeanstalk"
+)
+
+var (
+	errOutsideWindow = errors.New("outside of the deploy windows")
+	errFrozen        = errors.New("environment is frozen")
+)
+
+// maxWindowSearch bounds the search for the next deploy window.
+const maxWindowSearch = 8 * 24 * time.Hour
+
+// deployWindow is a cron-like expression of the minutes deploys are allowed
+// in, with the minute, hour, day of month, month and day of week fields.
+type deployWindow struct {
+	expr   string
+	fields [5]map[int]bool
+}
+
+var windowFieldRanges = [5][2]int{
+	{0, 59},
+	{0, 23},
+	{1, 31},
+	{1, 12},
+	{0, 6},
+}
+
+// parseDeployWindow parses an expression such as "* 9-17 * * 1-5".
+func parseDeployWindow(expr string) (*deployWindow, error) {
+	parts := strings.Fields(expr)
+
+	if len(parts) != 5 {
+		return nil, fmt.Errorf("deploy window %q needs 5 fields", expr)
+	}
+
+	w := &deployWindow{expr: expr}
+
+	for i, part := range parts {
+		values, err := parseWindowField(part, windowFieldRanges[i][0], windowFieldRanges[i][1])
+
+		if err != nil {
+			return nil, fmt.Errorf("deploy window %q: %s", expr, err)
+		}
+
+		w.fields[i] = values
+	}
+
+	return w, nil
+}
+
+// parseWindowField expands a field made of lists, ranges and steps.
+func parseWindowField(field string, min, max int) (map[int]bool, error) {
+	values := map[int]bool{}
+
+	for _, item := range strings.Split(field, ",") {
+		step := 1
+
+		if i := strings.Index(item, "/"); i >= 0 {
+			n, err := strconv.Atoi(item[i+1:])
+
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid step in %q", item)
+			}
+
+			step, item = n, item[:i]
+		}
+
+		lo, hi := min, max
+
+		if item != "*" {
+			bounds := strings.SplitN(item, "-", 2)
+			var err error
+
+			if lo, err = strconv.Atoi(bounds[0]); err != nil {
+				return nil, fmt.Errorf("invalid value %q", item)
+			}
+
+			hi = lo
+
+			if len(bounds) == 2 {
+				if hi, err = strconv.Atoi(bounds[1]); err != nil {
+					return nil, fmt.Errorf("invalid value %q", item)
+				}
+			}
+		}
+
+		if lo < min || hi > max || lo > hi {
+			return nil, fmt.Errorf("%q is out of range %d-%d", item, min, max)
+		}
+
+		for v := lo; v <= hi; v += step {
+			values[v] = true
+		}
+	}
+
+	return values, nil
+}
+
+// allows reports whether the minute of t is inside the window.
+func (w *deployWindow) allows(t time.Time) bool {
+	return w.fields[0][t.Minute()] &&
+		w.fields[1][t.Hour()] &&
+		w.fields[2][t.Day()] &&
+		w.fields[3][int(t.Month())] &&
+		w.fields[4][int(t.Weekday())]
+}
+
+// DeployWindows restricts when deploys may happen.
+type DeployWindows struct {
+	Windows  []*deployWindow
+	Location *time.Location
+	Wait     bool
+}
+
+// allows reports whether any window includes t.
+func (d *DeployWindows) allows(t time.Time) bool {
+	if len(d.Windows) == 0 {
+		return true
+	}
+
+	t = t.In(d.Location)
+
+	for _, w := range d.Windows {
+		if w.allows(t) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// next returns the start of the next window after t.
+func (d *DeployWindows) next(t time.Time) (time.Time, bool) {
+	t = t.Truncate(time.Minute)
+
+	for end := t.Add(maxWindowSearch); t.Before(end); t = t.Add(time.Minute) {
+		if d.allows(t) {
+			return t, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// checkDeployWindow fails outside of the deploy windows, or waits for the
+// next one to open when configured to.
+func (p *Plugin) checkDeployWindow() error {
+	now := time.Now()
+
+	if p.Windows.allows(now) {
+		return nil
+	}
+
+	next, ok := p.Windows.next(now)
+
+	fields := log.Fields{}
+
+	if ok {
+		fields["next-window"] = next.In(p.Windows.Location).Format(time.RFC3339)
+	}
+
+	if !p.Windows.Wait || !ok {
+		log.WithFields(fields).WithError(errOutsideWindow).Error("Deploys are not allowed right now")
+		return errOutsideWindow
+	}
+
+	log.WithFields(fields).Info("Waiting for the next deploy window")
+
+	time.Sleep(next.Sub(now))
+
+	return nil
+}
+
+// checkFreeze refuses to deploy to environments carrying the freeze tag.
+func (p *Plugin) checkFreeze(client *elasticbeanstalk.ElasticBeanstalk, envLog *log.Entry, environment string) error {
+	if p.FreezeTag == "" {
+		return nil
+	}
+
+	tags, err := p.environmentTags(client, environment)
+
+	if err != nil {
+		envLog.WithError(err).Error("Problem retrieving environment tags")
+		return err
+	}
+
+	if value, ok := tags[p.FreezeTag]; ok && value != "false" {
+		envLog.WithField(p.FreezeTag, value).WithError(errFrozen).Error("Environment is frozen, remove the tag to deploy")
+		return errFrozen
+	}
+
+	return nil
+}